@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// A host that starts serving error stubs or placeholders with 200 OK shows
+// up as pages far smaller (or larger) than the rest of the range. The job
+// keeps the sizes of its normal pages and checks each new one against their
+// median.
+
+const (
+	// anomalyMinSamples is how many normal pages are needed before sizes are
+	// judged at all.
+	anomalyMinSamples = 5
+
+	anomalyWarn  = "warn"
+	anomalyRetry = "retry"
+	anomalyPause = "pause"
+)
+
+// sizeStats is the sorted list of normal page sizes seen so far.
+type sizeStats struct {
+	sizes []int64
+}
+
+func (s *sizeStats) add(n int64) {
+	i := sort.Search(len(s.sizes), func(i int) bool { return s.sizes[i] >= n })
+	s.sizes = append(s.sizes, 0)
+	copy(s.sizes[i+1:], s.sizes[i:])
+	s.sizes[i] = n
+}
+
+func (s *sizeStats) median() int64 {
+	return s.sizes[len(s.sizes)/2]
+}
+
+// outlier reports whether n is more than ratio times off the median.
+func (s *sizeStats) outlier(n int64, ratio float64) bool {
+	if len(s.sizes) < anomalyMinSamples || ratio <= 1 {
+		return false
+	}
+	m := float64(s.median())
+	return float64(n)*ratio < m || float64(n) > m*ratio
+}
+
+func parseAnomalyAction(v string) error {
+	switch v {
+	case "", "off", anomalyWarn, anomalyRetry, anomalyPause:
+		return nil
+	}
+	return fmt.Errorf("on-anomaly must be off, warn, retry or pause (got %q)", v)
+}
+
+// checkSize judges a page that just arrived with 200 and applies
+// -on-anomaly. It returns the result to keep (a retry may replace it) and
+// false if the run should stop.
+func (jr *jobRun) checkSize(dres dlResult, urlNow, fileNow string) (dlResult, bool) {
+	o := jr.o
+	if o.onAnomaly == "" || o.onAnomaly == "off" {
+		return dres, true
+	}
+	if !jr.sizes.outlier(dres.Size, o.anomalyRatio) {
+		jr.sizes.add(dres.Size)
+		return dres, true
+	}
+	fmt.Printf("[odd ] %s is %d bytes, typical is %d; the host may be serving a stub\n",
+		filepath.Base(fileNow), dres.Size, jr.sizes.median())
+
+	switch o.onAnomaly {
+	case anomalyRetry:
+		jr.sleep(jr.interval())
+		fmt.Fprintf(logAt(o.verbosity, lvlNormal), "[retry] %s\n", urlNow)
+		rres := jr.get(urlNow, fileNow)
+		if rres.Err != nil || rres.StatusCode != 200 {
+			fmt.Printf("[WARN] retry of %s failed (%v, status=%d); keeping the odd file\n", urlNow, rres.Err, rres.StatusCode)
+			return dres, true
+		}
+		if jr.sizes.outlier(rres.Size, o.anomalyRatio) {
+			fmt.Printf("[odd ] %s is still %d bytes; keeping it\n", filepath.Base(fileNow), rres.Size)
+		} else {
+			jr.sizes.add(rres.Size)
+		}
+		return rres, true
+	case anomalyPause:
+		return dres, jr.pause("[odd ] paused")
+	}
+	return dres, true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -backoff-strategy: how the wait before retrying grows with the number of
+// consecutive errors n (counted up to -backoff-max-steps). Every one is a
+// multiple of the interval and is capped by -max-wait.
+const (
+	backoffExponential  = "exponential"         // -backoff^n
+	backoffDecorrelated = "decorrelated-jitter" // random, up to 3x the last wait
+	backoffFibonacci    = "fibonacci"           // 2, 3, 5, 8, 13, ...
+	backoffConstant     = "constant"            // -backoff every time
+)
+
+func parseBackoffStrategy(v string) error {
+	switch v {
+	case backoffExponential, backoffDecorrelated, backoffFibonacci, backoffConstant:
+		return nil
+	}
+	return fmt.Errorf("backoff-strategy must be exponential, decorrelated-jitter, fibonacci or constant (got %q)", v)
+}
+
+// backoffWait is the wait before retrying after errs consecutive errors,
+// uncapped, and why.
+func (jr *jobRun) backoffWait(errs int) (time.Duration, string) {
+	base, o := jr.interval(), jr.o
+	n := min(errs, o.backoffSteps)
+	var m float64
+	switch o.backoffStrategy {
+	case backoffDecorrelated:
+		// AWS's "decorrelated jitter": anywhere from the interval to three
+		// times the last wait, so clients that failed together spread out
+		prev := jr.lastBackoff
+		if errs <= 1 || prev < base {
+			prev = base
+		}
+		wait := base
+		if span := 3*prev - base; span > 0 {
+			wait += time.Duration(rand.Int63n(int64(span)))
+		}
+		jr.lastBackoff = wait
+		if limit := time.Duration(o.maxWait) * time.Second; wait > limit {
+			jr.lastBackoff = limit
+		}
+		return wait, fmt.Sprintf("decorrelated-jitter backoff drew %v (from %v to 3 x %v) after %d consecutive error(s)",
+			wait.Round(time.Millisecond), base, prev.Round(time.Millisecond), errs)
+	case backoffFibonacci:
+		a, b := 1.0, 2.0
+		for i := 1; i < n; i++ {
+			a, b = b, a+b
+		}
+		m = b
+	case backoffConstant:
+		m = o.backoff
+	default:
+		m = math.Pow(o.backoff, float64(n))
+	}
+	return time.Duration(float64(base) * m), fmt.Sprintf("%s backoff %v x %.4g after %d consecutive error(s)", o.backoffStrategy, base, m, errs)
+}
+
+// backoffReset is -backoff-reset: when the consecutive-error count behind
+// the backoff and -max-errors goes back down.
+type backoffReset struct {
+	successes int           // successes:N; 1 = on any success
+	decay     time.Duration // decay:D; one error forgiven per D without a new one
+}
+
+func parseBackoffReset(v string) (backoffReset, error) {
+	kind, arg, _ := strings.Cut(v, ":")
+	switch {
+	case v == "success":
+		return backoffReset{successes: 1}, nil
+	case kind == "successes":
+		if n, err := strconv.Atoi(arg); err == nil && n >= 1 {
+			return backoffReset{successes: n}, nil
+		}
+	case kind == "decay":
+		if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+			return backoffReset{decay: d}, nil
+		}
+	}
+	return backoffReset{}, fmt.Errorf("backoff-reset must be success, successes:N or decay:DURATION (got %q)", v)
+}
+
+// errorStreak counts consecutive errors under a backoffReset.
+type errorStreak struct {
+	rule  backoffReset
+	count int
+	oks   int       // successes since the last error
+	since time.Time // decay: last error or last step down
+}
+
+// fail counts an error at now and returns the count.
+func (e *errorStreak) fail(now time.Time) int {
+	e.settle(now)
+	e.count++
+	e.oks = 0
+	e.since = now
+	return e.count
+}
+
+// ok counts a success at now.
+func (e *errorStreak) ok(now time.Time) {
+	if e.rule.decay > 0 {
+		e.settle(now)
+		return
+	}
+	if e.oks++; e.oks >= e.rule.successes {
+		e.count, e.oks = 0, 0
+	}
+}
+
+// settle forgives the errors that have decayed by now.
+func (e *errorStreak) settle(now time.Time) {
+	if e.rule.decay <= 0 || e.count == 0 {
+		return
+	}
+	steps := int(now.Sub(e.since) / e.rule.decay)
+	if steps <= 0 {
+		return
+	}
+	e.count = max(e.count-steps, 0)
+	e.since = e.since.Add(time.Duration(steps) * e.rule.decay)
+}
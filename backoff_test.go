@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func backoffJob(strategy string) *jobRun {
+	return &jobRun{session: &session{live: newLiveControl()}, o: options{interval: 2, backoff: 2, backoffStrategy: strategy, backoffSteps: 4, maxWait: 60}}
+}
+
+func TestBackoffWait(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     []time.Duration // after 1, 2, ... consecutive errors
+	}{
+		{backoffExponential, []time.Duration{4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, 32 * time.Second}},
+		{backoffFibonacci, []time.Duration{4 * time.Second, 6 * time.Second, 10 * time.Second, 16 * time.Second, 16 * time.Second}},
+		{backoffConstant, []time.Duration{4 * time.Second, 4 * time.Second, 4 * time.Second}},
+	}
+	for _, tt := range tests {
+		jr := backoffJob(tt.strategy)
+		for i, want := range tt.want {
+			if got, _ := jr.backoffWait(i + 1); got != want {
+				t.Errorf("%s after %d error(s): %v, want %v", tt.strategy, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestBackoffFollowsSlowdowns(t *testing.T) {
+	jr := backoffJob(backoffExponential)
+	jr.slowdowns = 1
+	if got, _ := jr.backoffWait(1); got != 8*time.Second {
+		t.Errorf("got %v, want twice the interval doubled", got)
+	}
+}
+
+func TestDecorrelatedJitterStaysInRange(t *testing.T) {
+	jr := backoffJob(backoffDecorrelated)
+	prev := 2 * time.Second
+	for errs := 1; errs <= 50; errs++ {
+		got, _ := jr.backoffWait(errs)
+		if got < 2*time.Second || got > 3*prev {
+			t.Fatalf("after %d error(s): %v, want 2s to %v", errs, got, 3*prev)
+		}
+		prev = got
+		if limit := 60 * time.Second; prev > limit {
+			prev = limit
+		}
+	}
+}
+
+func TestParseBackoffStrategy(t *testing.T) {
+	if err := parseBackoffStrategy("linear"); err == nil {
+		t.Error("linear was accepted")
+	}
+	if err := parseBackoffStrategy(backoffFibonacci); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestErrorStreakReset(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, v := range []string{"", "never", "successes:0", "decay:0s", "decay:x"} {
+		if _, err := parseBackoffReset(v); err == nil {
+			t.Errorf("parseBackoffReset(%q) accepted", v)
+		}
+	}
+
+	rule, _ := parseBackoffReset("success")
+	e := errorStreak{rule: rule}
+	e.fail(now)
+	e.fail(now)
+	e.ok(now)
+	if got := e.fail(now); got != 1 {
+		t.Errorf("success: count after reset = %d, want 1", got)
+	}
+
+	rule, _ = parseBackoffReset("successes:3")
+	e = errorStreak{rule: rule}
+	e.fail(now)
+	e.fail(now)
+	e.ok(now)
+	e.ok(now)
+	if got := e.fail(now); got != 3 {
+		t.Errorf("successes:3: count after two successes = %d, want 3", got)
+	}
+	e.ok(now)
+	e.ok(now)
+	e.ok(now)
+	if got := e.fail(now); got != 1 {
+		t.Errorf("successes:3: count after three successes = %d, want 1", got)
+	}
+
+	rule, _ = parseBackoffReset("decay:1m")
+	e = errorStreak{rule: rule}
+	for range 4 {
+		e.fail(now)
+	}
+	e.ok(now.Add(30 * time.Second))
+	if got := e.fail(now.Add(90 * time.Second)); got != 4 {
+		t.Errorf("decay:1m: count after 90s = %d, want 4", got)
+	}
+	if got := e.fail(now.Add(90*time.Second + 150*time.Second)); got != 3 {
+		t.Errorf("decay:1m: count after 150s more = %d, want 3", got)
+	}
+}
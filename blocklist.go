@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// hostBan records soft-bans observed for one host across runs.
+type hostBan struct {
+	Bans    int       `json:"bans"`
+	LastBan time.Time `json:"last_ban"`
+	Until   time.Time `json:"until,omitempty"`
+}
+
+type blocklist map[string]*hostBan
+
+const blocklistFile = "blocklist.json"
+
+// defaultSessionDir is where qxdl keeps state shared between runs.
+func defaultSessionDir() string {
+	if d, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(d, "qxdl")
+	}
+	return ".qxdl"
+}
+
+func loadBlocklist(dir string) (blocklist, error) {
+	bl := blocklist{}
+	b, err := os.ReadFile(filepath.Join(dir, blocklistFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return bl, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &bl); err != nil {
+		return nil, err
+	}
+	return bl, nil
+}
+
+func (bl blocklist) save(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(bl, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, blocklistFile+".part")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, blocklistFile))
+}
+
+// blockedFor returns how long host is still cooling off, or 0.
+func (bl blocklist) blockedFor(host string) time.Duration {
+	hb, ok := bl[host]
+	if !ok {
+		return 0
+	}
+	if d := time.Until(hb.Until); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// recordBan counts a soft-ban against host. Once threshold bans have been
+// seen, the host is put on cool-off and true is returned.
+func (bl blocklist) recordBan(host string, threshold int, cooloff time.Duration) bool {
+	hb, ok := bl[host]
+	if !ok {
+		hb = &hostBan{}
+		bl[host] = hb
+	}
+	hb.Bans++
+	hb.LastBan = time.Now()
+	if hb.Bans >= threshold {
+		hb.Until = hb.LastBan.Add(cooloff)
+		return true
+	}
+	return false
+}
+
+// recordClean forgets earlier bans after a run finished without a polite stop.
+func (bl blocklist) recordClean(host string) bool {
+	hb, ok := bl[host]
+	if !ok || time.Until(hb.Until) > 0 {
+		return false
+	}
+	delete(bl, host)
+	return true
+}
+
+// isBanStatus reports whether a status looks like the host pushing us away.
+func isBanStatus(code int) bool {
+	return code == http.StatusForbidden || code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSize reads a byte count with an optional binary suffix: 500M, 2G,
+// 1.5GiB. A bare number is bytes.
+func parseSize(v string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			mult = 1 << (10 * (i + 1))
+			s = s[:n-1]
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("bad size %q (want e.g. 500M or 2G)", v)
+	}
+	return int64(f * float64(mult)), nil
+}
+
+// errInterrupted is why a run stopped on Ctrl-C or SIGTERM.
+var errInterrupted = errors.New("interrupted")
+
+// stopGrace is how long a stopped run gets to save its state and exit.
+const stopGrace = 5 * time.Second
+
+// outOfBudget says why the run must stop before its next page, or "" while
+// neither -max-total-bytes nor -max-duration is used up and the run was not
+// interrupted.
+func (s *session) outOfBudget() string {
+	if s.ctx.Err() != nil {
+		if errors.Is(context.Cause(s.ctx), errInterrupted) {
+			return "interrupted"
+		}
+		return fmt.Sprintf("ran for %v, -max-duration is %v", time.Since(s.started).Round(time.Second), s.o.maxDuration)
+	}
+	if s.o.maxTotalBytes > 0 {
+		if n := s.stats.total(); n >= s.o.maxTotalBytes {
+			return fmt.Sprintf("downloaded %s, -max-total-bytes is %s", humanBytes(n), humanBytes(s.o.maxTotalBytes))
+		}
+	}
+	return ""
+}
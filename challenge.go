@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Anti-bot services answer with an HTML challenge instead of the page,
+// sometimes even with 200. Saving that as 0064.png would corrupt the folder,
+// so such answers are caught before anything is written.
+
+const (
+	challengePause = "pause"
+	challengeWait  = "wait"
+	challengeAbort = "abort"
+
+	// challengePeek is how much of an HTML body is searched for markers.
+	challengePeek = 16 << 10
+)
+
+var challengeMarkers = [][]byte{
+	[]byte("challenge-platform"), // Cloudflare managed and JS challenges
+	[]byte("cf-chl"),
+	[]byte("_cf_chl_opt"),
+	[]byte("<title>Just a moment...</title>"),
+	[]byte("<title>Attention Required! | Cloudflare</title>"),
+	[]byte("ddos-guard"),
+}
+
+func parseChallengeAction(v string) error {
+	switch v {
+	case challengePause, challengeWait, challengeAbort:
+		return nil
+	}
+	return fmt.Errorf("on-challenge must be pause, wait or abort (got %q)", v)
+}
+
+// isChallenge reports whether resp is a challenge page. It only peeks, so
+// br can still be read from the start.
+func isChallenge(resp *http.Response, br *bufio.Reader) bool {
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		return true
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	default:
+		return false
+	}
+	head, _ := br.Peek(challengePeek)
+	head = bytes.ToLower(head)
+	for _, m := range challengeMarkers {
+		if bytes.Contains(head, bytes.ToLower(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// challenge handles a page that came back as a challenge, following
+// -on-challenge. It returns the last try and false if the job should stop.
+func (jr *jobRun) challenge(dres dlResult, urlNow, fileNow string) (dlResult, bool) {
+	o := jr.o
+	fmt.Printf("[chal] %s answered %s with an anti-bot challenge (status=%d); nothing was saved\n",
+		jr.host, urlNow, dres.StatusCode)
+	for tries := 0; dres.Challenge; tries++ {
+		switch {
+		case o.onChallenge == challengeAbort, o.onChallenge == challengeWait && tries >= max(o.retries, 1):
+			fmt.Println("[chal] stopping; open the site in a browser or try again much later")
+			return dres, false
+		case o.onChallenge == challengeWait:
+			fmt.Printf("[chal] cooling down for %v before trying again (%d/%d)\n", o.challengeCooldown, tries+1, max(o.retries, 1))
+			jr.sleep(o.challengeCooldown)
+		default:
+			if !jr.pause("[chal] paused; pass the challenge in a browser (or wait a while)") {
+				return dres, false
+			}
+		}
+		dres = jr.get(urlNow, fileNow)
+	}
+	fmt.Printf("[chal] %s lets us through again\n", jr.host)
+	return dres, true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxChunks caps -chunks: a few connections are enough to get past a
+// per-connection throttle, more would only be rude.
+const maxChunks = 4
+
+// chunking is -chunks and -chunk-min-size: a page at least min bytes long,
+// from a server that takes byte ranges, is fetched in n parts at once.
+type chunking struct {
+	n   int
+	min int64
+}
+
+// use reports whether resp, a 200 to a plain GET, is worth splitting.
+func (c chunking) use(resp *http.Response) bool {
+	return c.n > 1 && resp.ContentLength >= c.min && resp.ContentLength >= int64(c.n) &&
+		strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") && resp.Header.Get("Content-Encoding") == ""
+}
+
+// fetchChunks fills f with the body resp announces: the first part is read
+// from body (resp's own stream, which is then dropped) and the others come
+// from ranged GETs for the same URL, all at once. Every part is checked
+// against its Content-Range and length, and If-Range makes a server whose
+// file changed meanwhile answer 200 instead, which fails the download
+// rather than mixing two versions. It returns the bytes the extra requests
+// received.
+func fetchChunks(ctx context.Context, client *http.Client, req *http.Request, resp *http.Response, body io.Reader, f *os.File, n int) (int64, error) {
+	size := resp.ContentLength
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get("Last-Modified") // If-Range takes no weak ETags
+	}
+	part := size / int64(n)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		extra int64
+		first error // the others are mostly "context canceled" because of it
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if first == nil {
+			first = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+	for i := 1; i < n; i++ {
+		from, to := int64(i)*part, int64(i+1)*part-1
+		if i == n-1 {
+			to = size - 1
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := fetchRange(ctx, client, req, validator, f, from, to, size)
+			mu.Lock()
+			extra += got
+			mu.Unlock()
+			if err != nil {
+				fail(fmt.Errorf("chunk %d-%d: %w", from, to, err))
+			}
+		}()
+	}
+	got, err := io.CopyN(io.NewOffsetWriter(f, 0), body, part)
+	if err != nil {
+		fail(fmt.Errorf("chunk 0-%d: %w (%d bytes)", part-1, err, got))
+	}
+	wg.Wait()
+	return extra, first
+}
+
+// fetchRange writes bytes from..to of the page into f at from.
+func fetchRange(ctx context.Context, client *http.Client, orig *http.Request, validator string, f *os.File, from, to, size int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", orig.URL.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", orig.Header.Get("User-Agent"))
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+	if validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("ranged GET answered %s; the file may have changed", resp.Status)
+	}
+	if want := fmt.Sprintf("bytes %d-%d/%d", from, to, size); resp.Header.Get("Content-Range") != want {
+		return 0, fmt.Errorf("server sent Content-Range %q, want %q", resp.Header.Get("Content-Range"), want)
+	}
+	n, err := io.Copy(io.NewOffsetWriter(f, from), io.LimitReader(resp.Body, to-from+1))
+	if err == nil && n != to-from+1 {
+		err = fmt.Errorf("got %d of %d bytes", n, to-from+1)
+	}
+	return n, err
+}
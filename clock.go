@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Pacing, cooldowns and the waits between pages read the time from a clock
+// and wait through a sleeper, so tests can run Retry-After, backoff and
+// rate limits without waiting them out. Requests go through the client's
+// Transport, which tests replace the same way.
+
+type clock interface {
+	Now() time.Time
+}
+
+// sleeper waits d, or until ctx is done, and returns how long it waited.
+type sleeper interface {
+	Sleep(ctx context.Context, d time.Duration) time.Duration
+}
+
+// realClock is the wall clock every run uses.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	start := time.Now()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	return time.Since(start)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose sleeps return at once and move it on, unless
+// their context is done; it keeps every sleep for the test to check.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) time.Duration {
+	if d <= 0 || ctx.Err() != nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.slept = append(c.slept, d)
+	return d
+}
+
+func (c *fakeClock) sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.slept...)
+}
+
+func (c *fakeClock) total() time.Duration {
+	var t time.Duration
+	for _, d := range c.sleeps() {
+		t += d
+	}
+	return t
+}
+
+// fakeServer is a RoundTripper that answers each request with the next of
+// its replies for that URL, the last one once they run out.
+type fakeServer struct {
+	mu      sync.Mutex
+	replies map[string][]reply
+	got     []string
+}
+
+type reply struct {
+	status int
+	header map[string]string
+	body   string
+	err    error
+}
+
+func (s *fakeServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	u := req.URL.String()
+	s.got = append(s.got, req.Method+" "+u)
+	q := s.replies[u]
+	if len(q) == 0 {
+		s.mu.Unlock()
+		return &http.Response{StatusCode: 404, Status: "404 Not Found", Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	}
+	r := q[0]
+	if len(q) > 1 {
+		s.replies[u] = q[1:]
+	}
+	s.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	h := http.Header{}
+	for k, v := range r.header {
+		h.Set(k, v)
+	}
+	return &http.Response{
+		StatusCode: r.status, Status: http.StatusText(r.status), Header: h,
+		Body: io.NopCloser(strings.NewReader(r.body)), ContentLength: int64(len(r.body)), Request: req,
+	}, nil
+}
+
+func (s *fakeServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.got...)
+}
+
+func TestRealClockSleepEndsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if d := (realClock{}).Sleep(ctx, time.Hour); d > time.Second {
+		t.Fatalf("slept %v on a canceled context", d)
+	}
+	if d := (realClock{}).Sleep(context.Background(), -time.Second); d != 0 {
+		t.Fatalf("negative sleep took %v", d)
+	}
+}
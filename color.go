@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"os"
+)
+
+// On a terminal, the tag starting a log line is colored by what it says:
+// green for a saved page, yellow for skips and warnings, red for failures,
+// blue for waits and retries. Like -log-file it sits on a pipe in front of
+// stdout, and it stays out of the way when stdout is not a terminal, with
+// -no-color, with NO_COLOR set or under the dashboard. The log file gets
+// the lines without the colors.
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+	ansiCyan   = "\x1b[36m"
+)
+
+var colorTags = map[string]string{
+	"[ ok ]": ansiGreen, "[done]": ansiGreen,
+	"[skip]": ansiYellow, "[miss]": ansiYellow, "[dup ]": ansiYellow, "[odd ]": ansiYellow, "[WARN]": ansiYellow,
+	"[fail]": ansiRed, "[bad ]": ansiRed, "[stop]": ansiRed, "[ERROR]": ansiRed,
+	"[redo]": ansiBlue, "[wait]": ansiBlue, "[cool]": ansiBlue, "[rate]": ansiBlue, "[hold]": ansiBlue, "[slow]": ansiBlue,
+	"[ctl ]": ansiCyan, "[host]": ansiCyan,
+}
+
+// wantColor reports whether output to f should be colored.
+func wantColor(f *os.File, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return enableColor(f)
+}
+
+// colorize colors line's leading tag, if it has a known one.
+func colorize(line []byte) []byte {
+	if len(line) == 0 || line[0] != '[' {
+		return line
+	}
+	end := bytes.IndexByte(line, ']')
+	if end < 0 {
+		return line
+	}
+	c, ok := colorTags[string(line[:end+1])]
+	if !ok {
+		return line
+	}
+	out := make([]byte, 0, len(line)+len(c)+len(ansiReset))
+	out = append(out, c...)
+	out = append(out, line[:end+1]...)
+	out = append(out, ansiReset...)
+	return append(out, line[end+1:]...)
+}
+
+type colorOut struct {
+	term    *os.File
+	pipe    *os.File
+	drained chan struct{}
+}
+
+// runColor is the running colorizer, if any.
+var runColor *colorOut
+
+// startColor puts the colorizer in front of stdout.
+func startColor() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	runColor = &colorOut{term: os.Stdout, pipe: w, drained: make(chan struct{})}
+	os.Stdout = w
+	go runColor.read(r)
+	return nil
+}
+
+// stopColor writes out what is still in the pipe and gives stdout back.
+func stopColor() {
+	c := runColor
+	if c == nil {
+		return
+	}
+	runColor = nil
+	os.Stdout = c.term
+	c.pipe.Close()
+	<-c.drained
+}
+
+// read passes everything on as it comes, so a prompt without a newline still
+// shows; only a tag at the start of a line is colored.
+func (c *colorOut) read(r *os.File) {
+	defer close(c.drained)
+	buf := make([]byte, 32*1024)
+	mid := false // the last piece ended inside a line
+	for {
+		n, err := r.Read(buf)
+		for b := buf[:n]; len(b) > 0; {
+			i := bytes.IndexByte(b, '\n') + 1
+			if i == 0 {
+				i = len(b)
+			}
+			piece := b[:i]
+			if !mid {
+				piece = colorize(piece)
+			}
+			c.term.Write(piece)
+			mid = b[i-1] != '\n'
+			b = b[i:]
+		}
+		if err != nil {
+			return
+		}
+	}
+}
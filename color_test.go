@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestColorizeTagsOnly(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"[ ok ] 0001.png (12 KB)\n", ansiGreen + "[ ok ]" + ansiReset + " 0001.png (12 KB)\n"},
+		{"[ERROR] no such host\n", ansiRed + "[ERROR]" + ansiReset + " no such host\n"},
+		{"[req ] GET /a\n", "[req ] GET /a\n"},
+		{"plain [fail] line\n", "plain [fail] line\n"},
+		{"[unclosed\n", "[unclosed\n"},
+		{"", ""},
+	} {
+		if got := string(colorize([]byte(tc.in))); got != tc.want {
+			t.Errorf("colorize(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNoColorWins(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	if wantColor(os.Stdout, false) {
+		t.Error("colors despite NO_COLOR")
+	}
+	t.Setenv("NO_COLOR", "")
+	if wantColor(os.Stdout, true) {
+		t.Error("colors despite -no-color")
+	}
+}
+
+func TestColorPipeKeepsPartialLines(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	stdout := os.Stdout
+	os.Stdout = w
+	if err := startColor(); err != nil {
+		os.Stdout = stdout
+		t.Fatal(err)
+	}
+	os.Stdout.WriteString("Start? [y/N] ")
+	os.Stdout.WriteString("[skip] still on the prompt's line\n")
+	os.Stdout.WriteString("[skip] 0002.png exists\n[ ok ] 0003")
+	os.Stdout.WriteString(".png\n")
+	stopColor()
+	os.Stdout = stdout
+	w.Close()
+
+	want := "Start? [y/N] [skip] still on the prompt's line\n" + ansiYellow + "[skip]" + ansiReset + " 0002.png exists\n" + ansiGreen + "[ ok ]" + ansiReset + " 0003.png\n"
+	if got := <-out; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// subcommands work on local folders only, so archives stay useful after the
+// source site is gone. They share their code with the post-run steps.
+var subcommands = map[string]func(args []string) int{
+	"pack":         cmdPack,
+	"export":       cmdExport,
+	"verify":       cmdVerify,
+	"repair":       cmdRepair,
+	"report":       cmdReport,
+	"normalize":    cmdNormalize,
+	"merge-report": cmdMergeReport,
+	"history":      cmdHistory,
+	"queue":        cmdQueue,
+	"gc":           cmdGC,
+	"version":      cmdVersion,
+	"self-update":  cmdSelfUpdate,
+	"ctl":          cmdCtl,
+}
+
+// folderArg parses fs and returns its single FOLDER argument.
+func folderArg(fs *flag.FlagSet, args []string) string {
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Printf("Usage: qxdl %s [flags] FOLDER\n", fs.Name())
+		fs.PrintDefaults()
+		os.Exit(exitBadArgs)
+	}
+	return fs.Arg(0)
+}
+
+func cmdPack(args []string) int {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	format := fs.String("format", "cbz", "Archive format: cbz or zip")
+	out := fs.String("o", "", "Output file (default FOLDER.<format>)")
+	dir := folderArg(fs, args)
+
+	name, err := packFolder(dir, *format, *out)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	fmt.Println("[pack]", name)
+	return exitOK
+}
+
+func cmdExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	kinds := fs.String("export", "xmp,hydrus,sha256", "Comma separated exports: xmp,hydrus,nomedia,sha256")
+	dir := folderArg(fs, args)
+
+	exports, err := parseExports(*kinds)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitBadArgs
+	}
+	pages, err := scanFolder(dir)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	if err := runExports(exports, dir, seriesName(dir), exportPages(pages)); err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	fmt.Printf("[export] %d pages\n", len(pages))
+	return exitOK
+}
+
+func cmdVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	remote := fs.Bool("remote", false, "Also HEAD every page in the manifest and report those changed or gone on the server")
+	gap := fs.Duration("interval", time.Second, "With -remote, minimum gap between two HEADs to a host")
+	ua := fs.String("ua", defaultUA, "With -remote, User-Agent header")
+	timeout := fs.Duration("timeout", 30*time.Second, "With -remote, HTTP timeout")
+	dir := folderArg(fs, args)
+
+	var checked int
+	var problems []pageProblem
+	var err error
+	if fi, serr := os.Stat(dir); serr == nil && !fi.IsDir() {
+		// a packed archive is checked against its embedded qxdl.json
+		if *remote {
+			fmt.Println("[ERROR] -remote needs a folder with a qxdl-manifest.json")
+			return exitBadArgs
+		}
+		checked, problems, err = verifyArchive(dir)
+	} else {
+		var pages []localPage
+		pages, problems, err = verifyFolder(dir)
+		checked = len(pages)
+		var m *manifest
+		var more []pageProblem
+		if err == nil {
+			m, more, err = verifyManifest(dir)
+			problems = append(problems, more...)
+		}
+		if err == nil && *remote {
+			client, cerr := newHTTPClient(nil, *timeout)
+			if cerr != nil {
+				fmt.Println("[ERROR]", cerr)
+				return exitError
+			}
+			problems = append(problems, verifyRemote(client, dir, m, *ua, *gap, *timeout)...)
+		}
+	}
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	for _, p := range problems {
+		fmt.Printf("[bad ] %s: %s\n", p.File, p.Reason)
+	}
+	fmt.Printf("%d pages checked, %d problems\n", checked, len(problems))
+	if len(problems) > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func cmdReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	dir := folderArg(fs, args)
+
+	rep, err := reportFolder(dir)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(b))
+		return exitOK
+	}
+	fmt.Printf("FOLDER: %s\nPAGES: %d (%d..%d)  BYTES: %d\n", rep.Folder, rep.Pages, rep.First, rep.Last, rep.Bytes)
+	if len(rep.Missing) > 0 {
+		fmt.Printf("MISSING: %v\n", rep.Missing)
+	}
+	if rep.Partial > 0 {
+		fmt.Printf("PARTIAL: %d leftover .part files\n", rep.Partial)
+	}
+	return exitOK
+}
+
+func cmdNormalize(args []string) int {
+	fs := flag.NewFlagSet("normalize", flag.ExitOnError)
+	pad := fs.Int("pad", 0, "Zero padding width (0 = widest already in the folder)")
+	dryRun := fs.Bool("n", false, "Only print what would be renamed")
+	dir := folderArg(fs, args)
+
+	n, err := normalizeFolder(dir, *pad, *dryRun)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	fmt.Printf("%d files renamed\n", n)
+	return exitOK
+}
+
+func cmdMergeReport(args []string) int {
+	fs := flag.NewFlagSet("merge-report", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the merged report as JSON")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Println("Usage: qxdl merge-report [-json] FOLDER|STATE.json ...")
+		return exitBadArgs
+	}
+
+	files, err := stateFiles(fs.Args())
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	var states []*runState
+	for _, f := range files {
+		st, err := loadState(f)
+		if err != nil {
+			fmt.Println("[ERROR]", err)
+			return exitError
+		}
+		states = append(states, st)
+	}
+	if len(states) == 0 {
+		fmt.Println("[ERROR] no state files found")
+		return exitError
+	}
+	rep := mergeStates(states)
+	if *asJSON {
+		b, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(b))
+	} else {
+		fmt.Printf("RANGE: %d..%d  STATE FILES: %d\nOK: %d  MISSING: %d  FAILED: %d  UNCOVERED: %d\n",
+			rep.Start, rep.End, rep.Files, len(rep.OK), len(rep.Missing), len(rep.Failed), len(rep.Uncovered))
+		if len(rep.Failed) > 0 {
+			fmt.Printf("FAILED: %v\n", rep.Failed)
+		}
+		if len(rep.Uncovered) > 0 {
+			fmt.Printf("UNCOVERED: %v\n", rep.Uncovered)
+		}
+	}
+	if len(rep.Failed) > 0 || len(rep.Uncovered) > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func cmdHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	runID := fs.String("run", "", "Print the full reconstructed state of this run as JSON")
+	shard := fs.String("shard", "", "Read the event log of shard K/N")
+	dir := folderArg(fs, args)
+
+	k, n, err := parseShard(*shard)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitBadArgs
+	}
+	evs, err := readEvents(filepath.Join(dir, eventFileName(k, n)))
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	runs := replayRuns(evs)
+	if *runID != "" {
+		for _, st := range runs {
+			if st.ID == *runID {
+				b, _ := json.MarshalIndent(st, "", "  ")
+				fmt.Println(string(b))
+				return exitOK
+			}
+		}
+		fmt.Printf("[ERROR] no run %s in %s\n", *runID, dir)
+		return exitError
+	}
+	for _, st := range runs {
+		counts := map[string]int{}
+		for _, p := range st.Pages {
+			counts[p.Status]++
+		}
+		end := "unfinished"
+		if !st.Finished.IsZero() {
+			end = st.Finished.Format(time.DateTime)
+		}
+		fmt.Printf("%s  %s -> %s  range %d..%d  ok %d  skipped %d  missing %d  failed %d\n",
+			st.ID, st.Started.Format(time.DateTime), end, st.Start, st.End,
+			counts[pageOK], counts[pageSkipped], counts[pageMissing], counts[pageFailed])
+	}
+	return exitOK
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A folder whose range was fetched with nothing missing or failed gets a
+// .qxdl-complete marker. A later job asking for the same range into it is
+// skipped without a request, so batch and -watch runs can be repeated
+// freely. -force ignores the marker, and a run that ends short of complete
+// removes it.
+
+const completeFile = ".qxdl-complete"
+
+type completeMarker struct {
+	URL       string    `json:"url"` // the URL template
+	Start     string    `json:"start"`
+	End       string    `json:"end"` // as asked: a number or auto
+	Step      int       `json:"step"`
+	Rename    string    `json:"rename_start,omitempty"`
+	EndFound  string    `json:"end_found,omitempty"` // with end auto
+	Pages     int       `json:"pages"`
+	Completed time.Time `json:"completed"`
+}
+
+func (m completeMarker) matches(o completeMarker) bool {
+	return m.URL == o.URL && m.Start == o.Start && m.End == o.End && m.Step == o.Step && m.Rename == o.Rename
+}
+
+// readComplete returns folder's marker, or nil.
+func readComplete(folder string) *completeMarker {
+	b, err := os.ReadFile(filepath.Join(folder, completeFile))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Println("[WARN] completion marker:", err)
+		}
+		return nil
+	}
+	var m completeMarker
+	if err := json.Unmarshal(b, &m); err != nil {
+		fmt.Printf("[WARN] %s: %v\n", filepath.Join(folder, completeFile), err)
+		return nil
+	}
+	return &m
+}
+
+func writeComplete(folder string, m completeMarker) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(folder, completeFile+".part")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(folder, completeFile))
+}
+
+func anyFailed(pages []pageState) bool {
+	for _, ps := range pages {
+		if ps.Status == pageFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeComplete reports whether a run that recorded pages fetched all of
+// them: none failed, and none missing but the 404s that found the end.
+func rangeComplete(pages []pageState, endAuto bool, lastFound int) bool {
+	if anyFailed(pages) {
+		return false
+	}
+	for _, ps := range pages {
+		if ps.Status == pageMissing && (!endAuto || ps.Num <= lastFound) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// acceptEncoding is sent with every page GET. Images come back as they are,
+// but error and challenge pages are often compressed; asking for it
+// ourselves (rather than leaving it to net/http) means the body is decoded
+// the same way even when -header sets Accept-Encoding, and the wire bytes
+// can be counted apart from the stored ones.
+const acceptEncoding = "gzip, deflate"
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodeBody undoes Content-Encoding. deflate is zlib-wrapped by the spec
+// but sent raw by some servers, so both are accepted.
+func decodeBody(r io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(2)
+		// a zlib header's first two bytes, read as a big-endian number, are a multiple of 31
+		if len(head) == 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -control PATH listens on a unix socket for one-line commands, so a long
+// run can be slowed down, paused or moved past a stuck page without
+// stopping it:
+//
+//	status            one line: job, page, counts, interval, paused
+//	pause / resume    as SIGUSR1 / SIGUSR2
+//	skip-current      give up on the page in progress, waits and retries included
+//	set-interval N    seconds between pages from now on; "default" undoes it
+//
+// Each command gets one line back, starting with "ok" or "error:".
+// `qxdl ctl SOCKET COMMAND` sends one.
+
+// liveControl is what the control socket sees of and changes in the run.
+type liveControl struct {
+	mu       sync.Mutex
+	job      string
+	folder   string
+	page     string
+	base     int // the job's -interval
+	progress jobProgress
+	interval int                // seconds set through the socket; -1 = as configured
+	endPage  context.CancelFunc // ends the page in progress
+}
+
+func newLiveControl() *liveControl {
+	return &liveControl{interval: -1}
+}
+
+func (l *liveControl) beginJob(url, folder string, interval int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.job, l.folder, l.page, l.base, l.progress = url, folder, "", interval, jobProgress{}
+}
+
+// beginPage starts page num under ctx and returns its context, which
+// skip-current cancels, and the function that ends it.
+func (l *liveControl) beginPage(ctx context.Context, num string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.page, l.endPage = num, cancel
+	return ctx, cancel
+}
+
+func (l *liveControl) record(ps pageState, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch ps.Status {
+	case pageOK:
+		l.progress.OK++
+		l.progress.Bytes += size
+	case pageSkipped:
+		l.progress.Skipped++
+	case pageMissing:
+		l.progress.Missing++
+	case pageFailed:
+		l.progress.Failed++
+	}
+}
+
+// intervalOverride is the interval set through the socket, or -1.
+func (l *liveControl) intervalOverride() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.interval
+}
+
+// stopControl closes the control socket, if any.
+var stopControl = func() {}
+
+// listenControl serves the control socket at path until stopControl. A
+// socket left behind by a run that crashed is replaced; one another run
+// still answers on is not.
+func (s *session) listenControl(path string) error {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("control: %s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return fmt.Errorf("control: another run listens on %s", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("control: %w", err)
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.controlConn(c)
+		}
+	}()
+	stopControl = func() {
+		ln.Close()
+		os.Remove(path)
+	}
+	return nil
+}
+
+func (s *session) controlConn(c net.Conn) {
+	defer c.Close()
+	sc := bufio.NewScanner(c)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		fmt.Fprintln(c, s.control(line))
+	}
+}
+
+// control runs one command and returns its reply.
+func (s *session) control(line string) string {
+	l := s.live
+	cmd, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case "status":
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		interval := fmt.Sprintf("%ds", l.base)
+		if l.interval >= 0 {
+			interval = fmt.Sprintf("%ds (set live)", l.interval)
+		}
+		s.paused.mu.Lock()
+		paused := s.paused.paused
+		s.paused.mu.Unlock()
+		p := l.progress
+		return fmt.Sprintf("ok job=%q folder=%q page=%s ok=%d skipped=%d missing=%d failed=%d bytes=%d interval=%q paused=%t",
+			l.job, l.folder, l.page, p.OK, p.Skipped, p.Missing, p.Failed, p.Bytes, interval, paused)
+	case "pause":
+		if s.paused.set(true) {
+			fmt.Println("[ctl ] pausing after the current page")
+		}
+		return "ok paused"
+	case "resume":
+		if s.paused.set(false) {
+			fmt.Println("[ctl ] resuming")
+		}
+		return "ok resumed"
+	case "skip-current":
+		l.mu.Lock()
+		page, end := l.page, l.endPage
+		l.mu.Unlock()
+		if end == nil {
+			return "error: no page in progress"
+		}
+		fmt.Printf("[ctl ] giving up on page %s\n", page)
+		end()
+		return "ok skipped " + page
+	case "set-interval":
+		n := -1
+		if arg != "default" {
+			v, err := strconv.Atoi(strings.TrimSuffix(arg, "s"))
+			if err != nil || v < 0 {
+				return "error: set-interval takes seconds (e.g. 10) or default"
+			}
+			n = v
+		}
+		l.mu.Lock()
+		l.interval = n
+		l.mu.Unlock()
+		if n < 0 {
+			fmt.Println("[ctl ] interval back to -interval")
+			return "ok interval default"
+		}
+		fmt.Printf("[ctl ] interval is now %ds\n", n)
+		return fmt.Sprintf("ok interval %ds", n)
+	case "help":
+		return "ok commands: status, pause, resume, skip-current, set-interval N|default"
+	}
+	return fmt.Sprintf("error: unknown command %q (try help)", cmd)
+}
+
+// cmdCtl sends one command to a running qxdl's -control socket.
+func cmdCtl(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fmt.Println("Usage: qxdl ctl SOCKET status|pause|resume|skip-current|set-interval N")
+		return exitBadArgs
+	}
+	c, err := net.DialTimeout("unix", fs.Arg(0), 5*time.Second)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	defer c.Close()
+	if _, err := fmt.Fprintln(c, strings.Join(fs.Args()[1:], " ")); err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	reply = strings.TrimSpace(reply)
+	fmt.Println(reply)
+	if !strings.HasPrefix(reply, "ok") {
+		return exitError
+	}
+	return exitOK
+}
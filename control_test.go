@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlCommands(t *testing.T) {
+	s, _ := testSession(t, testOptions(t), &fakeServer{})
+	jr := &jobRun{session: s, ctx: s.ctx, xfer: s.base, o: s.o}
+	s.live.beginJob("http://pages.example/book/{num}.png", "book", s.o.interval)
+
+	if r := s.control("skip-current"); !strings.HasPrefix(r, "error:") {
+		t.Errorf("skip-current with no page: %q", r)
+	}
+	if r := s.control("set-interval 20"); r != "ok interval 20s" || jr.interval() != 20*time.Second {
+		t.Errorf("set-interval: %q, interval %v", r, jr.interval())
+	}
+	if r := s.control("set-interval -3"); !strings.HasPrefix(r, "error:") {
+		t.Errorf("negative interval: %q", r)
+	}
+	if s.control("set-interval default"); jr.interval() != 6*time.Second {
+		t.Errorf("default interval: %v", jr.interval())
+	}
+
+	ctx, end := s.live.beginPage(context.Background(), "07")
+	defer end()
+	if r := s.control("skip-current"); r != "ok skipped 07" || ctx.Err() == nil {
+		t.Errorf("skip-current: %q, page context %v", r, ctx.Err())
+	}
+	s.control("pause")
+	if r := s.control("status"); !strings.Contains(r, "page=07") || !strings.Contains(r, "paused=true") {
+		t.Errorf("status: %q", r)
+	}
+	if r := s.control("fly"); !strings.HasPrefix(r, "error:") {
+		t.Errorf("unknown command: %q", r)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	_ "golang.org/x/image/webp"
+)
+
+// -convert re-encodes each saved page as PNG, JPEG or WebP for readers that
+// only take some of them. Everything is pure Go: the standard library reads
+// PNG, JPEG and GIF, x/image reads WebP (lossy and lossless), and WebP is
+// written lossless by nativewebp. AVIF pages are kept as they came.
+
+// parseConvert checks a -convert value and returns the extension it saves
+// under ("" = off).
+func parseConvert(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", "off":
+		return "", nil
+	case "png":
+		return "png", nil
+	case "jpg", "jpeg":
+		return "jpg", nil
+	case "webp":
+		return "webp", nil
+	}
+	return "", fmt.Errorf("-convert: unknown format %q (png, jpg or webp)", s)
+}
+
+// convertSaved re-encodes the page dres saved. The converted file replaces
+// it under the new extension; a page that cannot be decoded is kept.
+func (jr *jobRun) convertSaved(dres dlResult, fileNow string) dlResult {
+	if dres.File != "" {
+		fileNow = dres.File
+	}
+	out, rewritten, err := convertImage(fileNow, jr.o.convert, jr.o.jpegQuality)
+	if err != nil {
+		fmt.Printf("[WARN] convert %s: %v; kept as is\n", filepath.Base(fileNow), err)
+		return dres
+	}
+	if !rewritten {
+		return dres
+	}
+	fmt.Fprintf(logAt(jr.o.verbosity, lvlVerbose), "[conv] %s -> %s\n", filepath.Base(fileNow), filepath.Base(out))
+	dres.File = out
+	// the manifest records what is on disk now, and what came apart
+	if fi, err := os.Stat(out); err == nil {
+		if dres.Remote == 0 {
+			dres.Remote = dres.Size
+		}
+		dres.Size = fi.Size()
+	}
+	if dres.SHA256 != "" {
+		dres.SHA256, dres.CRC32, _ = hashFile(out, jr.o.save.crc32)
+	}
+	return dres
+}
+
+// convertImage writes file as format next to it, removes the original and
+// returns the new name and true. A file already in that format is left
+// alone (false).
+func convertImage(file, format string, quality int) (string, bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false, err
+	}
+	img, from, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return "", false, err
+	}
+	if from == "jpeg" {
+		from = "jpg"
+	}
+	out := strings.TrimSuffix(file, filepath.Ext(file)) + "." + format
+	if from == format && out == file {
+		return file, false, nil
+	}
+	tmp := out + ".part"
+	w, err := os.Create(tmp)
+	if err != nil {
+		return "", false, err
+	}
+	switch format {
+	case "png":
+		err = png.Encode(w, img)
+	case "jpg":
+		err = jpeg.Encode(w, flatten(img), &jpeg.Options{Quality: quality})
+	case "webp":
+		err = nativewebp.Encode(w, img, nil)
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, out)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", false, err
+	}
+	if out != file {
+		os.Remove(file)
+	}
+	return out, true, nil
+}
+
+// flatten puts img on white, since JPEG has no transparency and would show
+// it black.
+func flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+func TestConvertPNGToJPEG(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "0001.png")
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4)) // fully transparent
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, img)
+	f.Close()
+
+	out, _, err := convertImage(src, "jpg", 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != filepath.Join(dir, "0001.jpg") {
+		t.Errorf("converted to %s", out)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("original still there: %v", err)
+	}
+	f, err = os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := jpeg.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// transparency turns white, not black
+	if r, g, b, _ := got.At(1, 1).RGBA(); r < 0xf000 || g < 0xf000 || b < 0xf000 {
+		t.Errorf("pixel = %v", got.At(1, 1))
+	}
+}
+
+func TestConvertKeepsWhatItCannotRead(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "0001.avif")
+	os.WriteFile(file, []byte("\x00\x00\x00\x1cftypavif"), 0o644)
+	if _, _, err := convertImage(file, "png", 90); err == nil {
+		t.Error("no error for a format without a decoder")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("original gone: %v", err)
+	}
+}
+
+func TestConvertSameFormatIsLeftAlone(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "0001.png")
+	f, _ := os.Create(file)
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.White)
+	png.Encode(f, img)
+	f.Close()
+	before, _ := os.ReadFile(file)
+	out, rewritten, err := convertImage(file, "png", 90)
+	if err != nil || out != file || rewritten {
+		t.Fatalf("convertImage = %s, %v, %v", out, rewritten, err)
+	}
+	if after, _ := os.ReadFile(file); string(after) != string(before) {
+		t.Error("file rewritten")
+	}
+}
+
+func TestParseConvert(t *testing.T) {
+	for in, want := range map[string]string{"": "", "png": "png", "JPEG": "jpg", "jpg": "jpg", "webp": "webp"} {
+		if got, err := parseConvert(in); err != nil || got != want {
+			t.Errorf("parseConvert(%q) = %q, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"avif", "tiff"} {
+		if _, err := parseConvert(in); err == nil {
+			t.Errorf("parseConvert(%q) accepted", in)
+		}
+	}
+}
+
+func TestConvertedPagesMatchTheManifest(t *testing.T) {
+	var jpg, pngBytes bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	img.Set(1, 1, color.RGBA{200, 10, 10, 255})
+	jpeg.Encode(&jpg, img, nil)
+	png.Encode(&pngBytes, img)
+
+	for _, tc := range []struct {
+		format, body, saved string
+	}{
+		{"png", jpg.String(), "01.png"},      // a JPEG behind a .png URL, rewritten in place
+		{"jpg", pngBytes.String(), "01.jpg"}, // a PNG, saved under a new extension
+	} {
+		srv := &fakeServer{replies: map[string][]reply{
+			"http://pages.example/book/01.png": {{status: 200, body: tc.body}},
+		}}
+		o := testOptions(t)
+		o.convert = tc.format
+		s, _ := testSession(t, o, srv)
+		j := testJob(t, "01", "01")
+		if _, err := s.runJob(j); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(j.Out, tc.saved)); err != nil {
+			t.Fatalf("-convert %s: %v", tc.format, err)
+		}
+		_, problems, err := verifyManifest(j.Out)
+		if err != nil || len(problems) > 0 {
+			t.Errorf("-convert %s: verify = %v, %v", tc.format, problems, err)
+		}
+	}
+}
+
+func TestConvertWebP(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 6, 6))
+	img.Set(2, 3, color.NRGBA{10, 200, 30, 255})
+	var b bytes.Buffer
+	if err := nativewebp.Encode(&b, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "0001.webp")
+	os.WriteFile(src, b.Bytes(), 0o644)
+
+	// a reader that cannot take WebP gets a PNG ...
+	out, rewritten, err := convertImage(src, "png", 90)
+	if err != nil || !rewritten || out != filepath.Join(dir, "0001.png") {
+		t.Fatalf("webp to png = %s, %v, %v", out, rewritten, err)
+	}
+	f, _ := os.Open(out)
+	got, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, _, _ := got.At(2, 3).RGBA(); r>>8 != 10 || g>>8 != 200 {
+		t.Errorf("pixel = %v", got.At(2, 3))
+	}
+
+	// ... and back, losslessly
+	out, _, err = convertImage(out, "webp", 90)
+	if err != nil || out != src {
+		t.Fatalf("png to webp = %s, %v", out, err)
+	}
+	f, _ = os.Open(out)
+	back, format, err := image.Decode(f)
+	f.Close()
+	if err != nil || format != "webp" {
+		t.Fatalf("decode %s: %s, %v", out, format, err)
+	}
+	if r, g, _, _ := back.At(2, 3).RGBA(); r>>8 != 10 || g>>8 != 200 {
+		t.Errorf("pixel after the round trip = %v", back.At(2, 3))
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A 429 or 503 from a host puts the whole host on hold, not just the page
+// that got it: every request to it, from any job, -mirror fallback, HEAD or
+// index fetch, waits out the cooldown. The hold is written to the session
+// folder as well, so other qxdl runs on the host (shards, a second job
+// started by cron) back off with this one.
+
+const cooldownFile = "cooldowns.json"
+
+// retryAfter is how much of a server's Retry-After d is waited, and whether
+// the job should stop instead because d is past -max-retry-after.
+func (o options) retryAfter(d time.Duration) (time.Duration, bool) {
+	limit := time.Duration(o.maxWait) * time.Second
+	if o.maxRetryAfter >= 0 {
+		limit = time.Duration(o.maxRetryAfter) * time.Second
+	}
+	if d <= limit || o.retryAfterPolicy == "honor" {
+		return d, false
+	}
+	return limit, o.retryAfterPolicy == "abort"
+}
+
+// coolDown starts the host's cooldown if res is a 429 or 503: the
+// Retry-After as -retry-after-policy allows, or one backoff step of the
+// interval capped by -max-wait.
+func (jr *jobRun) coolDown(host string, res dlResult) {
+	if res.Err != nil || res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+	jr.throttled++
+	var d time.Duration
+	if res.RetryAfter > 0 {
+		d, _ = jr.o.retryAfter(res.RetryAfter)
+		d = d.Truncate(time.Second)
+	} else {
+		d = time.Duration(float64(jr.interval()) * jr.o.backoff)
+		d = time.Duration(min(int(d/time.Second), jr.o.maxWait)) * time.Second
+	}
+	if d <= 0 {
+		return
+	}
+	if until, ok := jr.pace.cooldown(host, d); ok {
+		jr.lastCooldown, jr.lastCooledAt = d, jr.pace.clock.Now()
+		fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[cool] %s answered %d; no request to it before %s\n",
+			host, res.StatusCode, until.Format("15:04:05"))
+	}
+}
+
+// cooldown puts host on hold for d. It reports the end of the hold and
+// whether it was extended, which it is not when an earlier one lasts longer.
+func (p *pacer) cooldown(host string, d time.Duration) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	until := p.clock.Now().Add(d)
+	if !until.After(p.cooledUntil(host)) {
+		return p.cool[host], false
+	}
+	p.cool[host] = until
+	if p.dir != "" {
+		if err := shareCooldown(p.dir, host, until); err != nil {
+			fmt.Println("[WARN] share cooldown:", err)
+		}
+	}
+	return until, true
+}
+
+// cooledUntil is the end of host's cooldown, this run's or another's. The
+// caller holds p.mu.
+func (p *pacer) cooledUntil(host string) time.Time {
+	if p.dir != "" {
+		if t := readCooldowns(p.dir)[host]; t.After(p.cool[host]) {
+			p.cool[host] = t
+		}
+	}
+	return p.cool[host]
+}
+
+func readCooldowns(dir string) map[string]time.Time {
+	cd := map[string]time.Time{}
+	if b, err := os.ReadFile(filepath.Join(dir, cooldownFile)); err == nil {
+		json.Unmarshal(b, &cd) // a torn or stale file only costs a cooldown
+	}
+	return cd
+}
+
+// shareCooldown records host's hold in the session folder, dropping the
+// holds that have ended. Two runs writing at once may lose one entry; each
+// still keeps its own.
+func shareCooldown(dir, host string, until time.Time) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	cd := readCooldowns(dir)
+	for h, t := range cd {
+		if time.Now().After(t) {
+			delete(cd, h)
+		}
+	}
+	cd[host] = until
+	b, err := json.MarshalIndent(cd, "", "  ")
+	if err != nil {
+		return err
+	}
+	// a temp file of our own, as another run may be writing its .part too
+	f, err := os.CreateTemp(dir, cooldownFile+".*.part")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(dir, cooldownFile))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
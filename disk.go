@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// -on-low-disk actions.
+const (
+	diskPause = "pause"
+	diskAbort = "abort"
+)
+
+func parseDiskAction(v string) error {
+	switch v {
+	case diskPause, diskAbort:
+		return nil
+	}
+	return fmt.Errorf("on-low-disk must be pause or abort (got %q)", v)
+}
+
+// checkDisk runs before each page. It wants -min-free-mb plus one typical
+// page free in folder, and warns once per job when the rest of the range
+// (left pages, 0 = unknown) will likely not fit. It returns false if the run
+// should stop.
+func (jr *jobRun) checkDisk(folder string, left int) bool {
+	o := jr.o
+	if o.minFreeMB <= 0 {
+		return true
+	}
+	reserve := int64(o.minFreeMB) << 20
+	var typical int64
+	if len(jr.sizes.sizes) > 0 {
+		typical = jr.sizes.median()
+	}
+	for {
+		free := freeBytes(folder)
+		if free < 0 {
+			return true
+		}
+		if !jr.diskWarned && typical > 0 && left > 0 && free < reserve+typical*int64(left) {
+			jr.diskWarned = true
+			fmt.Printf("[WARN] %d more page(s) need about %s, but only %s is free in %s\n",
+				left, humanBytes(typical*int64(left)), humanBytes(free), folder)
+		}
+		if free >= reserve+typical {
+			return true
+		}
+		msg := fmt.Sprintf("[disk] only %s free in %s, below -min-free-mb %d", humanBytes(free), folder, o.minFreeMB)
+		if o.onLowDisk == diskAbort {
+			fmt.Println(msg + "; stopping")
+			return false
+		}
+		if !jr.pause(msg) {
+			return false
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+// freeBytes is not available here; -1 disables the free space check.
+func freeBytes(dir string) int64 {
+	return -1
+}
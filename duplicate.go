@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// -on-duplicate actions. A page byte-identical to the one before it usually
+// means the host serves a "page unavailable" placeholder for the whole range.
+const (
+	dupWarn = "warn"
+	dupSkip = "skip"
+)
+
+func parseDupAction(v string) error {
+	switch v {
+	case "", "off", dupWarn, dupSkip:
+		return nil
+	}
+	return fmt.Errorf("on-duplicate must be off, warn or skip (got %q)", v)
+}
+
+// duplicate compares the hash of a page that was just saved with the
+// previous one's; sum is the hash taken during the download, if any. Under -on-duplicate skip the copy is deleted and duplicate
+// reports true, so the caller records the page as missing.
+func (jr *jobRun) duplicate(fileNow, sum string) bool {
+	if jr.o.onDuplicate == "" || jr.o.onDuplicate == "off" {
+		return false
+	}
+	if sum == "" {
+		var err error
+		if sum, err = fileSHA256(fileNow); err != nil {
+			return false
+		}
+	}
+	prev, prevFile := jr.lastSum, jr.lastFile
+	jr.lastSum, jr.lastFile = sum, fileNow
+	if sum != prev {
+		return false
+	}
+	fmt.Printf("[dup ] %s is byte-identical to %s; the host may be serving a placeholder\n",
+		filepath.Base(fileNow), filepath.Base(prevFile))
+	if jr.o.onDuplicate != dupSkip {
+		return false
+	}
+	os.Remove(fileNow)
+	jr.lastFile = prevFile
+	return true
+}
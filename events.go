@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The state JSON is a snapshot; the source of truth is an append-only event
+// log next to it. Every page outcome is one line, so a crash loses at most
+// the line being written, status tools can read while a run is writing, and
+// any past run can be rebuilt exactly from its events.
+
+const (
+	evRunStart = "run-start"
+	evPage     = "page"
+	evRunEnd   = "run-end"
+
+	// compactEvery is how many page events pass between snapshot rewrites.
+	compactEvery = 25
+)
+
+type event struct {
+	Time time.Time  `json:"t"`
+	Run  string     `json:"run"`
+	Type string     `json:"type"`
+	Page *pageState `json:"page,omitempty"`
+	Meta *runMeta   `json:"meta,omitempty"` // run-start/run-end: range and shard
+}
+
+func newRunID() string {
+	return fmt.Sprintf("%s-%04x", time.Now().Format("20060102T150405"), rand.Intn(0x10000))
+}
+
+func eventFileName(k, n int) string {
+	return strings.TrimSuffix(stateFileName(k, n), ".json") + ".events.jsonl"
+}
+
+// eventLog appends events to a folder's log.
+type eventLog struct {
+	f    *os.File
+	name string
+}
+
+func openEventLog(folder string, k, n int) (*eventLog, error) {
+	name := filepath.Join(folder, eventFileName(k, n))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{f: f, name: name}, nil
+}
+
+func (l *eventLog) append(ev event) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	// one write per line keeps lines whole for concurrent readers
+	_, err = l.f.Write(append(b, '\n'))
+	return err
+}
+
+func (l *eventLog) Close() error {
+	return l.f.Close()
+}
+
+// readEvents parses a log, skipping a torn last line from a crash.
+func readEvents(name string) ([]event, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var evs []event
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var ev event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			continue
+		}
+		evs = append(evs, ev)
+	}
+	return evs, sc.Err()
+}
+
+// replayRuns rebuilds the state of every run in the log, oldest first.
+func replayRuns(evs []event) []*runState {
+	var runs []*runState
+	byID := map[string]*runState{}
+	for _, ev := range evs {
+		st := byID[ev.Run]
+		if st == nil {
+			st = &runState{ID: ev.Run, Started: ev.Time}
+			byID[ev.Run] = st
+			runs = append(runs, st)
+		}
+		switch ev.Type {
+		case evRunStart:
+			if ev.Meta != nil {
+				st.runMeta = *ev.Meta
+			}
+			st.Started = ev.Time
+		case evPage:
+			if ev.Page != nil {
+				st.Pages = append(st.Pages, *ev.Page)
+			}
+		case evRunEnd:
+			if ev.Meta != nil {
+				st.End = ev.Meta.End
+			}
+			st.Finished = ev.Time
+		}
+	}
+	return runs
+}
+
+// trimEventLog rewrites the log keeping only the last keep runs. It must not
+// run while another process appends to the same log.
+func trimEventLog(name string, keep int) error {
+	evs, err := readEvents(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	runs := replayRuns(evs)
+	if len(runs) <= keep {
+		return nil
+	}
+	kept := map[string]bool{}
+	for _, st := range runs[len(runs)-keep:] {
+		kept[st.ID] = true
+	}
+	var b []byte
+	for _, ev := range evs {
+		if !kept[ev.Run] {
+			continue
+		}
+		line, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	if err := os.WriteFile(name+".part", b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(name+".part", name)
+}
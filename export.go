@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportPage describes one saved page for metadata exporters.
+type exportPage struct {
+	File string // path on disk
+	URL  string // source URL
+	Num  int    // page number as used in the filename
+}
+
+var exportKinds = []string{"xmp", "hydrus", "nomedia", "sha256"}
+
+// parseExports validates a comma separated -export value.
+func parseExports(v string) ([]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+	var kinds []string
+	for _, k := range strings.Split(v, ",") {
+		k = strings.TrimSpace(strings.ToLower(k))
+		if k == "" {
+			continue
+		}
+		known := false
+		for _, e := range exportKinds {
+			if k == e {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown export %q (want %s)", k, strings.Join(exportKinds, ","))
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
+
+// runExports writes the requested metadata for pages saved in folder.
+func runExports(kinds []string, folder, series string, pages []exportPage) error {
+	for _, k := range kinds {
+		var err error
+		switch k {
+		case "xmp":
+			for _, p := range pages {
+				if err = writeXMP(p, series); err != nil {
+					break
+				}
+			}
+		case "hydrus":
+			for _, p := range pages {
+				if err = writeHydrus(p, series); err != nil {
+					break
+				}
+			}
+		case "nomedia":
+			err = os.WriteFile(filepath.Join(folder, ".nomedia"), nil, 0o644)
+		case "sha256":
+			err = writeSHA256Sums(folder, pages)
+		}
+		if err != nil {
+			return fmt.Errorf("export %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// writeXMP writes a file.ext.xmp sidecar carrying source URL and page number.
+func writeXMP(p exportPage, series string) error {
+	source := ""
+	if p.URL != "" {
+		source = "\n   <dc:source>" + xmlEscape(p.URL) + "</dc:source>"
+	}
+	doc := fmt.Sprintf(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/">%s
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">%s p.%d</rdf:li></rdf:Alt></dc:title>
+   <dc:subject><rdf:Bag><rdf:li>series:%s</rdf:li><rdf:li>page:%d</rdf:li></rdf:Bag></dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`, source, xmlEscape(series), p.Num, xmlEscape(series), p.Num)
+	return os.WriteFile(p.File+".xmp", []byte(doc), 0o644)
+}
+
+// writeHydrus writes file.ext.tags.txt and file.ext.urls.txt, one entry per
+// line, for a Hydrus import folder sidecar router.
+func writeHydrus(p exportPage, series string) error {
+	tags := fmt.Sprintf("series:%s\npage:%d\n", series, p.Num)
+	if err := os.WriteFile(p.File+".tags.txt", []byte(tags), 0o644); err != nil {
+		return err
+	}
+	if p.URL == "" {
+		return nil
+	}
+	return os.WriteFile(p.File+".urls.txt", []byte(p.URL+"\n"), 0o644)
+}
+
+// writeSHA256Sums writes a sha256sum compatible SHA256SUMS file in page order.
+func writeSHA256Sums(folder string, pages []exportPage) error {
+	var b strings.Builder
+	for _, p := range pages {
+		sum, err := fileSHA256(p.File)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s  %s\n", sum, filepath.Base(p.File))
+	}
+	return os.WriteFile(filepath.Join(folder, "SHA256SUMS"), []byte(b.String()), 0o644)
+}
+
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extByType maps common media types to the extension people expect, since
+// mime.ExtensionsByType happily answers ".jfif" for JPEG.
+var extByType = map[string]string{
+	"image/jpeg":      "jpg",
+	"image/png":       "png",
+	"image/gif":       "gif",
+	"image/webp":      "webp",
+	"image/avif":      "avif",
+	"image/bmp":       "bmp",
+	"image/tiff":      "tif",
+	"image/svg+xml":   "svg",
+	"application/pdf": "pdf",
+	"application/zip": "zip",
+}
+
+// detectExt picks a file extension from the Content-Type header, falling back
+// to sniffing the first bytes of the body when the header is missing or generic.
+func detectExt(contentType string, head []byte) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil && !genericType(mt) {
+		if e := extForType(mt); e != "" {
+			return e
+		}
+	}
+	mt, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if e := extForType(mt); e != "" {
+		return e
+	}
+	return "bin"
+}
+
+func genericType(mt string) bool {
+	return mt == "" || mt == "application/octet-stream" || mt == "binary/octet-stream" || strings.HasPrefix(mt, "text/plain")
+}
+
+func extForType(mt string) string {
+	if e, ok := extByType[mt]; ok {
+		return e
+	}
+	if genericType(mt) {
+		return ""
+	}
+	if exts, err := mime.ExtensionsByType(mt); err == nil && len(exts) > 0 {
+		return strings.TrimPrefix(exts[0], ".")
+	}
+	return ""
+}
+
+// findExisting returns a saved file for stem with any single extension,
+// ignoring partial downloads and sidecars such as 0001.png.xmp.
+func findExisting(stem string) (string, bool) {
+	dir, base := filepath.Split(stem)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, e := range entries {
+		rest, ok := strings.CutPrefix(e.Name(), base+".")
+		if !ok || rest == "" || rest == "part" || strings.Contains(rest, ".") || !e.Type().IsRegular() {
+			continue
+		}
+		return filepath.Join(dir, e.Name()), true
+	}
+	return "", false
+}
+
+// altFile finds file, named with extension ext, saved under one of the
+// alternative extensions instead (0042.jpg for 0042.png), so a folder of
+// mixed formats is not fetched again after -ext changes.
+func altFile(file, ext string, alts []string) (string, bool) {
+	stem, ok := strings.CutSuffix(file, "."+ext)
+	if !ok {
+		return "", false // a -name template that does not end in {ext}
+	}
+	for _, a := range alts {
+		if strings.EqualFold(a, ext) {
+			continue
+		}
+		if fi, err := os.Stat(stem + "." + a); err == nil && fi.Mode().IsRegular() {
+			return stem + "." + a, true
+		}
+	}
+	return "", false
+}
+
+// parseAltExts parses -alt-ext; "" or none turns it off.
+func parseAltExts(v string) []string {
+	var exts []string
+	for _, e := range strings.Split(v, ",") {
+		e = strings.TrimPrefix(strings.TrimSpace(e), ".")
+		if e != "" && e != "none" {
+			exts = append(exts, e)
+		}
+	}
+	return exts
+}
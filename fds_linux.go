@@ -0,0 +1,12 @@
+package main
+
+import "os"
+
+// openFDs counts this process's open file descriptors.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
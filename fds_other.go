@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// openFDs is not available here; -1 disables the descriptor limit.
+func openFDs() int {
+	return -1
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// -from-feed: an RSS or Atom feed whose entries carry the media, as
+// enclosures, media:content or images in the entry's HTML. Each run fetches
+// the feed, lists the media not downloaded before (oldest entry first) and
+// numbers them on from where the last run stopped, so with -watch qxdl
+// becomes a polite feed media fetcher.
+
+const feedStateFile = ".qxdl-feed.json"
+
+// feedDoc reads RSS 2.0 (channel>item), RSS 1.0 (item under the root) and
+// Atom (entry) alike.
+type feedDoc struct {
+	Channel []feedEntry `xml:"channel>item"`
+	Items   []feedEntry `xml:"item"`
+	Entries []feedEntry `xml:"entry"`
+}
+
+type feedEntry struct {
+	// media: comes first so the plain "content" below keeps to Atom's
+	Media      []feedMedia `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaGroup []feedMedia `xml:"http://search.yahoo.com/mrss/ group>content"`
+	Enclosures []feedMedia `xml:"enclosure"`
+	Links      []feedLink  `xml:"link"`
+	Encoded    string      `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Content    string      `xml:"content"`
+	Desc       string      `xml:"description"`
+	Summary    string      `xml:"summary"`
+}
+
+type feedMedia struct {
+	URL string `xml:"url,attr"`
+}
+
+type feedLink struct {
+	Href string `xml:"href,attr"` // Atom
+	Rel  string `xml:"rel,attr"`
+	Text string `xml:",chardata"` // RSS
+}
+
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true}
+
+// media lists what one entry links to: its enclosures and media:content,
+// or failing those the images in its HTML and an image-file link.
+func (e feedEntry) media() []string {
+	var urls []string
+	for _, m := range append(append(e.Enclosures, e.Media...), e.MediaGroup...) {
+		urls = append(urls, m.URL)
+	}
+	for _, l := range e.Links {
+		if l.Rel == "enclosure" {
+			urls = append(urls, l.Href)
+		}
+	}
+	if len(urls) > 0 {
+		return urls
+	}
+	for _, doc := range []string{e.Encoded, e.Content, e.Desc, e.Summary} {
+		scanTags(doc, func(_ []element, el element) {
+			if el.tag == "img" {
+				urls = append(urls, elementURL(el))
+			}
+		})
+	}
+	for _, l := range e.Links {
+		link := strings.TrimSpace(l.Href + l.Text)
+		if u, err := url.Parse(link); err == nil && imageExts[strings.ToLower(path.Ext(u.Path))] {
+			urls = append(urls, link)
+		}
+	}
+	return urls
+}
+
+// parseFeed returns the media URLs of a feed, oldest entry first (feeds
+// list the newest first), resolved against base and without repeats.
+func parseFeed(b []byte, base *url.URL) ([]string, error) {
+	var doc feedDoc
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("feed: %w", err)
+	}
+	entries := append(append(doc.Channel, doc.Items...), doc.Entries...)
+	if len(entries) == 0 {
+		return nil, errors.New("feed: no items or entries; is it RSS or Atom?")
+	}
+	seen := map[string]bool{}
+	var urls []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		for _, m := range entries[i].media() {
+			u, err := base.Parse(strings.TrimSpace(m))
+			if m == "" || err != nil || !isSourceURL(u.String()) || seen[u.String()] {
+				continue
+			}
+			seen[u.String()] = true
+			urls = append(urls, u.String())
+		}
+	}
+	return urls, nil
+}
+
+// feedState remembers, in the folder, which media a feed's earlier runs
+// fetched and the number the next new one gets.
+type feedState struct {
+	Feed string         `json:"feed"`
+	Next int            `json:"next"`
+	Done map[string]int `json:"done"` // media URL -> page number
+
+	name string
+}
+
+func loadFeedState(folder, feed string, start int) (*feedState, error) {
+	st := &feedState{Feed: feed, Next: start, Done: map[string]int{}, name: filepath.Join(folder, feedStateFile)}
+	b, err := os.ReadFile(st.name)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.name, err)
+	}
+	if st.Done == nil {
+		st.Done = map[string]int{}
+	}
+	return st, nil
+}
+
+// done marks a media URL fetched (or gone for good) as page num.
+func (st *feedState) done(u string, num int) {
+	st.Done[u] = num
+	st.Next = max(st.Next, num+1)
+}
+
+func (st *feedState) save() error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(st.name+".part", b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(st.name+".part", st.name)
+}
+
+// feedURLSource fetches the feed and lists its media not fetched before as
+// a urlSource; the pages are numbered from the returned start.
+func (jr *jobRun) feedURLSource(feedURL, folder string, start int) (*urlSource, int, error) {
+	st, err := loadFeedState(folder, feedURL, start)
+	if err != nil {
+		return nil, 0, err
+	}
+	host := jr.host
+	if u, err := url.Parse(feedURL); err == nil {
+		host = u.Host
+	}
+	jr.pace.before(jr.ctx, host, "GET", jr.getGap())
+	fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[feed] %s\n", feedURL)
+	doc, base, err := fetchIndexPage(jr.ctx, jr.client, feedURL, jr.o.ua, "application/rss+xml,application/atom+xml,application/xml;q=0.9", jr.timeout())
+	if err != nil {
+		return nil, 0, fmt.Errorf("from-feed: %w", err)
+	}
+	all, err := parseFeed([]byte(doc), base)
+	if err != nil {
+		return nil, 0, err
+	}
+	var fresh []string
+	for _, u := range all {
+		if _, ok := st.Done[u]; !ok {
+			fresh = append(fresh, u)
+		}
+	}
+	fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[list] %d new of %d media URL(s) in the feed\n", len(fresh), len(all))
+	jr.feed = st
+	return &urlSource{name: "-from-feed", lines: fresh, done: true}, st.Next, nil
+}
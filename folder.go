@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localPage is a page file found in a download folder.
+type localPage struct {
+	File   string
+	Prefix string // anything before the page number, e.g. "series_"
+	Num    int
+	Pad    int    // digits used in the filename
+	Ext    string // without dot
+	Size   int64
+}
+
+// sidecarExts are files qxdl writes next to pages that are not pages.
+var sidecarExts = map[string]bool{"part": true, "xmp": true, "txt": true, "json": true, "jsonl": true}
+
+// scanFolder lists numbered page files (e.g. 0064.png or series_0064.png) in
+// dir in page order. Sidecars, partial files and names that do not end in
+// <digits>.<ext> are ignored.
+func scanFolder(dir string) ([]localPage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var pages []localPage
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		dot := strings.LastIndexByte(e.Name(), '.')
+		if dot <= 0 {
+			continue
+		}
+		stem, ext := e.Name()[:dot], e.Name()[dot+1:]
+		if ext == "" || sidecarExts[strings.ToLower(ext)] {
+			continue
+		}
+		d := len(stem)
+		for d > 0 && stem[d-1] >= '0' && stem[d-1] <= '9' {
+			d--
+		}
+		digits := stem[d:]
+		if digits == "" {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, localPage{
+			File:   filepath.Join(dir, e.Name()),
+			Prefix: stem[:d],
+			Num:    toDec(digits),
+			Pad:    len(digits),
+			Ext:    ext,
+			Size:   fi.Size(),
+		})
+	}
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Num < pages[j].Num })
+	return pages, nil
+}
+
+// sourceURL recovers the URL a page was fetched from using the sidecars the
+// exporters write, so offline tools keep provenance without URL flags.
+func sourceURL(file string) string {
+	if b, err := os.ReadFile(file + ".urls.txt"); err == nil {
+		if line, _, _ := strings.Cut(string(b), "\n"); strings.TrimSpace(line) != "" {
+			return strings.TrimSpace(line)
+		}
+	}
+	if b, err := os.ReadFile(file + ".xmp"); err == nil {
+		s := string(b)
+		if i := strings.Index(s, "<dc:source>"); i >= 0 {
+			s = s[i+len("<dc:source>"):]
+			if j := strings.Index(s, "</dc:source>"); j >= 0 {
+				return xmlUnescape(s[:j])
+			}
+		}
+	}
+	return ""
+}
+
+func xmlUnescape(s string) string {
+	return strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&#34;", `"`, "&#39;", "'", "&quot;", `"`, "&apos;", "'").Replace(s)
+}
+
+func exportPages(pages []localPage) []exportPage {
+	out := make([]exportPage, 0, len(pages))
+	for _, p := range pages {
+		out = append(out, exportPage{File: p.File, URL: sourceURL(p.File), Num: p.Num})
+	}
+	return out
+}
+
+// seriesName is the name exporters and packers use for a folder.
+func seriesName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Base(dir)
+	}
+	return filepath.Base(abs)
+}
+
+func itoaPad(n, pad int) string {
+	s := strconv.Itoa(n)
+	for len(s) < pad {
+		s = "0" + s
+	}
+	return s
+}
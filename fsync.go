@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"runtime"
+)
+
+// syncDir flushes a directory's entries, so a rename into it survives a
+// power loss. Windows has no such call; NTFS journals the rename itself.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Some archives only serve their scans over FTP or SFTP. Rather than a
+// second download engine, ftp:// and sftp:// are registered as protocols on
+// the HTTP transport, so numbering, pacing, retries and -ext auto work
+// unchanged: a reply is turned into the HTTP status the engine already
+// knows (550 -> 404, 530 -> 401, any 4xx -> 503 so it is retried).
+
+// isSourceURL reports whether qxdl can fetch pages from u.
+func isSourceURL(u string) bool {
+	for _, p := range []string{"http://", "https://", "ftp://", "sftp://"} {
+		if strings.HasPrefix(strings.ToLower(u), p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ftpLogin is the account for u: its userinfo, else QXDL_FTP_USER and
+// QXDL_FTP_PASSWORD, else anonymous.
+func ftpLogin(u *url.URL) (user, pass string) {
+	user, pass = os.Getenv("QXDL_FTP_USER"), os.Getenv("QXDL_FTP_PASSWORD")
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+	if user == "" {
+		user, pass = "anonymous", "anonymous@"
+	}
+	return user, pass
+}
+
+// ftpTransport fetches ftp:// URLs, one login per request: a polite run
+// asks for a page every few seconds, far apart enough that a kept-open
+// control connection would mostly be timed out by the server anyway.
+type ftpTransport struct {
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func (t *ftpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, fmt.Errorf("ftp: %s not supported", req.Method)
+	}
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "21")
+	}
+	ctx := req.Context()
+	conn, err := t.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// the client's timeout, Ctrl-C and a canceled job cancel the context
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	c := textproto.NewConn(conn)
+	done := func() {
+		stop()
+		ftpCmd(c, 2, "QUIT")
+		c.Close()
+	}
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	resp, body, err := t.fetch(ctx, c, req, host)
+	if err != nil || body == nil {
+		done()
+		return resp, err
+	}
+	resp.Body = &ftpBody{ReadCloser: body, c: c, done: done}
+	return resp, nil
+}
+
+// fetch logs in and asks for the file. It returns the data connection for a
+// GET answered 150, or a complete response otherwise.
+func (t *ftpTransport) fetch(ctx context.Context, c *textproto.Conn, req *http.Request, host string) (*http.Response, io.ReadCloser, error) {
+	if _, _, err := c.ReadResponse(220); err != nil {
+		return ftpReply(req, err)
+	}
+	user, pass := ftpLogin(req.URL)
+	code, _, err := ftpCmd(c, 0, "USER %s", user)
+	if err == nil && code == 331 {
+		code, _, err = ftpCmd(c, 0, "PASS %s", pass)
+	}
+	if err == nil && code/100 != 2 {
+		err = &textproto.Error{Code: code, Msg: "login failed"}
+	}
+	if err != nil {
+		return ftpReply(req, err)
+	}
+	if _, _, err := ftpCmd(c, 2, "TYPE I"); err != nil {
+		return ftpReply(req, err)
+	}
+	file := strings.TrimPrefix(req.URL.Path, "/") // relative to the login directory, as RFC 1738 has it
+	resp := &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Proto: "FTP", Header: http.Header{}, Request: req, ContentLength: -1, Body: http.NoBody}
+	if ct := mime.TypeByExtension(path.Ext(file)); ct != "" {
+		resp.Header.Set("Content-Type", ct)
+	}
+	// SIZE and MDTM are extensions; a server without them still serves RETR
+	_, msg, err := ftpCmd(c, 2, "SIZE %s", file)
+	if n, perr := strconv.ParseInt(msg, 10, 64); err == nil && perr == nil {
+		resp.ContentLength = n
+		resp.Header.Set("Content-Length", msg)
+	} else if ftpCode(err) == 550 {
+		return ftpReply(req, err)
+	}
+	if _, msg, err := ftpCmd(c, 2, "MDTM %s", file); err == nil {
+		if mt, err := time.Parse("20060102150405", msg[:min(len(msg), 14)]); err == nil {
+			resp.Header.Set("Last-Modified", mt.UTC().Format(http.TimeFormat))
+		}
+	}
+	if req.Method == http.MethodHead {
+		return resp, nil, nil
+	}
+	data, err := t.passive(ctx, c, host)
+	if err != nil {
+		return ftpReply(req, err)
+	}
+	id, err := c.Cmd("RETR %s", file)
+	if err == nil {
+		c.StartResponse(id)
+		_, _, err = c.ReadResponse(1)
+		c.EndResponse(id)
+	}
+	if err != nil {
+		data.Close()
+		return ftpReply(req, err)
+	}
+	return resp, data, nil
+}
+
+// passive opens a data connection with EPSV, or PASV for older servers. The
+// address in a PASV reply is ignored in favour of host, the control
+// connection's, which also gets past servers behind NAT that announce a
+// private IP.
+func (t *ftpTransport) passive(ctx context.Context, c *textproto.Conn, host string) (net.Conn, error) {
+	var port int
+	_, msg, err := ftpCmd(c, 2, "EPSV")
+	if err == nil {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		if i := strings.Index(msg, "(|||"); i >= 0 {
+			port, _ = strconv.Atoi(strings.TrimSuffix(msg[i+4:], "|)"))
+		}
+	} else {
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		if _, msg, err = ftpCmd(c, 2, "PASV"); err != nil {
+			return nil, err
+		}
+		i, j := strings.Index(msg, "("), strings.Index(msg, ")")
+		if i >= 0 && j > i {
+			f := strings.Split(msg[i+1:j], ",")
+			if len(f) == 6 {
+				p1, _ := strconv.Atoi(f[4])
+				p2, _ := strconv.Atoi(f[5])
+				port = p1*256 + p2
+			}
+		}
+	}
+	if port <= 0 {
+		return nil, fmt.Errorf("ftp: cannot parse passive reply %q", msg)
+	}
+	return t.dial(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// ftpCmd sends one command and reads its reply; expect is a code prefix as
+// in textproto.Conn.ReadResponse (0 accepts any).
+func ftpCmd(c *textproto.Conn, expect int, format string, args ...any) (int, string, error) {
+	id, err := c.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.StartResponse(id)
+	defer c.EndResponse(id)
+	return c.ReadResponse(expect)
+}
+
+func ftpCode(err error) int {
+	var te *textproto.Error
+	if errors.As(err, &te) {
+		return te.Code
+	}
+	return 0
+}
+
+// ftpReply turns an FTP error reply into the HTTP response the engine acts
+// on; network errors stay errors and are retried as such.
+func ftpReply(req *http.Request, err error) (*http.Response, io.ReadCloser, error) {
+	var te *textproto.Error
+	if !errors.As(err, &te) {
+		return nil, nil, err
+	}
+	status := http.StatusInternalServerError
+	switch {
+	case te.Code == 550:
+		status = http.StatusNotFound
+	case te.Code == 530 || te.Code == 332:
+		status = http.StatusUnauthorized
+	case te.Code/100 == 4:
+		status = http.StatusServiceUnavailable
+	}
+	resp := &http.Response{StatusCode: status, Status: fmt.Sprintf("%d %s", status, te.Msg),
+		Proto: "FTP", Header: http.Header{}, Request: req, Body: http.NoBody}
+	return resp, nil, nil
+}
+
+// ftpBody is a RETR in progress. Closing it waits for the transfer's 226
+// and logs out.
+type ftpBody struct {
+	io.ReadCloser
+	c    *textproto.Conn
+	done func()
+}
+
+func (b *ftpBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.c.ReadResponse(2)
+	b.done()
+	return err
+}
+
+// sftpTransport fetches sftp:// URLs with the system's OpenSSH sftp client
+// in batch mode, so keys, agents, known_hosts and ~/.ssh/config apply as
+// for any other ssh. Password logins need an agent or key; batch mode
+// cannot ask for one.
+type sftpTransport struct{}
+
+func (sftpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, fmt.Errorf("sftp: %s not supported", req.Method)
+	}
+	dest := req.URL.Hostname()
+	user := os.Getenv("QXDL_FTP_USER")
+	if req.URL.User != nil {
+		user = req.URL.User.Username()
+	}
+	if user != "" {
+		dest = user + "@" + dest
+	}
+	args := []string{"-q", "-o", "BatchMode=yes", "-b", "-"}
+	if p := req.URL.Port(); p != "" {
+		args = append(args, "-P", p)
+	}
+	// sftp:// paths are absolute; ~ stays relative to the home directory
+	file := req.URL.Path
+	if strings.HasPrefix(file, "/~/") {
+		file = file[3:]
+	}
+	quoted := `"` + strings.ReplaceAll(file, `"`, `\"`) + `"`
+	resp := &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Proto: "SFTP", Header: http.Header{}, Request: req, ContentLength: -1, Body: http.NoBody}
+	if ct := mime.TypeByExtension(path.Ext(file)); ct != "" {
+		resp.Header.Set("Content-Type", ct)
+	}
+	if req.Method == http.MethodHead {
+		out, err := sftpRun(req, append(args, dest), "ls -ln "+quoted+"\n")
+		if err != nil {
+			return sftpReply(req, err)
+		}
+		// -rw-r--r--  1 1000 1000 48213 Jan  2 10:04 /scans/0001.jpg
+		if f := strings.Fields(out); len(f) >= 5 {
+			if n, err := strconv.ParseInt(f[4], 10, 64); err == nil {
+				resp.ContentLength = n
+				resp.Header.Set("Content-Length", f[4])
+			}
+		}
+		return resp, nil
+	}
+	tmp, err := os.CreateTemp("", "qxdl-sftp-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	if _, err := sftpRun(req, append(args, dest), "get -p "+quoted+` "`+tmp.Name()+`"`+"\n"); err != nil {
+		os.Remove(tmp.Name())
+		return sftpReply(req, err)
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil {
+		resp.ContentLength = fi.Size()
+		resp.Header.Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		resp.Header.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat)) // get -p keeps the server's
+	}
+	resp.Body = &tempBody{f}
+	return resp, nil
+}
+
+// sftpError is a failed sftp batch, with what it printed.
+type sftpError struct {
+	out string
+	err error
+}
+
+func (e *sftpError) Error() string {
+	if e.out != "" {
+		return "sftp: " + e.out
+	}
+	return "sftp: " + e.err.Error()
+}
+
+func sftpRun(req *http.Request, args []string, batch string) (string, error) {
+	cmd := exec.CommandContext(req.Context(), "sftp", args...)
+	cmd.Stdin = strings.NewReader(batch)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", &sftpError{strings.TrimSpace(string(out)), err}
+	}
+	return string(out), nil
+}
+
+// sftpReply maps what the sftp client printed to an HTTP status; anything
+// unrecognised (connection refused, host key trouble) stays an error.
+func sftpReply(req *http.Request, err error) (*http.Response, error) {
+	var se *sftpError
+	if !errors.As(err, &se) {
+		return nil, err
+	}
+	status := 0
+	switch low := strings.ToLower(se.out); {
+	case strings.Contains(low, "not found"), strings.Contains(low, "no such file"):
+		status = http.StatusNotFound
+	case strings.Contains(low, "permission denied"):
+		status = http.StatusForbidden
+	}
+	if status == 0 {
+		return nil, err
+	}
+	return &http.Response{StatusCode: status, Status: fmt.Sprintf("%d %s", status, se.out),
+		Proto: "SFTP", Header: http.Header{}, Request: req, Body: http.NoBody}, nil
+}
+
+// tempBody deletes the downloaded temp file once the body is closed.
+type tempBody struct{ *os.File }
+
+func (b *tempBody) Close() error {
+	err := b.File.Close()
+	os.Remove(b.File.Name())
+	return err
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gcStats is what one gc pass removed or would remove.
+type gcStats struct {
+	Files int
+	Bytes int64
+}
+
+func (g *gcStats) add(size int64) {
+	g.Files++
+	g.Bytes += size
+}
+
+// gcRoot cleans a library root: leftover .part files from interrupted
+// downloads and packs, and event logs grown past keepRuns runs. Anything
+// touched within minAge is left alone, since a running qxdl may still own it.
+func gcRoot(root string, minAge time.Duration, keepRuns int, dryRun, quiet bool) (gcStats, error) {
+	var st gcStats
+	cutoff := time.Now().Add(-minAge)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil || fi.ModTime().After(cutoff) {
+			return err
+		}
+		name := d.Name()
+		switch {
+		case name == lockFile:
+			l := readLock(p)
+			if l == nil || !l.stale() {
+				return nil
+			}
+			if !quiet {
+				fmt.Printf("[gc  ] stale lock %s\n", p)
+			}
+			st.add(fi.Size())
+			if !dryRun {
+				if err := clearStale(p, l); err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, errLocked) {
+					return err
+				}
+			}
+		case strings.HasPrefix(name, lockFile+".") && strings.HasSuffix(name, ".stale"):
+			// moved aside by a takeover that did not get to remove it
+			if !quiet {
+				fmt.Printf("[gc  ] stale lock %s\n", p)
+			}
+			st.add(fi.Size())
+			if !dryRun {
+				return os.Remove(p)
+			}
+		case strings.HasSuffix(name, ".part"):
+			if !quiet {
+				fmt.Printf("[gc  ] %s (%s)\n", p, humanBytes(fi.Size()))
+			}
+			st.add(fi.Size())
+			if !dryRun {
+				return os.Remove(p)
+			}
+		case strings.HasPrefix(name, ".qxdl-state") && strings.HasSuffix(name, ".events.jsonl") && keepRuns > 0:
+			if dryRun {
+				return nil
+			}
+			if err := trimEventLog(p, keepRuns); err != nil {
+				return err
+			}
+			if after, err := os.Stat(p); err == nil && after.Size() < fi.Size() {
+				if !quiet {
+					fmt.Printf("[gc  ] %s trimmed to %d runs (%s)\n", p, keepRuns, humanBytes(fi.Size()-after.Size()))
+				}
+				st.Bytes += fi.Size() - after.Size()
+			}
+		}
+		return nil
+	})
+	return st, err
+}
+
+// gcSessionDir removes a queue lock left behind by a crashed qxdl.
+func gcSessionDir(dir string, minAge time.Duration, dryRun, quiet bool) (gcStats, error) {
+	var st gcStats
+	lock := filepath.Join(dir, queueFile+".lock")
+	fi, err := os.Stat(lock)
+	if err != nil || time.Since(fi.ModTime()) < minAge {
+		return st, nil
+	}
+	if !quiet {
+		fmt.Printf("[gc  ] stale lock %s\n", lock)
+	}
+	st.add(fi.Size())
+	if !dryRun {
+		return st, os.Remove(lock)
+	}
+	return st, nil
+}
+
+func cmdGC(args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	root := fs.String("root", "", "Library root to clean (required)")
+	sessionDir := fs.String("session-dir", defaultSessionDir(), "Session directory to check for stale locks")
+	minAge := fs.Duration("min-age", 24*time.Hour, "Only touch files not modified for this long")
+	keepRuns := fs.Int("keep-runs", 20, "Runs kept in each folder's event log (0 = leave logs alone)")
+	dryRun := fs.Bool("n", false, "Only print what would be removed")
+	quiet := fs.Bool("quiet", false, "Only print the total")
+	fs.Parse(args)
+	if *root == "" {
+		fmt.Println("Usage: qxdl gc -root DIR [-min-age 24h] [-keep-runs 20] [-n]")
+		fs.PrintDefaults()
+		return exitBadArgs
+	}
+
+	st, err := gcRoot(*root, *minAge, *keepRuns, *dryRun, *quiet)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	ls, err := gcSessionDir(*sessionDir, *minAge, *dryRun, *quiet)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	st.Files += ls.Files
+	st.Bytes += ls.Bytes
+	if *dryRun {
+		fmt.Printf("Would remove %d file(s), %s; event logs not checked.\n", st.Files, humanBytes(st.Bytes))
+	} else {
+		fmt.Printf("Removed %d file(s), reclaimed %s.\n", st.Files, humanBytes(st.Bytes))
+	}
+	return exitOK
+}
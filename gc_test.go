@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// gcTree makes a library root with one folder holding a young and an old
+// .part file, a live and a stale lock, and returns the paths.
+func gcTree(t *testing.T) (root, young, old, live, stale string) {
+	t.Helper()
+	root = t.TempDir()
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "b")
+	os.MkdirAll(a, 0o755)
+	os.MkdirAll(b, 0o755)
+	young, old = filepath.Join(a, "0002.png.part"), filepath.Join(a, "0001.png.part")
+	os.WriteFile(young, []byte("young"), 0o644)
+	os.WriteFile(old, []byte("old part"), 0o644)
+
+	host, _ := os.Hostname()
+	live, stale = filepath.Join(a, lockFile), filepath.Join(b, lockFile)
+	lb, _ := json.Marshal(folderLock{PID: os.Getpid(), Host: host})
+	sb, _ := json.Marshal(folderLock{PID: 1 << 30, Host: host}) // far above any pid_max
+	os.WriteFile(live, lb, 0o644)
+	os.WriteFile(stale, sb, 0o644)
+
+	past := time.Now().Add(-48 * time.Hour)
+	for _, p := range []string{old, live, stale} {
+		os.Chtimes(p, past, past)
+	}
+	return root, young, old, live, stale
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func TestGCRemovesOldPartsAndStaleLocks(t *testing.T) {
+	root, young, old, live, stale := gcTree(t)
+	// left by a takeover that stopped halfway
+	aside := stale + ".99.stale"
+	os.WriteFile(aside, []byte("{}"), 0o644)
+	past := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(aside, past, past)
+	st, err := gcRoot(root, 24*time.Hour, 0, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists(young) {
+		t.Error("young .part file was removed")
+	}
+	if exists(old) {
+		t.Error("old .part file was kept")
+	}
+	if !exists(live) {
+		t.Error("live lock was removed")
+	}
+	if exists(stale) {
+		t.Error("stale lock was kept")
+	}
+	if left, _ := filepath.Glob(filepath.Join(filepath.Dir(stale), "*.stale")); len(left) > 0 {
+		t.Errorf("left %v", left)
+	}
+	if st.Files != 3 {
+		t.Errorf("removed %d files, want 3", st.Files)
+	}
+}
+
+func TestGCDryRunRemovesNothing(t *testing.T) {
+	root, young, old, live, stale := gcTree(t)
+	st, err := gcRoot(root, 24*time.Hour, 0, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{young, old, live, stale} {
+		if !exists(p) {
+			t.Errorf("-n removed %s", p)
+		}
+	}
+	if st.Files != 2 || st.Bytes == 0 {
+		t.Errorf("would remove %+v, want 2 files and their bytes", st)
+	}
+}
+
+func TestGCSessionDirStaleQueueLock(t *testing.T) {
+	dir := t.TempDir()
+	lock := filepath.Join(dir, queueFile+".lock")
+	os.WriteFile(lock, []byte("123"), 0o644)
+	if st, _ := gcSessionDir(dir, time.Hour, false, true); st.Files != 0 || !exists(lock) {
+		t.Fatalf("young queue lock removed: %+v", st)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(lock, past, past)
+	st, err := gcSessionDir(dir, time.Hour, false, true)
+	if err != nil || st.Files != 1 || st.Bytes != 3 || exists(lock) {
+		t.Errorf("old queue lock: %+v, %v, still there: %v", st, err, exists(lock))
+	}
+}
+
+func TestTrimEventLogKeepsTheLastRuns(t *testing.T) {
+	name := filepath.Join(t.TempDir(), eventFileName(0, 0))
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := json.NewEncoder(f)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, run := range []string{"r1", "r2", "r3", "r4"} {
+		at := start.Add(time.Duration(i) * time.Hour)
+		enc.Encode(event{Time: at, Run: run, Type: evRunStart})
+		enc.Encode(event{Time: at, Run: run, Type: evPage, Page: &pageState{Num: i + 1, Status: pageOK}})
+		enc.Encode(event{Time: at, Run: run, Type: evRunEnd})
+	}
+	f.Close()
+
+	if err := trimEventLog(name, 2); err != nil {
+		t.Fatal(err)
+	}
+	evs, err := readEvents(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := replayRuns(evs)
+	if len(runs) != 2 || runs[0].ID != "r3" || runs[1].ID != "r4" {
+		t.Fatalf("runs after trim: %d", len(runs))
+	}
+	if len(runs[1].Pages) != 1 || runs[1].Pages[0].Num != 4 {
+		t.Errorf("last run pages = %+v", runs[1].Pages)
+	}
+}
@@ -1,2 +1,18 @@
 module github.com/fafuu/qxdl-gentle
-go 1.22
+
+go 1.22.2
+
+require (
+	github.com/HugoSmits86/nativewebp v1.3.0
+	golang.org/x/image v0.24.0
+	google.golang.org/grpc v1.70.0
+	google.golang.org/protobuf v1.36.6
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.32.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241202173237-19429a94021a // indirect
+)
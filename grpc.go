@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fafuu/qxdl-gentle/qxdlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// qxdl serve -grpc-listen offers the JSON API's queue as the qxdl.v1.Jobs
+// gRPC service (qxdlpb/qxdl.proto), for programs that embed qxdl and would
+// rather use a generated client than HTTP. Like the JSON API it has no
+// authentication and is meant for localhost.
+
+type grpcJobs struct {
+	qxdlpb.UnimplementedJobsServer
+	srv *server
+}
+
+func newGRPCServer(srv *server) *grpc.Server {
+	gs := grpc.NewServer()
+	qxdlpb.RegisterJobsServer(gs, grpcJobs{srv: srv})
+	return gs
+}
+
+func (g grpcJobs) Submit(ctx context.Context, spec *qxdlpb.JobSpec) (*qxdlpb.Job, error) {
+	j, err := jobFromSpec(spec)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	snap, err := g.srv.add(j)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return jobToProto(snap), nil
+}
+
+func (g grpcJobs) List(ctx context.Context, _ *qxdlpb.ListRequest) (*qxdlpb.ListResponse, error) {
+	var out qxdlpb.ListResponse
+	for _, sj := range g.srv.all() {
+		out.Jobs = append(out.Jobs, jobToProto(sj))
+	}
+	return &out, nil
+}
+
+func (g grpcJobs) Get(ctx context.Context, ref *qxdlpb.JobRef) (*qxdlpb.Job, error) {
+	g.srv.mu.Lock()
+	defer g.srv.mu.Unlock()
+	sj := g.srv.byID(int(ref.GetId()))
+	if sj == nil {
+		return nil, status.Error(codes.NotFound, errNoJob.Error())
+	}
+	return jobToProto(g.srv.snapshot(sj)), nil
+}
+
+func (g grpcJobs) Pause(ctx context.Context, ref *qxdlpb.JobRef) (*qxdlpb.Job, error) {
+	return g.act(ref, "pause")
+}
+
+func (g grpcJobs) Resume(ctx context.Context, ref *qxdlpb.JobRef) (*qxdlpb.Job, error) {
+	return g.act(ref, "resume")
+}
+
+func (g grpcJobs) Cancel(ctx context.Context, ref *qxdlpb.JobRef) (*qxdlpb.Job, error) {
+	return g.act(ref, "cancel")
+}
+
+func (g grpcJobs) act(ref *qxdlpb.JobRef, action string) (*qxdlpb.Job, error) {
+	snap, err := g.srv.act(int(ref.GetId()), action)
+	if errors.Is(err, errNoJob) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return jobToProto(snap), nil
+}
+
+func (g grpcJobs) Watch(ref *qxdlpb.JobRef, stream grpc.ServerStreamingServer[qxdlpb.Job]) error {
+	g.srv.mu.Lock()
+	sj := g.srv.byID(int(ref.GetId()))
+	g.srv.mu.Unlock()
+	if sj == nil {
+		return status.Error(codes.NotFound, errNoJob.Error())
+	}
+	err := g.srv.follow(stream.Context(), sj, func(snap serveJob) error {
+		return stream.Send(jobToProto(snap))
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
+
+// jobFromSpec turns a JobSpec into a job, overrides included.
+func jobFromSpec(spec *qxdlpb.JobSpec) (job, error) {
+	j := job{
+		URL: spec.GetUrl(), Start: spec.GetStart(), End: spec.GetEnd(),
+		ChapStart: spec.GetChapStart(), ChapEnd: spec.GetChapEnd(), ChapFolder: spec.GetChapFolder(),
+		Out: spec.GetOut(), URLCmd: spec.GetUrlCmd(),
+		FromPage: spec.GetFromPage(), Selector: spec.GetSelector(), FromFeed: spec.GetFromFeed(),
+		FromJSON: spec.GetFromJson(), JSONPath: spec.GetJsonPath(),
+	}
+	if v := spec.GetOverridesJson(); v != "" {
+		dec := json.NewDecoder(bytes.NewReader([]byte(v)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&j.jobOverrides); err != nil {
+			return job{}, fmt.Errorf("overrides_json: %w", err)
+		}
+	}
+	return j, nil
+}
+
+func jobToProto(sj serveJob) *qxdlpb.Job {
+	j := sj.Job
+	spec := &qxdlpb.JobSpec{
+		Url: j.URL, Start: j.Start, End: j.End,
+		ChapStart: j.ChapStart, ChapEnd: j.ChapEnd, ChapFolder: j.ChapFolder,
+		Out: j.Out, UrlCmd: j.URLCmd,
+		FromPage: j.FromPage, Selector: j.Selector, FromFeed: j.FromFeed,
+		FromJson: j.FromJSON, JsonPath: j.JSONPath,
+	}
+	if b, err := json.Marshal(j.jobOverrides); err == nil && string(b) != "{}" {
+		spec.OverridesJson = string(b)
+	}
+	p := sj.Progress
+	return &qxdlpb.Job{
+		Id:       int32(sj.ID),
+		Spec:     spec,
+		Status:   statusToProto[sj.Status],
+		Added:    timestamp(sj.Added),
+		Started:  timestamp(sj.Started),
+		Finished: timestamp(sj.Finished),
+		Error:    sj.Err,
+		Progress: &qxdlpb.Progress{
+			Current: int32(p.Current), Ok: int32(p.OK), Skipped: int32(p.Skipped),
+			Missing: int32(p.Missing), Failed: int32(p.Failed), Bytes: p.Bytes,
+		},
+	}
+}
+
+var statusToProto = map[string]qxdlpb.JobStatus{
+	jobQueued:   qxdlpb.JobStatus_JOB_STATUS_QUEUED,
+	jobRunning:  qxdlpb.JobStatus_JOB_STATUS_RUNNING,
+	jobPaused:   qxdlpb.JobStatus_JOB_STATUS_PAUSED,
+	jobDone:     qxdlpb.JobStatus_JOB_STATUS_DONE,
+	jobFailed:   qxdlpb.JobStatus_JOB_STATUS_FAILED,
+	jobCanceled: qxdlpb.JobStatus_JOB_STATUS_CANCELED,
+}
+
+// timestamp leaves a zero time unset.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/fafuu/qxdl-gentle/qxdlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func grpcClient(t *testing.T, srv *server) qxdlpb.JobsClient {
+	t.Helper()
+	ln := bufconn.Listen(1 << 16)
+	gs := newGRPCServer(srv)
+	go gs.Serve(ln)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return qxdlpb.NewJobsClient(conn)
+}
+
+func TestGRPCSubmitAndWatch(t *testing.T) {
+	o := testOptions(t)
+	s, _ := testSession(t, o, &fakeServer{})
+	srv := newServer(s)
+	step := make(chan struct{})
+	srv.run = func(j job, ctl *jobControl) (jobResult, error) {
+		<-step
+		ctl.record(pageState{Status: pageOK}, 42)
+		<-step
+		return jobResult{}, nil
+	}
+	c := grpcClient(t, srv)
+	ctx := context.Background()
+
+	sub, err := c.Submit(ctx, &qxdlpb.JobSpec{Url: "http://pages.example/b/001.png", Start: "001", End: "003", Out: "b", OverridesJson: `{"interval": 5}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Status != qxdlpb.JobStatus_JOB_STATUS_QUEUED || sub.Spec.OverridesJson != `{"interval":5}` {
+		t.Fatalf("submitted = %v", sub)
+	}
+	stream, err := c.Watch(ctx, &qxdlpb.JobRef{Id: sub.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(want qxdlpb.JobStatus, ok int32) {
+		t.Helper()
+		j, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.Status != want || j.Progress.Ok != ok {
+			t.Fatalf("event = %v %d, want %v %d", j.Status, j.Progress.Ok, want, ok)
+		}
+	}
+	next(qxdlpb.JobStatus_JOB_STATUS_QUEUED, 0)
+	go srv.work(0)
+	next(qxdlpb.JobStatus_JOB_STATUS_RUNNING, 0)
+	step <- struct{}{}
+	next(qxdlpb.JobStatus_JOB_STATUS_RUNNING, 1)
+	step <- struct{}{}
+	next(qxdlpb.JobStatus_JOB_STATUS_DONE, 1)
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("after done: %v, want the stream to end", err)
+	}
+
+	list, err := c.List(ctx, &qxdlpb.ListRequest{})
+	if err != nil || len(list.Jobs) != 1 || list.Jobs[0].Progress.Bytes != 42 {
+		t.Errorf("list = %v, %v", list, err)
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	o := testOptions(t)
+	s, _ := testSession(t, o, &fakeServer{})
+	c := grpcClient(t, newServer(s))
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, &qxdlpb.JobRef{Id: 9}); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown job: %v", err)
+	}
+	if _, err := c.Cancel(ctx, &qxdlpb.JobRef{Id: 9}); status.Code(err) != codes.NotFound {
+		t.Errorf("cancel unknown job: %v", err)
+	}
+	if _, err := c.Submit(ctx, &qxdlpb.JobSpec{Url: "http://pages.example/b/001.png", Start: "001", OverridesJson: `{"intervall": 5}`}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("misspelled override: %v", err)
+	}
+	if _, err := c.Submit(ctx, &qxdlpb.JobSpec{Url: "http://pages.example/b/", Start: "001", UrlCmd: "touch /tmp/pwned"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("url_cmd: %v", err)
+	}
+	if _, err := c.Submit(ctx, &qxdlpb.JobSpec{Url: "http://pages.example/b/001.png", Start: "001", Out: "/etc"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("absolute out: %v", err)
+	}
+}
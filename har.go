@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -har records every request of the run, redirects and HEADs included, as
+// an HTTP Archive that browser dev tools open: headers, status and timings,
+// and with -har-bodies the response bodies too. Credentials are redacted as
+// in the -vv dump.
+
+// harBodyMax is the most of one response body -har-bodies keeps.
+const harBodyMax = 1 << 20
+
+// runHAR is the archive being recorded, if any.
+var runHAR *harLog
+
+type harLog struct {
+	path   string
+	bodies bool
+	next   http.RoundTripper
+
+	mu      sync.Mutex
+	entries []*harEntry
+	once    sync.Once
+}
+
+type harEntry struct {
+	Started  time.Time   `json:"startedDateTime"`
+	Time     float64     `json:"time"` // ms
+	Request  harRequest  `json:"request"`
+	Response harResponse `json:"response"`
+	Cache    struct{}    `json:"cache"`
+	Timings  harTimings  `json:"timings"`
+	ServerIP string      `json:"serverIPAddress,omitempty"`
+	Err      string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	HTTPVersion string    `json:"httpVersion"`
+	Cookies     []harPair `json:"cookies"`
+	Headers     []harPair `json:"headers"`
+	QueryString []harPair `json:"queryString"`
+	HeadersSize int       `json:"headersSize"`
+	BodySize    int       `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Cookies     []harPair  `json:"cookies"`
+	Headers     []harPair  `json:"headers"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int        `json:"headersSize"`
+	BodySize    int64      `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func startHAR(path string, bodies bool, next http.RoundTripper) *harLog {
+	runHAR = &harLog{path: path, bodies: bodies, next: next}
+	return runHAR
+}
+
+// stopHAR writes the archive; requests still in flight are left out.
+func stopHAR() {
+	h := runHAR
+	if h == nil {
+		return
+	}
+	h.once.Do(func() {
+		if err := h.write(); err != nil {
+			fmt.Println("[WARN] har:", err)
+		}
+	})
+}
+
+func (h *harLog) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := &harEntry{Started: time.Now(), Request: harRequest{
+		Method: req.Method, URL: req.URL.String(), HTTPVersion: req.Proto,
+		Cookies: []harPair{}, Headers: harHeaders(req.Header), QueryString: []harPair{},
+		HeadersSize: -1, BodySize: -1,
+	}}
+	if e.Request.HTTPVersion == "" {
+		e.Request.HTTPVersion = "HTTP/1.1"
+	}
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			e.Request.QueryString = append(e.Request.QueryString, harPair{k, v})
+		}
+	}
+	var wrote, first time.Time
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(ci httptrace.GotConnInfo) {
+			e.ServerIP, _, _ = net.SplitHostPort(ci.Conn.RemoteAddr().String())
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+		GotFirstResponseByte: func() { first = time.Now() },
+	}))
+	resp, err := h.next.RoundTrip(req)
+	if !wrote.IsZero() {
+		e.Timings.Send = ms(wrote.Sub(e.Started))
+		if !first.IsZero() {
+			e.Timings.Wait = ms(first.Sub(wrote))
+		}
+	}
+	if err != nil {
+		e.Err = err.Error()
+		e.Time = ms(time.Since(e.Started))
+		e.Response = harResponse{Cookies: []harPair{}, Headers: []harPair{}, HeadersSize: -1, BodySize: -1}
+		h.add(e)
+		return resp, err
+	}
+	mt := resp.Header.Get("Content-Type")
+	if mt == "" {
+		mt = "application/octet-stream"
+	}
+	e.Response = harResponse{
+		Status: resp.StatusCode, StatusText: strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+		HTTPVersion: resp.Proto, Cookies: []harPair{}, Headers: harHeaders(resp.Header),
+		Content:     harContent{Size: -1, MimeType: mt},
+		RedirectURL: resp.Header.Get("Location"), HeadersSize: -1, BodySize: -1,
+	}
+	if req.Method == http.MethodHead {
+		e.Response.Content.Size, e.Response.BodySize = 0, 0
+		e.Time = ms(time.Since(e.Started))
+		h.add(e)
+		return resp, nil
+	}
+	resp.Body = &harBody{ReadCloser: resp.Body, h: h, e: e, keep: h.bodies}
+	return resp, nil
+}
+
+func (h *harLog) add(e *harEntry) {
+	h.mu.Lock()
+	h.entries = append(h.entries, e)
+	h.mu.Unlock()
+}
+
+func (h *harLog) write() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	type creator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	var doc struct {
+		Log struct {
+			Version string      `json:"version"`
+			Creator creator     `json:"creator"`
+			Entries []*harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	doc.Log.Version = "1.2"
+	doc.Log.Creator = creator{"qxdl", readBuildInfo().Version}
+	// entries are added as they finish; the archive lists them as they started
+	sort.SliceStable(h.entries, func(i, k int) bool { return h.entries[i].Started.Before(h.entries[k].Started) })
+	doc.Log.Entries = h.entries
+	if doc.Log.Entries == nil {
+		doc.Log.Entries = []*harEntry{}
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(h.path+".part", b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(h.path+".part", h.path)
+}
+
+// harBody finishes its entry when the body is closed: the size, the receive
+// time and, with -har-bodies, the content.
+type harBody struct {
+	io.ReadCloser
+	h    *harLog
+	e    *harEntry
+	keep bool
+	n    int64
+	buf  []byte
+	once sync.Once
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.keep && len(b.buf) < harBodyMax {
+		b.buf = append(b.buf, p[:min(n, harBodyMax-len(b.buf))]...)
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		e := b.e
+		e.Time = ms(time.Since(e.Started))
+		e.Timings.Receive = max(math.Round((e.Time-e.Timings.Send-e.Timings.Wait)*1000)/1000, 0)
+		e.Response.BodySize, e.Response.Content.Size = b.n, b.n
+		if b.keep {
+			if b.n > harBodyMax {
+				e.Response.Content.Comment = fmt.Sprintf("body cut at %d of %d bytes", harBodyMax, b.n)
+			}
+			if textual(e.Response.Content.MimeType) {
+				e.Response.Content.Text = string(b.buf)
+			} else if len(b.buf) > 0 {
+				e.Response.Content.Text, e.Response.Content.Encoding = base64.StdEncoding.EncodeToString(b.buf), "base64"
+			}
+		}
+		b.h.add(e)
+	})
+	return err
+}
+
+// harHeaders lists h for the archive, credentials redacted.
+func harHeaders(h http.Header) []harPair {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := []harPair{}
+	for _, k := range keys {
+		for _, v := range h[k] {
+			switch k {
+			case "Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie":
+				v = "(redacted)"
+			}
+			out = append(out, harPair{k, v})
+		}
+	}
+	return out
+}
+
+func textual(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mt, "text/") || strings.HasSuffix(mt, "json") || strings.HasSuffix(mt, "xml") || mt == "application/javascript"
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// pageSum hashes a page while it is copied to disk, so the manifest and
+// -on-duplicate need not read the file back.
+type pageSum struct {
+	sha hash.Hash
+	crc hash.Hash32 // nil without -crc32
+}
+
+func newPageSum(withCRC bool) *pageSum {
+	p := &pageSum{sha: sha256.New()}
+	if withCRC {
+		p.crc = crc32.NewIEEE()
+	}
+	return p
+}
+
+func (p *pageSum) Write(b []byte) (int, error) {
+	p.sha.Write(b)
+	if p.crc != nil {
+		p.crc.Write(b)
+	}
+	return len(b), nil
+}
+
+// sums returns the hex SHA-256 and CRC32; the CRC32 is "" without -crc32.
+func (p *pageSum) sums() (string, string) {
+	crc := ""
+	if p.crc != nil {
+		crc = fmt.Sprintf("%08x", p.crc.Sum32())
+	}
+	return hex.EncodeToString(p.sha.Sum(nil)), crc
+}
+
+// hashFile reads name back for a page whose bytes changed after the copy
+// (-strip-metadata, -convert).
+func hashFile(name string, withCRC bool) (string, string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	p := newPageSum(withCRC)
+	if _, err := io.Copy(p, f); err != nil {
+		return "", "", err
+	}
+	sha, crc := p.sums()
+	return sha, crc, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// shellCommand runs a user command line through the shell, with env added
+// to the environment. Values travel only in the environment, so no quoting
+// can break the command.
+func shellCommand(command string, env ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	return cmd
+}
+
+// runHook runs a hook and waits for it. Its output goes to ours.
+func runHook(command string, env ...string) error {
+	cmd := shellCommand(command, env...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stdout
+	return cmd.Run()
+}
+
+// fileHook is -exec-after-file, run for every page that was fetched,
+// missing or failed (not for pages skipped as already there). file is where
+// the page is or would have been saved.
+func (jr *jobRun) fileHook(ps pageState, file string) {
+	if jr.o.execAfterFile == "" || ps.Status == pageSkipped {
+		return
+	}
+	err := runHook(jr.o.execAfterFile,
+		"QXDL_FILE="+file, "QXDL_URL="+ps.URL, "QXDL_STATUS="+ps.Status,
+		"QXDL_PAGE="+strconv.Itoa(ps.Num), "QXDL_CODE="+strconv.Itoa(ps.Code))
+	if err != nil {
+		fmt.Println("[WARN] exec-after-file:", err)
+	}
+}
+
+// runHookFor is -exec-after-run, run once a job has ended for any reason.
+func (s *session) runHookFor(r jobReport) {
+	err := runHook(s.o.execAfterRun,
+		"QXDL_EVENT="+r.Event, "QXDL_URL="+r.URL, "QXDL_FOLDER="+r.Folder, "QXDL_ERROR="+r.Error,
+		"QXDL_OK="+strconv.Itoa(r.Pages.OK), "QXDL_SKIPPED="+strconv.Itoa(r.Pages.Skipped),
+		"QXDL_MISSING="+strconv.Itoa(r.Pages.Missing), "QXDL_FAILED="+strconv.Itoa(r.Pages.Failed))
+	if err != nil {
+		fmt.Println("[WARN] exec-after-run:", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Host memory is what qxdl learned about each host's limits in earlier
+// runs: how often it answered 429 or 503, the interval it last put up with
+// and its last cooldown. A later job on the host starts at that interval
+// instead of finding the limit again the hard way.
+
+const hostMemoryFile = "hosts.json"
+
+// cleanRunRequests is how many requests without a 429 or 503 it takes
+// before a learned interval is eased.
+const cleanRunRequests = 20
+
+type hostRecord struct {
+	Requests     int       `json:"requests"`
+	Throttled    int       `json:"throttled"`          // 429 and 503 answers
+	Interval     int       `json:"interval,omitempty"` // seconds; 0 = nothing learned
+	LastCooldown float64   `json:"last_cooldown_s,omitempty"`
+	LastCooledAt time.Time `json:"last_cooled_at,omitempty"`
+	Updated      time.Time `json:"updated"`
+}
+
+type hostMemory map[string]*hostRecord
+
+func loadHostMemory(dir string) (hostMemory, error) {
+	hm := hostMemory{}
+	b, err := os.ReadFile(filepath.Join(dir, hostMemoryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return hm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &hm); err != nil {
+		return nil, err
+	}
+	return hm, nil
+}
+
+func (hm hostMemory) save(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(hm, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, hostMemoryFile+".part")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, hostMemoryFile))
+}
+
+// recall raises o.interval to what host tolerated last time, if that is
+// slower than asked for.
+func (hm hostMemory) recall(host string, o *options) {
+	hr, ok := hm[host]
+	if !ok || hr.Interval <= o.interval {
+		return
+	}
+	fmt.Fprintf(logAt(o.verbosity, lvlNormal), "[host] %s throttled %d of %d request(s) in earlier runs; starting at -interval %d instead of %d\n",
+		host, hr.Throttled, hr.Requests, hr.Interval, o.interval)
+	o.interval = hr.Interval
+}
+
+// learn folds one job's requests to its host into the record. A job that
+// was throttled leaves the interval one backoff step above the one it ran
+// at; a long enough clean job eases it by a quarter, and forgets it once it
+// is no slower than -interval.
+func (hm hostMemory) learn(jr *jobRun, base int) {
+	hr, ok := hm[jr.host]
+	if !ok {
+		hr = &hostRecord{}
+		hm[jr.host] = hr
+	}
+	hr.Requests += jr.requests
+	hr.Throttled += jr.throttled
+	hr.Updated = time.Now()
+	if !jr.lastCooledAt.IsZero() {
+		hr.LastCooldown, hr.LastCooledAt = jr.lastCooldown.Seconds(), jr.lastCooledAt
+	}
+	switch {
+	case jr.throttled > 0:
+		slower := int(jr.interval().Seconds()*jr.o.backoff + 0.5)
+		hr.Interval = min(max(hr.Interval, slower), jr.o.maxWait)
+	case jr.requests >= cleanRunRequests && hr.Interval > 0:
+		if hr.Interval = hr.Interval * 3 / 4; hr.Interval <= base {
+			hr.Interval = 0
+		}
+	}
+}
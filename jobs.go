@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jobOverrides are the per-job settings a jobs file may change; unset fields
+// keep the command line value.
+type jobOverrides struct {
+	Interval     *int     `yaml:"interval" json:"interval,omitempty"`
+	Jitter       *float64 `yaml:"jitter" json:"jitter,omitempty"`
+	Retries      *int     `yaml:"retries" json:"retries,omitempty"`
+	MaxErrors    *int     `yaml:"max_errors" json:"max_errors,omitempty"`
+	Ext          *string  `yaml:"ext" json:"ext,omitempty"`
+	NameTemplate *string  `yaml:"name_template" json:"name_template,omitempty"`
+	Step         *int     `yaml:"step" json:"step,omitempty"`
+	RenameStart  *string  `yaml:"rename_start" json:"rename_start,omitempty"`
+	Reverse      *bool    `yaml:"reverse" json:"reverse,omitempty"`
+	AutoStop     *int     `yaml:"auto_stop" json:"auto_stop,omitempty"`
+	Export       *string  `yaml:"export" json:"export,omitempty"`
+	Pack         *string  `yaml:"pack" json:"pack,omitempty"`
+	Mirror       *string  `yaml:"mirror" json:"mirror,omitempty"`
+}
+
+func (ov jobOverrides) apply(o options) (options, error) {
+	if ov.Interval != nil {
+		o.interval = *ov.Interval
+	}
+	if ov.Jitter != nil {
+		o.jitterFrac = *ov.Jitter
+	}
+	if ov.Retries != nil {
+		o.retries = *ov.Retries
+	}
+	if ov.MaxErrors != nil {
+		o.maxErrors = *ov.MaxErrors
+	}
+	if ov.Ext != nil {
+		o.ext = *ov.Ext
+	}
+	if ov.NameTemplate != nil {
+		o.nameTmpl = *ov.NameTemplate
+	}
+	if ov.Step != nil {
+		o.step = *ov.Step
+	}
+	if ov.RenameStart != nil {
+		if !isAllDigits(*ov.RenameStart) {
+			return o, fmt.Errorf("rename_start must be a number")
+		}
+		o.renameFrom = *ov.RenameStart
+	}
+	if ov.Reverse != nil {
+		o.reverse = *ov.Reverse
+	}
+	if ov.AutoStop != nil {
+		o.autoStop = *ov.AutoStop
+	}
+	if ov.Export != nil {
+		exports, err := parseExports(*ov.Export)
+		if err != nil {
+			return o, err
+		}
+		o.exports = exports
+	}
+	if ov.Pack != nil {
+		o.packFormat = *ov.Pack
+	}
+	if ov.Mirror != nil {
+		mirrors, err := parseMirrors(*ov.Mirror)
+		if err != nil {
+			return o, err
+		}
+		o.mirrors = mirrors
+	}
+	if o.step < 1 || o.autoStop < 1 {
+		return o, fmt.Errorf("step and auto_stop must be >= 1")
+	}
+	return o, nil
+}
+
+// jobsFile is the -jobs format. YAML and JSON both work.
+type jobsFile struct {
+	Defaults jobOverrides `yaml:"defaults"`
+	Jobs     []job        `yaml:"jobs"`
+}
+
+// loadJobs reads a jobs file and folds its defaults into every job.
+func loadJobs(name string) ([]job, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var jf jobsFile
+	if err := yaml.Unmarshal(b, &jf); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(jf.Jobs) == 0 {
+		return nil, fmt.Errorf("%s: no jobs", name)
+	}
+	for i := range jf.Jobs {
+		jf.Jobs[i].jobOverrides = jf.Defaults.merge(jf.Jobs[i].jobOverrides)
+	}
+	return jf.Jobs, nil
+}
+
+// merge returns ov with unset fields taken from base.
+func (base jobOverrides) merge(ov jobOverrides) jobOverrides {
+	if ov.Interval == nil {
+		ov.Interval = base.Interval
+	}
+	if ov.Jitter == nil {
+		ov.Jitter = base.Jitter
+	}
+	if ov.Retries == nil {
+		ov.Retries = base.Retries
+	}
+	if ov.MaxErrors == nil {
+		ov.MaxErrors = base.MaxErrors
+	}
+	if ov.Ext == nil {
+		ov.Ext = base.Ext
+	}
+	if ov.NameTemplate == nil {
+		ov.NameTemplate = base.NameTemplate
+	}
+	if ov.Step == nil {
+		ov.Step = base.Step
+	}
+	if ov.RenameStart == nil {
+		ov.RenameStart = base.RenameStart
+	}
+	if ov.Reverse == nil {
+		ov.Reverse = base.Reverse
+	}
+	if ov.AutoStop == nil {
+		ov.AutoStop = base.AutoStop
+	}
+	if ov.Export == nil {
+		ov.Export = base.Export
+	}
+	if ov.Pack == nil {
+		ov.Pack = base.Pack
+	}
+	if ov.Mirror == nil {
+		ov.Mirror = base.Mirror
+	}
+	return ov
+}
+
+// runJobs runs jobs one after another on one session, so they share the
+// per-host pacing, the slowdowns and the blocklist. A failed job does not
+// stop the others, but a ban skips the rest of that host's jobs.
+func runJobs(s *session, jobs []job) {
+	failed, code := 0, exitOK
+	for i, j := range jobs {
+		fmt.Fprintf(logAt(s.o.verbosity, lvlNormal), "=== job %d/%d: %s ===\n", i+1, len(jobs), j.URL)
+		res, err := s.runJob(j)
+		if err != nil {
+			fmt.Printf("[ERROR] job %d: %v\n", i+1, err)
+		}
+		if err != nil || res.Aborted {
+			failed++
+		}
+		code = worseExit(code, jobExitCode(res, err))
+		if res.Stopped {
+			fmt.Printf("[stop] not starting the remaining %d job(s)\n", len(jobs)-i-1)
+			break
+		}
+	}
+	s.summary(fmt.Sprintf("Done: %d of %d job(s) completed.", len(jobs)-failed, len(jobs)))
+	if code != exitOK {
+		exit(code)
+	}
+}
+
+// summary prints the per-host request counts and slowdowns of a multi-job
+// session, then done.
+func (s *session) summary(done string) {
+	s.optimized()
+	stopTUI()
+	w := logAt(s.o.verbosity, lvlNormal)
+	for _, line := range s.pace.summary() {
+		fmt.Fprintln(w, "Requests to", line)
+	}
+	if lines := s.stats.lines(); lines != nil {
+		fmt.Fprintln(w, "Stats:")
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+	if s.slowdowns > 0 {
+		fmt.Fprintf(w, "Interval doubled %d time(s) after repeated 5xx.\n", s.slowdowns)
+	}
+	fmt.Fprintln(w, done)
+	s.writeReport()
+}
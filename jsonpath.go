@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -from-json: reader sites often load a chapter from a JSON manifest. The
+// page URLs are picked out of it with a JSONPath subset: $, .key, ['key'],
+// [n] (negative counts from the end), [*], .* and ..key for a key at any
+// depth.
+
+// jsonStep is one step of a parsed path.
+type jsonStep struct {
+	key   string // object member; "" with index or wildcard set
+	index *int
+	all   bool // [*] or .*
+	deep  bool // ..key: search every level below
+}
+
+func parseJSONPath(p string) ([]jsonStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(p), "$")
+	if !ok {
+		return nil, fmt.Errorf("json-path %q must start with $", p)
+	}
+	var steps []jsonStep
+	for rest != "" {
+		var st jsonStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			st.deep, rest = true, rest[2:]
+		case rest[0] == '.':
+			rest = rest[1:]
+		case rest[0] == '[':
+		default:
+			return nil, fmt.Errorf("json-path %q: unexpected %q", p, rest[0])
+		}
+		switch {
+		case strings.HasPrefix(rest, "*"):
+			st.all, rest = true, rest[1:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json-path %q: unclosed [", p)
+			}
+			in := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case in == "*":
+				st.all = true
+			case len(in) >= 2 && (in[0] == '\'' || in[0] == '"') && in[len(in)-1] == in[0]:
+				st.key = in[1 : len(in)-1]
+			default:
+				n, err := strconv.Atoi(in)
+				if err != nil {
+					return nil, fmt.Errorf("json-path %q: [%s] is not an index, * or 'key'", p, in)
+				}
+				st.index = &n
+			}
+		default:
+			i := strings.IndexAny(rest, ".[")
+			if i < 0 {
+				i = len(rest)
+			}
+			st.key, rest = rest[:i], rest[i:]
+			if st.key == "" {
+				return nil, fmt.Errorf("json-path %q: empty key", p)
+			}
+		}
+		steps = append(steps, st)
+	}
+	return steps, nil
+}
+
+// evalJSONPath returns the values steps select from v, in document order
+// (object members by key, as Go decodes them into maps).
+func evalJSONPath(v any, steps []jsonStep) []any {
+	cur := []any{v}
+	for _, st := range steps {
+		var next []any
+		for _, c := range cur {
+			if st.deep {
+				next = append(next, descend(c, st)...)
+			} else {
+				next = append(next, stepInto(c, st)...)
+			}
+		}
+		cur = next
+	}
+	return cur
+}
+
+func stepInto(v any, st jsonStep) []any {
+	switch x := v.(type) {
+	case map[string]any:
+		if st.all {
+			var out []any
+			for _, k := range sortedKeys(x) {
+				out = append(out, x[k])
+			}
+			return out
+		}
+		if c, ok := x[st.key]; ok && st.index == nil {
+			return []any{c}
+		}
+	case []any:
+		switch {
+		case st.all:
+			return x
+		case st.index != nil:
+			i := *st.index
+			if i < 0 {
+				i += len(x)
+			}
+			if i >= 0 && i < len(x) {
+				return []any{x[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// descend applies st to v and everything below it.
+func descend(v any, st jsonStep) []any {
+	out := stepInto(v, st)
+	switch x := v.(type) {
+	case map[string]any:
+		for _, k := range sortedKeys(x) {
+			out = append(out, descend(x[k], st)...)
+		}
+	case []any:
+		for _, c := range x {
+			out = append(out, descend(c, st)...)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonURLs picks the page URLs out of a JSON document: every string the
+// path selects, resolved against base, without repeats.
+func jsonURLs(b []byte, path string, base *url.URL) ([]string, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("from-json: %w", err)
+	}
+	seen := map[string]bool{}
+	var urls []string
+	for _, v := range evalJSONPath(doc, steps) {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		u, err := base.Parse(strings.TrimSpace(s))
+		if s == "" || err != nil || !isSourceURL(u.String()) || seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		urls = append(urls, u.String())
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("from-json: json-path " + path + " selected no URL strings")
+	}
+	return urls, nil
+}
+
+// jsonURLSource fetches the manifest and lists the pages it names as a
+// urlSource, like -from-page does for HTML.
+func (jr *jobRun) jsonURLSource(manifest, path string) (*urlSource, error) {
+	host := jr.host
+	if u, err := url.Parse(manifest); err == nil {
+		host = u.Host
+	}
+	jr.pace.before(jr.ctx, host, "GET", jr.getGap())
+	fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[json] %s\n", manifest)
+	b, base, err := fetchIndexPage(jr.ctx, jr.client, manifest, jr.o.ua, "application/json", jr.timeout())
+	if err != nil {
+		return nil, fmt.Errorf("from-json: %w", err)
+	}
+	urls, err := jsonURLs([]byte(b), path, base)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[list] %d page URL(s) in %s\n", len(urls), manifest)
+	return &urlSource{name: "-from-json", lines: urls, done: true}, nil
+}
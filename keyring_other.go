@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// readKeyring asks the Keychain (security) on macOS and the Secret Service
+// (secret-tool, from libsecret) elsewhere for the secret stored as name.
+func readKeyring(name string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", name)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return "", fmt.Errorf("%s is not installed", cmd.Path)
+	case errors.As(err, &exit):
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", cmd.Args[0], msg)
+		}
+		return "", errNoCredential // secret-tool says nothing when there is no match
+	case err != nil:
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	advapi32      = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW = advapi32.NewProc("CredReadW")
+	procCredFree  = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric = 1
+	errorNotFound   = syscall.Errno(1168)
+)
+
+// winCredential is CREDENTIALW.
+type winCredential struct {
+	flags, typ     uint32
+	targetName     *uint16
+	comment        *uint16
+	lastWritten    [2]uint32
+	blobSize       uint32
+	blob           *byte
+	persist        uint32
+	attributeCount uint32
+	attributes     uintptr
+	targetAlias    *uint16
+	userName       *uint16
+}
+
+// readKeyring reads the generic credential "qxdl:NAME" from the Windows
+// Credential Manager (cmdkey /generic:qxdl:NAME /user:qxdl /pass:...).
+func readKeyring(name string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(keyringService + ":" + name)
+	if err != nil {
+		return "", err
+	}
+	var cred *winCredential
+	if r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); r == 0 {
+		if err == errorNotFound {
+			return "", errNoCredential
+		}
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	blob := unsafe.Slice(cred.blob, cred.blobSize)
+	// cmdkey and the control panel store UTF-16, other tools often UTF-8
+	if len(blob) >= 2 && len(blob)%2 == 0 && blob[1] == 0 {
+		u := make([]uint16, len(blob)/2)
+		for i := range u {
+			u[i] = uint16(blob[2*i]) | uint16(blob[2*i+1])<<8
+		}
+		return string(utf16.Decode(u)), nil
+	}
+	return string(blob), nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// -latest-link NAME keeps a link NAME next to the job's folder pointing at
+// the folder of its last successful range: for a {chap} job the newest
+// chapter, otherwise the job's folder. Scripts that pick up new pages find
+// them there. A file or folder by that name that is not a link is never
+// replaced.
+
+func updateLatest(folder, name string) error {
+	abs, err := filepath.Abs(folder)
+	if err != nil {
+		return err
+	}
+	link := filepath.Join(filepath.Dir(abs), name)
+	if link == abs {
+		return fmt.Errorf("%s would point at itself", link)
+	}
+	fi, err := os.Lstat(link)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil && fi.Mode()&(os.ModeSymlink|os.ModeIrregular) == 0 {
+		return fmt.Errorf("%s exists and is not a link; leaving it alone", link)
+	}
+	return replaceDirLink(abs, link)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLatestLinkFollowsTheNewestFolder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	dir := t.TempDir()
+	for _, ch := range []string{"ch01", "ch02"} {
+		os.Mkdir(filepath.Join(dir, ch), 0o755)
+		if err := updateLatest(filepath.Join(dir, ch), "latest"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "latest")); err != nil || target != "ch02" {
+		t.Errorf("latest -> %q, %v", target, err)
+	}
+
+	os.Mkdir(filepath.Join(dir, "real"), 0o755)
+	if err := updateLatest(filepath.Join(dir, "ch01"), "real"); err == nil {
+		t.Error("replaced a real folder")
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// replaceDirLink points link at dir: a relative symlink where Windows
+// allows one (Developer Mode or an elevated prompt), else a junction,
+// which needs no privilege but holds an absolute path.
+func replaceDirLink(dir, link string) error {
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Symlink(filepath.Base(dir), link) == nil {
+		return nil
+	}
+	out, err := exec.Command("cmd", "/C", "mklink", "/J", link, dir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mklink /J: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Every run holds .qxdl.lock in the folder it writes to, so two qxdl never
+// fetch into the same folder at once and clobber each other's .part files
+// (overlapping cron jobs, a -watch and a manual run). The lock names the
+// process; one left behind by a qxdl that is gone from this machine is
+// taken over. -on-locked chooses between giving up on the job and waiting.
+
+const lockFile = ".qxdl.lock"
+
+// lockPoll is how often -on-locked wait looks at the lock again.
+var lockPoll = 10 * time.Second
+
+// staleSeen runs once tryLock has found a stale lock; tests line up
+// several takers there.
+var staleSeen = func() {}
+
+type folderLock struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+
+	path string
+}
+
+func (l *folderLock) String() string {
+	return fmt.Sprintf("qxdl pid %d on %s since %s", l.PID, l.Host, l.Started.Format("2006-01-02 15:04"))
+}
+
+// stale reports whether the holder is known to be gone: it ran on this
+// machine and the process no longer exists.
+func (l *folderLock) stale() bool {
+	host, _ := os.Hostname()
+	return l.Host == host && !processAlive(l.PID)
+}
+
+var errLocked = errors.New("folder is locked")
+
+// tryLock takes folder's lock, or returns the holder's and errLocked.
+func tryLock(folder string) (*folderLock, error) {
+	path := filepath.Join(folder, lockFile)
+	host, _ := os.Hostname()
+	me := &folderLock{PID: os.Getpid(), Host: host, Started: time.Now(), path: path}
+	b, err := json.Marshal(me)
+	if err != nil {
+		return nil, err
+	}
+	for tries := 0; tries < 2; tries++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = f.Write(b)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return me, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		held := readLock(path)
+		if held == nil || !held.stale() {
+			return held, errLocked
+		}
+		fmt.Printf("[lock] %s was left by %s, which is gone; taking it over\n", path, held)
+		staleSeen()
+		if err := clearStale(path, held); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return readLock(path), errLocked
+		}
+	}
+	return readLock(path), errLocked
+}
+
+// clearStale removes the stale lock held from path. Removing it outright
+// could remove a lock another qxdl took over meanwhile, so it is moved aside
+// first, which only one of them can do, and put back if it is not held.
+func clearStale(path string, held *folderLock) error {
+	aside := fmt.Sprintf("%s.%d.stale", path, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		return err // someone else got there first
+	}
+	if l := readLock(aside); l == nil || l.PID != held.PID || l.Host != held.Host || !l.Started.Equal(held.Started) {
+		os.Rename(aside, path)
+		return errLocked
+	}
+	return os.Remove(aside)
+}
+
+// readLock returns the lock at path; nil if it cannot be read, which
+// counts as held, since it may be being written.
+func readLock(path string) *folderLock {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var l folderLock
+	if json.Unmarshal(b, &l) != nil {
+		return nil
+	}
+	l.path = path
+	return &l
+}
+
+func (l *folderLock) release() {
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Println("[WARN] unlock:", err)
+	}
+}
+
+// lockFolder takes folder's lock for the job, waiting for it under
+// -on-locked wait until the holder is done or the run stops.
+func (jr *jobRun) lockFolder(folder string) (*folderLock, error) {
+	waited := false
+	for {
+		l, err := tryLock(folder)
+		if !errors.Is(err, errLocked) {
+			return l, err
+		}
+		holder := "another qxdl"
+		if l != nil {
+			holder = l.String()
+		}
+		if jr.o.onLocked != "wait" {
+			return nil, fmt.Errorf("%s is in use by %s; remove %s if no qxdl is writing there, or pass -on-locked wait",
+				folder, holder, filepath.Join(folder, lockFile))
+		}
+		if !waited {
+			fmt.Printf("[lock] %s is in use by %s; waiting for it\n", folder, holder)
+			waited = true
+		}
+		jr.pace.sleeper.Sleep(jr.ctx, lockPoll)
+		if err := jr.ctx.Err(); err != nil {
+			return nil, fmt.Errorf("stopped while waiting for %s: %w", folder, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFolderLockIsExclusive(t *testing.T) {
+	dir := t.TempDir()
+	l, err := tryLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := tryLock(dir)
+	if !errors.Is(err, errLocked) || held == nil || held.PID != os.Getpid() {
+		t.Fatalf("second lock: %v, %v", held, err)
+	}
+	l.release()
+	if l, err = tryLock(dir); err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+	l.release()
+}
+
+func TestStaleLockIsTakenOver(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	// a pid no process has: far above any pid_max
+	b, _ := json.Marshal(folderLock{PID: 1 << 30, Host: host, Started: time.Now()})
+	os.WriteFile(filepath.Join(dir, lockFile), b, 0o644)
+	l, err := tryLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.release()
+	if got := readLock(filepath.Join(dir, lockFile)); got == nil || got.PID != os.Getpid() {
+		t.Errorf("lock now %v", got)
+	}
+}
+
+func TestStaleLockGoesToOneTaker(t *testing.T) {
+	host, _ := os.Hostname()
+	b, _ := json.Marshal(folderLock{PID: 1 << 30, Host: host, Started: time.Now()})
+	defer func(f func()) { staleSeen = f }(staleSeen)
+	const takers = 8
+	for round := 0; round < 20; round++ {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, lockFile), b, 0o644)
+		// every taker has read the stale lock before any of them acts on it
+		var seen atomic.Int32
+		all := make(chan struct{})
+		staleSeen = func() {
+			if seen.Add(1) == takers {
+				close(all)
+			}
+			<-all
+		}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		taken := 0
+		for i := 0; i < takers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := tryLock(dir); err == nil {
+					mu.Lock()
+					taken++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if taken != 1 {
+			t.Fatalf("round %d: %d takers got the lock", round, taken)
+		}
+	}
+}
+
+func TestLockedFolderFailsOrWaits(t *testing.T) {
+	defer func(d time.Duration) { lockPoll = d }(lockPoll)
+	lockPoll = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	other, err := tryLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := testOptions(t)
+	s, _ := testSession(t, o, &fakeServer{})
+	s.pace.sleeper = realClock{}
+	jr := &jobRun{session: s, ctx: context.Background(), xfer: context.Background(), o: o}
+	if _, err := jr.lockFolder(dir); err == nil || !strings.Contains(err.Error(), "in use by qxdl pid") {
+		t.Fatalf("fail mode: %v", err)
+	}
+
+	jr.o.onLocked = "wait"
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		other.release()
+	}()
+	l, err := jr.lockFolder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.release()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Verbosity levels, from -q to -vv. Each line is printed at one of them and
+// shows on the console when the run's verbosity is at least that.
+const (
+	lvlQuiet   = iota // errors and warnings only
+	lvlNormal         // one line per page, waits and summaries
+	lvlVerbose        // response headers, wait computations, retry reasons
+	lvlDebug          // full request and response metadata
+)
+
+// -log-file keeps a timestamped copy of everything printed, including the
+// detail -q hides from the console, in the output folder of the job being
+// run. Like the dashboard, it sits on a pipe in front of stdout.
+
+// logOnlyMark starts a line that goes to the log file but not the console.
+const logOnlyMark = '\x00'
+
+type logFile struct {
+	name    string // -log-file; relative names live in the job's folder
+	maxSize int64
+	keep    int
+	pipe    *os.File
+	drained chan struct{}
+	once    sync.Once
+
+	mu      sync.Mutex
+	console *os.File // where console lines go: the terminal or the dashboard
+	path    string
+	f       *os.File
+	size    int64
+	pending []string // lines from before the first job picked a folder
+}
+
+// runLog is the active log file, if any.
+var runLog *logFile
+
+func startLogFile(name string, maxSize int64, keep int) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	l := &logFile{name: name, maxSize: maxSize, keep: keep, pipe: w, drained: make(chan struct{}), console: os.Stdout}
+	os.Stdout = w
+	runLog = l
+	go l.read(r)
+	if filepath.IsAbs(name) {
+		return l.openIn("")
+	}
+	return nil
+}
+
+// stopLogFile writes out what is still in the pipe and closes the log.
+func stopLogFile() {
+	l := runLog
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		l.mu.Lock()
+		os.Stdout = l.console
+		l.mu.Unlock()
+		l.pipe.Close()
+		<-l.drained
+		runLog = nil
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.f != nil {
+			l.f.Close()
+		}
+	})
+}
+
+// setConsole points console output somewhere else and returns where it went
+// before; the dashboard uses it to slot in behind the log.
+func (l *logFile) setConsole(f *os.File) *os.File {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.console
+	l.console = f
+	return old
+}
+
+// openIn switches the log to the one in folder, carrying on after what
+// earlier runs left there.
+func (l *logFile) openIn(folder string) error {
+	path := l.name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(folder, path)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if path == l.path {
+		return nil
+	}
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.path, l.f, l.size = path, f, fi.Size()
+	for _, line := range l.pending {
+		l.write(line)
+	}
+	l.pending = nil
+	return nil
+}
+
+func (l *logFile) read(r *os.File) {
+	defer close(l.drained)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		l.mu.Lock()
+		if len(line) > 0 && line[0] == logOnlyMark {
+			line = line[1:]
+		} else {
+			fmt.Fprintln(l.console, line)
+		}
+		line = time.Now().Format("2006-01-02 15:04:05 ") + line
+		if l.f == nil {
+			l.pending = append(l.pending, line)
+		} else {
+			l.write(line)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// write appends one line, rotating first if it would push the file past
+// maxSize: name.1 is the newest old log and name.<keep> the oldest.
+func (l *logFile) write(line string) {
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line))+1 > l.maxSize {
+		if err := l.rotate(); err != nil {
+			fmt.Fprintln(l.console, "[WARN] log-file:", err)
+		}
+	}
+	n, err := fmt.Fprintln(l.f, line)
+	l.size += int64(n)
+	if err != nil {
+		fmt.Fprintln(l.console, "[WARN] log-file:", err)
+	}
+}
+
+func (l *logFile) rotate() error {
+	l.f.Close()
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.keep))
+	for i := l.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if l.keep > 0 {
+		os.Rename(l.path, l.path+".1")
+	} else {
+		os.Remove(l.path)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		// keep writing somewhere rather than losing the rest of the run
+		f, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	}
+	l.f, l.size = f, 0
+	return err
+}
+
+// logAt is where a line of the given level goes: the console when
+// verbosity reaches it, otherwise only the log file (up to verbose; debug
+// dumps stay out unless asked for), and nowhere without one.
+func logAt(verbosity, level int) io.Writer {
+	switch {
+	case verbosity >= level:
+		return os.Stdout
+	case runLog != nil && level <= lvlVerbose:
+		return logOnly{}
+	}
+	return io.Discard
+}
+
+type logOnly struct{}
+
+func (logOnly) Write(p []byte) (int, error) {
+	var b bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) > 0 {
+			b.WriteByte(logOnlyMark)
+			b.Write(line)
+		}
+	}
+	if _, err := os.Stdout.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -1,200 +1,718 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"math"
 	"math/rand"
 	"net/http"
-	"net/url"
 	"os"
-	"path"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
 type dlResult struct {
 	StatusCode int
 	RetryAfter time.Duration
+	File       string    // saved path; differs from the requested one with -ext auto
+	Size       int64     // bytes written, or Content-Length for HEAD
+	Wire       int64     // bytes received; less than Size for a compressed body
+	Challenge  bool      // an anti-bot challenge page came instead; nothing was saved
+	Modified   time.Time // Last-Modified of a saved page; zero if the server sent none
+	Limit      rateLimit // the host's X-RateLimit-* headers
+	Meta       *pageMeta // for -save-headers; nil unless the page came with 200
 	Err        error
+
+	// Size as it came, before -strip-metadata or -convert shrank or
+	// rewrote the page; 0 when neither did
+	Remote int64
+
+	// of the saved bytes, hashed during the copy; "" when they were not
+	// (-chunks) or CRC32 was not asked for
+	SHA256, CRC32 string
+}
+
+const defaultUA = "qxdl/1.1 gentle (+https://example.local)"
+
+// options are the command line settings shared by every job of a run.
+type options struct {
+	interval   int
+	jitterFrac float64
+	retries    int
+	timeout    int
+	maxWait    int
+	backoff    float64
+	maxErrors  int
+	ext        string
+	ua         string
+	verbosity  int
+	sessionDir string
+	ignoreBL   bool
+	banThresh  int
+	banCooloff time.Duration
+	hostMemory bool
+	exports    []string
+	packFormat string
+	nameTmpl   string
+	shard      int
+	shards     int
+	probePad   bool
+	autoStop   int
+	keepRuns   int
+	reverse    bool
+	headGap    time.Duration
+	preflight  bool
+	step       int
+	renameFrom string // -rename-start; "" keeps the server's numbers
+	watching   bool   // a -watch round after the first, which covers only the new tail
+	onLocked   string // -on-locked: fail or wait
+
+	organize     []string // -organize: host, date, month, year
+	organizeRoot string
+	latestLink   string // -latest-link: name of the link to the last good folder
+
+	// -max-retry-after (-1 = -max-wait) and -retry-after-policy: how much
+	// of a server's Retry-After is honored
+	maxRetryAfter    int
+	retryAfterPolicy string
+
+	altExts []string // -alt-ext: other extensions a page on disk may have
+
+	backoffStrategy string // -backoff-strategy
+	backoffSteps    int    // -backoff-max-steps: consecutive errors the backoff grows for
+	backoffReset    backoffReset
+
+	parts             string // -parts as given; "" = pages are not tiled
+	partFirst         int
+	partLast          int // -1 = auto
+	partPad           int
+	tileTmpl          string
+	stitch            string
+	stitchLayout      stitchLayout
+	keepTiles         bool
+	onAnomaly         string
+	anomalyRatio      float64
+	checkImages       bool
+	convert           string // -convert: png, jpg or webp; "" = off
+	jpegQuality       int
+	force             bool
+	forceMissing      bool
+	checkRemoteSize   bool
+	serverMtime       bool
+	saveHeaders       bool
+	minFreeMB         int
+	maxTotalBytes     int64
+	save              saving // -chunks, -fsync, -tmp-dir
+	maxDuration       time.Duration
+	window            *timeWindow
+	watch             bool
+	poll              time.Duration
+	interactive       bool
+	execAfterFile     string
+	optimizeCmd       string
+	optimizeWorkers   int
+	execAfterRun      string
+	onLowDisk         string
+	onDuplicate       string
+	webhook           string
+	notify            bool
+	otlp              string
+	logFile           string
+	logMaxMB          int
+	logKeep           int
+	report            string
+	onStatus          statusPolicy
+	onChallenge       string
+	challengeCooldown time.Duration
+	mirrors           []string
 }
 
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
+	// "queue run" and "serve" download, so they take the normal flags below
+	mode := ""
+	switch {
+	case len(os.Args) > 2 && os.Args[1] == "queue" && os.Args[2] == "run":
+		mode, os.Args = "queue run", append(os.Args[:1], os.Args[3:]...)
+	case len(os.Args) > 1 && os.Args[1] == "serve":
+		mode, os.Args = "serve", append(os.Args[:1], os.Args[2:]...)
+	case len(os.Args) > 1:
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
 	var (
-		rawURL     string
-		startStr   string
-		endStr     string
-		interval   int
-		jitterFrac float64
-		retries    int
-		timeout    int
-		maxWait    int
-		backoff    float64
-		maxErrors  int
-		ext        string
-		ua         string
-		quiet      bool
+		o           options
+		j           job
+		exportStr   string
+		shardStr    string
+		statusStr   string
+		mirrorStr   string
+		maxBytesStr string
+		chunkMinStr string
+		altExtStr   string
+		showVersion bool
+		windowStr   string
+		outputMode  string
+		tcFile      string
+		tlsFlags    tlsConfig
+		keepAlive   bool
+		useHTTP2    bool
+		maxIdle     int
+		maxRedirs   int
+		crossHost   bool
+		trustRedirs bool
+		idleTO      time.Duration
+		resolve     listFlag
+		credentials listFlag
+		ipv4        bool
+		ipv6        bool
+		jobsName    string
+		retryFail   bool
+		listen      string
+		grpcListen  string
+		useTUI      bool
+		noColor     bool
+		convertStr  string
+		organizeStr string
+		resetStr    string
+		quiet       bool
+		verbose     bool
+		debug       bool
+		wd          watchdog
+		wdHeapMB    int
+		wdRestart   bool
+		harPath     string
+		harBodies   bool
+		recordPath  string
+		replayPath  string
+		replaySpeed float64
+		controlPath string
 	)
-	flag.StringVar(&rawURL, "url", "", "Full URL to any page (e.g. .../0001.png or .../0064.png)")
-	flag.StringVar(&startStr, "start", "", "Start page as it appears in filename, e.g. 0001 or 0064 (required)")
-	flag.StringVar(&endStr, "end", "", "End page (you can type 0077 or 77). Default = start")
-	flag.IntVar(&interval, "interval", 6, "Base interval in seconds between files")
-	flag.Float64Var(&jitterFrac, "jitter", 0.2, "Random jitter fraction (0.2 = ±20%)")
-	flag.IntVar(&retries, "retries", 2, "Retry times per file on failure")
-	flag.IntVar(&timeout, "timeout", 30, "HTTP timeout in seconds")
-	flag.IntVar(&maxWait, "max-wait", 300, "Max adaptive wait seconds (for Retry-After / backoff)")
-	flag.Float64Var(&backoff, "backoff", 2.0, "Backoff multiplier when 429/503 or network errors")
-	flag.IntVar(&maxErrors, "max-errors", 8, "Abort after this many consecutive errors (polite stop)")
-	flag.StringVar(&ext, "ext", "png", "File extension without dot")
-	flag.StringVar(&ua, "ua", "qxdl/1.1 gentle (+https://example.local)", "User-Agent header")
-	flag.BoolVar(&quiet, "quiet", false, "Quiet mode (less logs)")
+	flag.StringVar(&j.URL, "url", "", "Full URL to any page (e.g. .../0001.png), or a template with {num} and optionally {chap}")
+	flag.StringVar(&j.Start, "start", "", "Start page as it appears in filename, e.g. 0001 or 0064 (required)")
+	flag.StringVar(&j.End, "end", "", "End page (you can type 0077 or 77), or auto to stop after -auto-stop consecutive 404s. Default = start")
+	flag.StringVar(&outputMode, "output", "", "Write pages to stdout instead of the output folder: - for the bodies back to back, tar for a tar stream named by -name-template; the log goes to stderr")
+	flag.StringVar(&j.URLCmd, "url-cmd", "", "Shell command that prints one page URL per line, read as pages are needed; -url then only names the site and folder, and -end defaults to the end of the list")
+	flag.StringVar(&j.FromPage, "from-page", "", "HTML page (gallery, chapter) to take the page image URLs from, in document order; needs -selector, and -url, -start and -end become optional")
+	flag.StringVar(&j.Selector, "selector", "", "With -from-page, CSS selector of the page images (img.page, #reader img, img[data-src]), or re:REGEX whose first group is the URL")
+	flag.StringVar(&j.FromFeed, "from-feed", "", "RSS or Atom feed to download the enclosures and images of new entries from, numbered on from the last run; combine with -watch to keep following it")
+	flag.StringVar(&j.FromJSON, "from-json", "", "JSON manifest (a reader site's chapter API) to take the page URLs from; needs -json-path, and -url, -start and -end become optional")
+	flag.StringVar(&j.JSONPath, "json-path", "", "With -from-json, JSONPath of the page URL strings, e.g. $.chapter.pages[*].url or $..url")
+	flag.StringVar(&j.ChapStart, "chap-start", "", "First chapter for {chap} in a -url template, padded as it appears (e.g. 01)")
+	flag.StringVar(&j.ChapEnd, "chap-end", "", "Last chapter for {chap}, or auto to stop after a chapter with no pages. Default = chap-start")
+	flag.StringVar(&j.ChapFolder, "chap-folder", "ch{chap}", "Per-chapter subfolder of the output folder")
+	flag.IntVar(&o.interval, "interval", 6, "Base interval in seconds between files")
+	flag.Float64Var(&o.jitterFrac, "jitter", 0.2, "Random jitter fraction (0.2 = ±20%)")
+	flag.IntVar(&o.retries, "retries", 2, "Retry times per file on failure")
+	flag.IntVar(&o.timeout, "timeout", 30, "HTTP timeout in seconds")
+	flag.IntVar(&o.maxWait, "max-wait", 300, "Max adaptive wait seconds (for backoff, and for Retry-After unless -max-retry-after is set)")
+	flag.IntVar(&o.maxRetryAfter, "max-retry-after", -1, "Max seconds of a server's Retry-After to wait (-1 = -max-wait); see -retry-after-policy")
+	flag.StringVar(&o.retryAfterPolicy, "retry-after-policy", "cap", "A Retry-After longer than -max-retry-after: cap (wait the maximum), honor (wait it all) or abort (stop the job)")
+	flag.Float64Var(&o.backoff, "backoff", 2.0, "Backoff multiplier when 429/503 or network errors")
+	flag.StringVar(&o.backoffStrategy, "backoff-strategy", backoffExponential, "How the wait grows with consecutive errors: exponential, decorrelated-jitter, fibonacci or constant")
+	flag.StringVar(&resetStr, "backoff-reset", "success", "When the consecutive-error count goes back down: success (any success), successes:N (N in a row) or decay:DURATION (one error forgiven per DURATION)")
+	flag.IntVar(&o.backoffSteps, "backoff-max-steps", 6, "Consecutive errors the backoff grows for; later ones wait as long as this many")
+	flag.IntVar(&o.maxErrors, "max-errors", 8, "Abort after this many consecutive errors (polite stop)")
+	flag.StringVar(&o.ext, "ext", "png", "File extension without dot, or auto to pick it from Content-Type")
+	flag.StringVar(&altExtStr, "alt-ext", "png,jpg,jpeg,webp,gif,avif", "Extensions under which a page already on disk also counts as existing (none = only -ext)")
+	flag.StringVar(&o.ua, "ua", defaultUA, "User-Agent header")
+	flag.BoolVar(&quiet, "q", false, "Only print errors and warnings")
+	flag.BoolVar(&quiet, "quiet", false, "Same as -q")
+	flag.BoolVar(&verbose, "v", false, "Verbose: also print response headers, wait computations and retry reasons")
+	flag.BoolVar(&debug, "vv", false, "Debug: also dump request and response metadata")
+	flag.StringVar(&o.sessionDir, "session-dir", defaultSessionDir(), "Directory for state shared between runs (host blocklist)")
+	flag.BoolVar(&o.ignoreBL, "ignore-blocklist", false, "Start even if the host is cooling off after repeated bans")
+	flag.IntVar(&o.banThresh, "ban-threshold", 2, "Soft-bans across runs before a host is put on cool-off")
+	flag.DurationVar(&o.banCooloff, "ban-cooloff", 24*time.Hour, "How long a repeatedly banned host stays on the blocklist")
+	flag.BoolVar(&o.hostMemory, "host-memory", true, "Start a host at the interval it tolerated in earlier runs when that is slower than -interval")
+	flag.StringVar(&exportStr, "export", "", "Comma separated metadata exports: xmp,hydrus,nomedia,sha256")
+	flag.StringVar(&o.packFormat, "pack", "", "Pack the folder into an archive after the run: cbz or zip")
+	flag.StringVar(&j.Out, "out", "", "Destination directory, s3://bucket/prefix or dav(s)://host/path (default: name of the URL's parent folder)")
+	flag.StringVar(&o.nameTmpl, "name-template", "{num}.{ext}", "Saved filename: {num} {n} {pad} {host} {folder} {series} {date} {chap} {ext}")
+	flag.StringVar(&shardStr, "shard", "", "Only fetch every Nth page: K/N takes pages K, K+N, ... of the range (e.g. 2/5)")
+	flag.BoolVar(&o.probePad, "probe-pad", true, "On the first 404, try other zero paddings (1.png, 001.png, ...) and keep the one that works")
+	flag.StringVar(&tcFile, "transport-config", "", "YAML/JSON file with proxy, TLS, headers and timeouts")
+	flag.BoolVar(&keepAlive, "keep-alive", true, "Reuse connections between requests (false = a new connection and TLS handshake per request)")
+	flag.BoolVar(&useHTTP2, "http2", true, "Use HTTP/2 when the server offers it")
+	flag.IntVar(&maxIdle, "max-idle-conns", 2, "Idle connections kept open per host")
+	flag.IntVar(&maxRedirs, "max-redirects", 10, "Redirects followed per request (0 refuses all)")
+	flag.BoolVar(&crossHost, "cross-host-redirects", true, "Follow redirects to another host")
+	flag.BoolVar(&trustRedirs, "trust-redirects", false, "Send the configured Cookie, Authorization and Referer headers to the host a redirect leads to as well")
+	flag.DurationVar(&idleTO, "idle-timeout", 90*time.Second, "Close a connection after it has been idle this long")
+	flag.Var(&credentials, "credential", "Take headers (cookies, tokens) and the proxy from the system keyring entry NAME (repeatable)")
+	flag.Var(&resolve, "resolve", "Connect to ADDR for HOST:PORT instead of looking it up, as HOST:PORT:ADDR (repeatable)")
+	flag.BoolVar(&ipv4, "4", false, "Only connect over IPv4")
+	flag.BoolVar(&ipv6, "6", false, "Only connect over IPv6")
+	flag.StringVar(&tlsFlags.CAFile, "cacert", "", "PEM file with extra CA certificates to trust (e.g. a self-signed reverse proxy)")
+	flag.StringVar(&tlsFlags.CertFile, "cert", "", "PEM client certificate for mTLS, with -key")
+	flag.StringVar(&tlsFlags.KeyFile, "key", "", "PEM private key of -cert")
+	flag.BoolVar(&tlsFlags.Insecure, "insecure", false, "Do not verify the server's TLS certificate (unsafe; prefer -cacert)")
+	flag.IntVar(&o.autoStop, "auto-stop", 3, "With -end auto, stop after this many consecutive 404s")
+	flag.DurationVar(&wd.every, "watchdog", 0, "Check goroutines, open files and heap this often and warn on leaks (0 = off)")
+	flag.IntVar(&wd.maxGoroutines, "watchdog-goroutines", 200, "Watchdog limit for goroutines")
+	flag.IntVar(&wd.maxFDs, "watchdog-fds", 256, "Watchdog limit for open file descriptors (Linux only)")
+	flag.IntVar(&wdHeapMB, "watchdog-heap-mb", 256, "Watchdog limit for live heap in MiB")
+	flag.BoolVar(&wdRestart, "watchdog-restart", false, "With serve, restart the worker loop when the watchdog warns; the running job is queued again")
+	flag.IntVar(&o.keepRuns, "keep-runs", 20, "Runs kept in the folder's event log when it is compacted")
+	flag.BoolVar(&o.reverse, "reverse", false, "Download from -end down to -start")
+	flag.DurationVar(&o.headGap, "head-interval", time.Second, "Minimum gap before a HEAD request to the same host (HEADs are cheap)")
+	flag.BoolVar(&o.preflight, "preflight", false, "HEAD the first and last page before starting and stop if they are missing or forbidden")
+	flag.IntVar(&o.step, "step", 1, "Only fetch every Nth number from -start (2 = 0064, 0066, ...)")
+	flag.StringVar(&organizeStr, "organize", "", "Place each series under -organize-root by source and day, e.g. host/date for downloads/<host>/<YYYY-MM-DD>/<series> (parts: host, date, month, year)")
+	flag.StringVar(&o.organizeRoot, "organize-root", "downloads", "Root of the -organize tree")
+	flag.StringVar(&o.latestLink, "latest-link", "", "After a range finishes with nothing failed, point a link by this name next to its folder at it (e.g. latest)")
+	flag.StringVar(&o.onLocked, "on-locked", "fail", "What to do when another qxdl is writing to the output folder: fail (skip the job) or wait for it to finish")
+	flag.StringVar(&o.renameFrom, "rename-start", "", "Number saved pages from this instead of the server's numbers (1 saves 0064-0140 as 0001-0077; 001 pads to 3 digits)")
+	flag.StringVar(&o.parts, "parts", "", "Tiles per page for {part} in -url: FROM-TO (1-4) or FROM-auto; padded like FROM")
+	flag.StringVar(&o.tileTmpl, "tile-template", "{num}_{part}.{ext}", "Saved filename of one tile with -parts")
+	flag.StringVar(&o.stitch, "stitch", "", "Join each page's tiles into one PNG named by -name-template: vertical, horizontal or grid:COLS")
+	flag.BoolVar(&o.keepTiles, "keep-tiles", false, "With -stitch, keep the tiles after stitching")
+	flag.StringVar(&o.onAnomaly, "on-anomaly", "off", "What to do when a page's size is far off the job's typical size: off, warn, retry or pause")
+	flag.StringVar(&mirrorStr, "mirror", "", "Comma separated mirror hosts (s2.example.com,s3.example.com) to try a page on when the primary host misses or fails it")
+	flag.StringVar(&statusStr, "on-status", "", "Per-status handling, e.g. 404=retry:2,403=abort,410=skip,5xx=backoff (actions: retry[:N], backoff[:N], skip, abort)")
+	flag.StringVar(&o.onChallenge, "on-challenge", "pause", "What to do when the host answers with an anti-bot challenge page: pause, wait (-challenge-cooldown, then retry) or abort")
+	flag.DurationVar(&o.challengeCooldown, "challenge-cooldown", 30*time.Minute, "With -on-challenge wait, how long to wait before trying the page again")
+	flag.BoolVar(&o.force, "force", false, "Fetch pages again even if they are already on disk (the old file stays until the new one is complete)")
+	flag.BoolVar(&o.forceMissing, "force-missing-only", false, "Fetch again only pages on disk that are zero-byte or, for images, corrupt or truncated")
+	flag.BoolVar(&o.checkRemoteSize, "check-remote-size", false, "HEAD pages already on disk and fetch them again when the server's Content-Length differs from the local size")
+	flag.StringVar(&o.save.tmpDir, "tmp-dir", "", "Write .part files in this folder (a scratch filesystem) and move each page into the output folder when complete")
+	flag.BoolVar(&o.save.fsync, "fsync", false, "Flush each page to disk before renaming it into place, and its folder after, so a power loss cannot leave an empty page behind (slower)")
+	flag.IntVar(&o.save.chunks.n, "chunks", 1, "Fetch a page of at least -chunk-min-size in this many byte ranges at once (at most 4), when the server takes ranges")
+	flag.StringVar(&chunkMinStr, "chunk-min-size", "64M", "Smallest page -chunks splits, e.g. 64M")
+	flag.StringVar(&maxBytesStr, "max-total-bytes", "", "Stop the run cleanly once this much has been downloaded, e.g. 500M or 2G (default no limit)")
+	flag.DurationVar(&o.maxDuration, "max-duration", 0, "Stop the run cleanly once it has run this long, e.g. 2h; the page being fetched is finished first (default no limit)")
+	flag.StringVar(&controlPath, "control", "", "Listen on this unix socket for status, pause, resume, skip-current and set-interval N while the run goes on (see qxdl ctl)")
+	flag.BoolVar(&o.interactive, "interactive", false, "Show each job's URL, folder, page count and estimated time and ask before its first request")
+	flag.BoolVar(&o.watch, "watch", false, "With -end auto, keep running and look for new pages after the last one every -poll")
+	flag.DurationVar(&o.poll, "poll", 6*time.Hour, "With -watch, how long to wait between checks for new pages")
+	flag.StringVar(&windowStr, "window", "", "Only send requests during this daily local-time window, e.g. 02:00-06:00; outside it the run waits for the window to open")
+	flag.IntVar(&o.minFreeMB, "min-free-mb", 200, "Keep at least this many MiB free in the output folder, checked before every page (0 = off)")
+	flag.StringVar(&o.onLowDisk, "on-low-disk", "pause", "What to do when -min-free-mb is reached: pause (free some space, then continue) or abort")
+	flag.BoolVar(&o.serverMtime, "server-mtime", true, "Set each saved page's modification time from the server's Last-Modified header")
+	flag.BoolVar(&o.saveHeaders, "save-headers", false, "Keep each saved page's ETag, Last-Modified, Content-Type and final URL in a .meta.json sidecar")
+	flag.BoolVar(&o.checkImages, "check-images", false, "Check every saved page is a complete PNG, JPEG, GIF or WEBP; a corrupt or truncated one is deleted and retried")
+	flag.StringVar(&convertStr, "convert", "", "Re-encode each saved page as png, jpg or webp (reads PNG, JPEG, GIF and WebP; other formats are kept)")
+	flag.BoolVar(&o.save.crc32, "crc32", false, "Also record a CRC32 of each page in the manifest, computed while it downloads")
+	flag.BoolVar(&o.save.strip, "strip-metadata", false, "Remove EXIF, XMP, IPTC, comments and PNG text chunks from each saved JPEG or PNG before it gets its final name")
+	flag.IntVar(&o.jpegQuality, "jpeg-quality", 90, "JPEG quality for -convert jpg, 1-100")
+	flag.StringVar(&o.onDuplicate, "on-duplicate", "off", "What to do when a page is byte-identical to the one before it: off, warn or skip (delete it and count the page as missing)")
+	flag.Float64Var(&o.anomalyRatio, "anomaly-ratio", 10, "How many times smaller or larger than the median page counts as an anomaly")
+	flag.StringVar(&o.optimizeCmd, "optimize-cmd", "", "Shell command run on every saved page alongside the download, e.g. \"oxipng -o2 {file}\"; {file} (or QXDL_FILE) is the page")
+	flag.IntVar(&o.optimizeWorkers, "optimize-workers", max(1, runtime.NumCPU()/2), "How many -optimize-cmd processes run at once")
+	flag.StringVar(&o.webhook, "webhook", "", "POST a JSON summary of every job to this URL when it finishes or aborts (Slack/Discord compatible)")
+	flag.StringVar(&o.execAfterFile, "exec-after-file", "", "Shell command to run after each page is fetched, missing or failed; gets QXDL_FILE, QXDL_URL, QXDL_STATUS, QXDL_PAGE and QXDL_CODE")
+	flag.StringVar(&o.execAfterRun, "exec-after-run", "", "Shell command to run after each job ends; gets QXDL_EVENT, QXDL_URL, QXDL_FOLDER, QXDL_ERROR and the QXDL_OK/SKIPPED/MISSING/FAILED counts")
+	flag.BoolVar(&o.notify, "notify", false, "Show a desktop notification when a job finishes or aborts")
+	flag.StringVar(&o.otlp, "otlp", "", "Send trace spans for jobs, pages, requests and waits to this OTLP/HTTP collector (default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	flag.StringVar(&o.logFile, "log-file", "", "Also write all output, including what -q hides, to this file in the output folder (or an absolute path)")
+	flag.IntVar(&o.logMaxMB, "log-max-size", 10, "Rotate the -log-file when it passes this many MiB (0 = never)")
+	flag.IntVar(&o.logKeep, "log-keep", 5, "Rotated -log-file copies to keep (name.1 is the newest)")
+	flag.StringVar(&harPath, "har", "", "Record every request and response of the run (headers, status, timings; no bodies) to this HTTP Archive file for browser dev tools")
+	flag.BoolVar(&harBodies, "har-bodies", false, "With -har, keep response bodies too, up to 1 MiB each")
+	flag.StringVar(&recordPath, "record", "", "Save every response of the run, bodies included, to this cassette file for -replay")
+	flag.StringVar(&replayPath, "replay", "", "Answer every request from this -record cassette instead of the network, each after its recorded latency")
+	flag.Float64Var(&replaySpeed, "replay-latency", 1, "With -replay, multiply the recorded latencies by this (0 = answer at once)")
+	flag.StringVar(&o.report, "report", "", "Write a JSON summary of the run (page counts, bytes, duration, failed URLs) to this file, or - for stdout")
+	flag.StringVar(&jobsName, "jobs", "", "YAML/JSON file listing several jobs to run one after another (replaces -url/-start)")
+	flag.BoolVar(&retryFail, "retry-failed", false, "With queue run, also retry jobs that failed before")
+	flag.StringVar(&listen, "listen", "127.0.0.1:8677", "With serve, address of the HTTP API")
+	flag.StringVar(&grpcListen, "grpc-listen", "", "With serve, also offer the gRPC API on this address, e.g. 127.0.0.1:8678")
+	flag.BoolVar(&useTUI, "tui", false, "Show a live dashboard instead of the scrolling log (keys: p pause, s skip job, q quit)")
+	flag.BoolVar(&noColor, "no-color", false, "Print the log without colors even on a terminal (as does setting NO_COLOR)")
+	flag.BoolVar(&showVersion, "version", false, "Print the version, commit, build date and Go version, then exit")
 	flag.Parse()
 
-	if rawURL == "" || startStr == "" {
+	if showVersion {
+		fmt.Println(readBuildInfo())
+		return
+	}
+	if mode == "" && jobsName == "" && !j.listed() && (j.URL == "" || j.Start == "") {
 		fmt.Println("Usage: qxdl -url <https://.../0001.png> -start 0001 [-end 0077] [-interval 6]")
-		os.Exit(2)
+		fmt.Println("       qxdl -jobs jobs.yaml [-interval 6]")
+		os.Exit(exitBadArgs)
 	}
-	if !strings.HasPrefix(rawURL, "http") {
-		exitErr(errors.New("url must start with http/https"))
+
+	switch {
+	case debug:
+		o.verbosity = lvlDebug
+	case verbose:
+		o.verbosity = lvlVerbose
+	case quiet:
+		o.verbosity = lvlQuiet
+	default:
+		o.verbosity = lvlNormal
 	}
 
-	u, err := url.Parse(rawURL)
-	if err != nil {
-		exitErr(err)
+	var err error
+	if o.exports, err = parseExports(exportStr); err != nil {
+		exitUsage(err)
 	}
-	if !isAllDigits(startStr) {
-		exitErr(errors.New("start must be digits only (e.g., 0064)"))
+	if o.shard, o.shards, err = parseShard(shardStr); err != nil {
+		exitUsage(err)
 	}
-	if endStr == "" {
-		endStr = startStr
+	if o.autoStop < 1 {
+		exitUsage(errors.New("auto-stop must be >= 1"))
 	}
-	if !isAllDigits(endStr) {
-		exitErr(errors.New("end must be digits only"))
+	if o.step < 1 {
+		exitUsage(errors.New("step must be >= 1"))
 	}
-
-	pad := len(startStr)
-	startNum := toDec(startStr)
-	endNum := toDec(endStr)
-	if endNum < startNum {
-		exitErr(fmt.Errorf("end (%d) must be >= start (%d)", endNum, startNum))
+	if o.convert, err = parseConvert(convertStr); err != nil {
+		exitUsage(err)
+	}
+	if o.optimizeWorkers < 1 {
+		exitUsage(errors.New("optimize-workers must be >= 1"))
+	}
+	if o.jpegQuality < 1 || o.jpegQuality > 100 {
+		exitUsage(errors.New("jpeg-quality must be 1-100"))
+	}
+	if o.organize, err = parseOrganize(organizeStr); err != nil {
+		exitUsage(err)
+	}
+	if strings.ContainsAny(o.latestLink, `/\`) || o.latestLink == "." || o.latestLink == ".." {
+		exitUsage(errors.New("latest-link must be a plain name"))
+	}
+	switch o.retryAfterPolicy {
+	case "cap", "honor", "abort":
+	default:
+		exitUsage(errors.New("retry-after-policy must be cap, honor or abort"))
+	}
+	if o.onLocked != "fail" && o.onLocked != "wait" {
+		exitUsage(errors.New("on-locked must be fail or wait"))
+	}
+	if !isAllDigits(o.renameFrom) {
+		exitUsage(errors.New("rename-start must be a number"))
+	}
+	if o.logMaxMB < 0 || o.logKeep < 0 {
+		exitUsage(errors.New("log-max-size and log-keep must be >= 0"))
+	}
+	if err := parseAnomalyAction(o.onAnomaly); err != nil {
+		exitUsage(err)
+	}
+	if windowStr != "" {
+		if o.window, err = parseWindow(windowStr); err != nil {
+			exitUsage(err)
+		}
+	}
+	if o.save.chunks.n < 1 || o.save.chunks.n > maxChunks {
+		exitUsage(fmt.Errorf("-chunks must be 1 to %d", maxChunks))
+	}
+	if o.save.chunks.min, err = parseSize(chunkMinStr); err != nil {
+		exitUsage(err)
+	}
+	if o.save.tmpDir != "" {
+		if err := os.MkdirAll(o.save.tmpDir, 0o755); err != nil {
+			exitUsage(fmt.Errorf("tmp-dir: %w", err))
+		}
+	}
+	if maxBytesStr != "" {
+		if o.maxTotalBytes, err = parseSize(maxBytesStr); err != nil {
+			exitUsage(fmt.Errorf("max-total-bytes: %w", err))
+		}
+	}
+	o.altExts = parseAltExts(altExtStr)
+	if err := parseDiskAction(o.onLowDisk); err != nil {
+		exitUsage(err)
+	}
+	if o.force && o.forceMissing {
+		exitUsage(errors.New("-force and -force-missing-only cannot be combined"))
+	}
+	if err := parseDupAction(o.onDuplicate); err != nil {
+		exitUsage(err)
+	}
+	if err := parseBackoffStrategy(o.backoffStrategy); err != nil {
+		exitUsage(err)
+	}
+	if o.backoffReset, err = parseBackoffReset(resetStr); err != nil {
+		exitUsage(err)
+	}
+	if o.backoffSteps < 1 {
+		exitUsage(errors.New("-backoff-max-steps must be at least 1"))
+	}
+	if o.onStatus, err = parseStatusPolicy(statusStr); err != nil {
+		exitUsage(err)
+	}
+	if err := parseChallengeAction(o.onChallenge); err != nil {
+		exitUsage(err)
+	}
+	if o.mirrors, err = parseMirrors(mirrorStr); err != nil {
+		exitUsage(err)
+	}
+	if o.parts != "" {
+		if o.partFirst, o.partLast, o.partPad, err = parseParts(o.parts); err != nil {
+			exitUsage(err)
+		}
+		if !strings.Contains(o.tileTmpl, "{part}") {
+			exitUsage(errors.New("tile-template needs {part}"))
+		}
+	}
+	if o.stitch != "" {
+		if o.parts == "" {
+			exitUsage(errors.New("-stitch needs -parts"))
+		}
+		if o.stitchLayout, err = parseStitch(o.stitch); err != nil {
+			exitUsage(err)
+		}
+	}
+	if o.watch {
+		switch {
+		case mode != "" || jobsName != "":
+			exitUsage(errors.New("-watch works with a single -url job"))
+		case j.FromFeed != "":
+			// each round lists what the feed gained since the last
+		case j.End != "auto" || j.ChapStart != "" || j.listed():
+			exitUsage(errors.New("-watch needs -end auto and no {chap}, -url-cmd, -from-page or -from-json, or -from-feed"))
+		case o.poll < time.Minute:
+			exitUsage(errors.New("-poll must be at least 1m"))
+		}
+	}
+	var jobs []job
+	if mode == "" {
+		jobs = []job{j}
+	}
+	if jobsName != "" {
+		if jobs, err = loadJobs(jobsName); err != nil {
+			exitUsage(err)
+		}
+	}
+	for i := range jobs {
+		jo, err := jobs[i].apply(o)
+		if err == nil {
+			err = jobs[i].validate(jo)
+		}
+		if err != nil {
+			exitUsage(fmt.Errorf("job %d: %w", i+1, err))
+		}
 	}
 
-	dirURL := path.Dir(u.Path) + "/"
-	base := u.Scheme + "://" + u.Host + dirURL
-	folder := filepath.Base(path.Dir(u.Path))
-	if folder == "." || folder == "/" || folder == "" {
-		folder = "downloads"
+	var tc *transportConfig
+	if tcFile != "" {
+		if tc, err = loadTransportConfig(tcFile); err != nil {
+			exitUsage(err)
+		}
+		if tc.Timeouts.Request > 0 && !flagSet("timeout") {
+			o.timeout = int(time.Duration(tc.Timeouts.Request).Round(time.Second) / time.Second)
+		}
+	}
+	if tc == nil {
+		tc = &transportConfig{}
+	}
+	tc.TLS.override(tlsFlags)
+	if err := tc.applyCredentials(credentials); err != nil {
+		exitUsage(err)
+	}
+	switch {
+	case ipv4 && ipv6:
+		exitUsage(errors.New("-4 and -6 cannot be combined"))
+	case ipv4:
+		tc.IPVersion = 4
+	case ipv6:
+		tc.IPVersion = 6
+	}
+	for _, r := range resolve {
+		hp, ip, err := parseResolve(r)
+		if err != nil {
+			exitUsage(err)
+		}
+		if tc.Resolve == nil {
+			tc.Resolve = map[string]string{}
+		}
+		tc.Resolve[hp] = ip
+	}
+	if flagSet("keep-alive") {
+		tc.Conns.KeepAlive = &keepAlive
+	}
+	if flagSet("http2") {
+		tc.Conns.HTTP2 = &useHTTP2
+	}
+	if flagSet("max-redirects") {
+		tc.Redirect.Max = &maxRedirs
+	}
+	if flagSet("cross-host-redirects") {
+		tc.Redirect.CrossHost = &crossHost
+	}
+	if flagSet("trust-redirects") {
+		tc.Redirect.Trust = trustRedirs
 	}
-	if err := os.MkdirAll(folder, 0o755); err != nil {
+	if tc.Redirect.Max != nil && *tc.Redirect.Max < 0 {
+		exitUsage(errors.New("-max-redirects must not be negative"))
+	}
+	if flagSet("max-idle-conns") || tc.Conns.MaxIdle == 0 {
+		tc.Conns.MaxIdle = maxIdle
+	}
+	if flagSet("idle-timeout") || tc.Timeouts.IdleConn == 0 {
+		tc.Timeouts.IdleConn = duration(idleTO)
+	}
+	if tc.TLS.Insecure {
+		fmt.Println("[WARN] TLS certificates are not verified; anyone on the path can read and change the traffic")
+	}
+	client, err := newHTTPClient(tc, time.Duration(o.timeout)*time.Second)
+	if err != nil {
+		exitUsage(err)
+	}
+	switch {
+	case recordPath != "" && replayPath != "":
+		exitUsage(errors.New("-record and -replay cannot be used together"))
+	case recordPath != "":
+		client.Transport = startRecording(recordPath, client.Transport)
+		defer stopRecording()
+	case replayPath != "":
+		if replaySpeed < 0 {
+			exitUsage(errors.New("-replay-latency must not be negative"))
+		}
+		p, err := loadCassette(replayPath, replaySpeed)
+		if err != nil {
+			exitUsage(err)
+		}
+		client.Transport = p
+		fmt.Printf("[WARN] replaying %s; no request goes to the network\n", replayPath)
+	}
+	if o.verbosity >= lvlVerbose || o.logFile != "" {
+		client.Transport = &dumpTransport{next: client.Transport, verbosity: o.verbosity}
+	}
+	if harPath != "" {
+		client.Transport = startHAR(harPath, harBodies, client.Transport)
+		defer stopHAR()
+	} else if harBodies {
+		exitUsage(errors.New("-har-bodies needs -har"))
+	}
+	if o.interactive && (useTUI || mode == "serve") {
+		exitUsage(errors.New("-interactive asks on the terminal; it cannot be used with -tui or serve"))
+	}
+	if useTUI {
+		if mode == "serve" {
+			exitUsage(errors.New("-tui cannot be used with serve"))
+		}
+		// the dashboard is fed from the verbose log
+		o.verbosity = max(o.verbosity, lvlNormal)
+	}
+	if outputMode != "" {
+		if useTUI || mode == "serve" {
+			exitUsage(errors.New("-output cannot be used with -tui or serve"))
+		}
+		if name := o.needsDisk(); name != "" {
+			exitUsage(fmt.Errorf("%s needs the pages on disk; it cannot be used with -output", name))
+		}
+		// the stream owns stdout; everything else is printed to stderr
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		if runOutput, err = newPageSink(outputMode, stdout); err != nil {
+			exitUsage(err)
+		}
+		defer stopOutput()
+	}
+	if !useTUI && wantColor(os.Stdout, noColor) {
+		if err := startColor(); err != nil {
+			exitErr(err)
+		}
+		defer stopColor()
+	}
+	s, err := newSession(o, client)
+	if err != nil {
 		exitErr(err)
 	}
-
-	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
-	if !quiet {
-		fmt.Printf("BASE: %s\nFOLDER: %s\nSTART: %s  END: %s  PAD: %d  (interval: %ds, jitter: ±%d%%)\n\n",
-			base, folder, startStr, endStr, pad, interval, int(jitterFrac*100))
+	if o.logFile != "" {
+		if err := startLogFile(o.logFile, int64(o.logMaxMB)<<20, o.logKeep); err != nil {
+			exitErr(err)
+		}
+		defer stopLogFile()
 	}
-
-	consecErrors := 0
-
-	for i := startNum; i <= endNum; i++ {
-		numStr := fmt.Sprintf("%0*d", pad, i)
-		urlNow := fmt.Sprintf("%s%s.%s", base, numStr, ext)
-		fileNow := filepath.Join(folder, numStr+"."+ext)
-
-		if _, err := os.Stat(fileNow); err == nil {
-			if !quiet {
-				fmt.Printf("[skip] %s exists\n", filepath.Base(fileNow))
-			}
-			// small polite delay even on skip to avoid bursty index scanning
-			sleepWithJitter(time.Duration(interval)*time.Second, jitterFrac, quiet)
-			continue
+	exitOnSignal(s)
+	pauseOnSignal(s.paused)
+	if controlPath != "" {
+		if err := s.listenControl(controlPath); err != nil {
+			exitErr(err)
 		}
-
-		if !quiet {
-			fmt.Printf("[get ] %s\n", urlNow)
+		defer stopControl()
+	}
+	if useTUI {
+		s.ctl = newJobControl()
+		if err := startTUI(s); err != nil {
+			exitErr(err)
 		}
-		res := downloadFile(client, urlNow, fileNow, ua, time.Duration(timeout)*time.Second)
-
-		if res.Err != nil || (res.StatusCode >= 400 && res.StatusCode != 404) {
-			consecErrors++
-			if !quiet {
-				fmt.Printf("[fail] %s (%v, status=%d)\n", urlNow, res.Err, res.StatusCode)
-			}
-			if consecErrors >= maxErrors {
-				fmt.Printf("Too many consecutive errors (%d). Stopping politely.\n", consecErrors)
-				break
-			}
+	}
 
-			// Decide polite wait
-			wait := time.Duration(interval) * time.Second
-			if res.StatusCode == http.StatusTooManyRequests && res.RetryAfter > 0 {
-				wait = res.RetryAfter
-			} else if res.StatusCode == http.StatusServiceUnavailable && res.RetryAfter > 0 {
-				wait = res.RetryAfter
-			} else {
-				// exponential backoff based on consecutive errors
-				m := math.Pow(backoff, float64(min(consecErrors, 6)))
-				wait = time.Duration(float64(wait) * m)
-			}
-			if wait > time.Duration(maxWait)*time.Second {
-				wait = time.Duration(maxWait) * time.Second
-			}
-			sleepWithJitter(wait, jitterFrac, quiet)
-			// retry current i up to 'retries'
-			ok := false
-			for attempt := 1; attempt <= retries; attempt++ {
-				if !quiet {
-					fmt.Printf("[retry %d/%d] %s\n", attempt, retries, urlNow)
-				}
-				res = downloadFile(client, urlNow, fileNow, ua, time.Duration(timeout)*time.Second)
-				if res.Err == nil && res.StatusCode == 200 {
-					if !quiet {
-						fmt.Printf("[ ok ] %s\n", filepath.Base(fileNow))
-					}
-					ok = true
-					consecErrors = 0
-					break
-				}
-				// wait a bit before next retry
-				rw := time.Duration(interval) * time.Second
-				if res.RetryAfter > 0 {
-					rw = res.RetryAfter
-				}
-				sleepWithJitter(rw, jitterFrac, quiet)
-			}
-			if !ok {
-				// give up on this file, proceed to next politely
-				continue
-			}
-		} else {
-			if !quiet {
-				fmt.Printf("[ ok ] %s\n", filepath.Base(fileNow))
-			}
-			consecErrors = 0
+	var srv *server
+	if mode == "serve" {
+		srv = newServer(s)
+		if wdRestart {
+			wd.onTrip = srv.restart
 		}
+	}
+	if wd.every > 0 {
+		wd.maxHeap = uint64(wdHeapMB) << 20
+		stop := make(chan struct{})
+		defer close(stop)
+		go wd.run(stop)
+	}
 
-		if i < endNum {
-			// polite wait between files
-			sleepWithJitter(time.Duration(interval)*time.Second, jitterFrac, quiet)
+	switch mode {
+	case "queue run":
+		drainQueue(s, retryFail)
+		return
+	case "serve":
+		if err := srv.serve(listen, grpcListen); err != nil {
+			exitErr(err)
 		}
+		return
+	}
+	if jobsName != "" {
+		runJobs(s, jobs)
+		return
+	}
+	res, err := s.runJob(j)
+	if err == nil && o.watch {
+		res = s.watch(j, res)
+	}
+	s.optimized()
+	s.writeReport()
+	if err != nil {
+		exitErr(err)
 	}
 
-	if !quiet {
-		fmt.Println("Done.")
+	stopTUI()
+	w := logAt(o.verbosity, lvlNormal)
+	for _, line := range s.pace.summary() {
+		fmt.Fprintln(w, "Requests to", line)
+	}
+	if lines := s.stats.lines(); lines != nil {
+		fmt.Fprintln(w, "Stats:")
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+	if s.slowdowns > 0 {
+		fmt.Fprintf(w, "Interval doubled %d time(s) after repeated 5xx; ended at %v.\n",
+			s.slowdowns, time.Duration(o.interval)*time.Second<<s.slowdowns)
+	}
+	if res.Chapters > 0 {
+		fmt.Fprintf(w, "Done: %d chapter(s) with pages.\n", res.Chapters)
+	} else if res.EndFound != "" {
+		fmt.Fprintf(w, "Done: end of range detected after page %s (%d consecutive 404s).\n", res.EndFound, o.autoStop)
+	} else {
+		fmt.Fprintln(w, "Done.")
+	}
+	if code := jobExitCode(res, nil); code != exitOK {
+		exit(code)
 	}
 }
 
-func sleepWithJitter(base time.Duration, jitterFrac float64, quiet bool) {
+// sleepWithJitter sleeps base ± jitterFrac through sl, or until ctx is
+// done, and returns how long it slept.
+func sleepWithJitter(ctx context.Context, sl sleeper, base time.Duration, jitterFrac float64, verbosity int) time.Duration {
 	if base <= 0 {
-		return
+		return 0
 	}
 	// jitter in ±jitterFrac range
 	j := time.Duration(float64(base) * jitterFrac)
@@ -203,14 +721,41 @@ func sleepWithJitter(base time.Duration, jitterFrac float64, quiet bool) {
 	if wait < 0 {
 		wait = 0
 	}
-	if !quiet {
-		fmt.Printf("waiting %v...\n", wait.Round(time.Millisecond))
+	fmt.Fprintf(logAt(verbosity, lvlVerbose), "[wait] base %v, jitter ±%d%% drew %+v\n",
+		base, int(jitterFrac*100), delta.Round(time.Millisecond))
+	fmt.Fprintf(logAt(verbosity, lvlNormal), "waiting %v...\n", wait.Round(time.Millisecond))
+	return sl.Sleep(ctx, wait)
+}
+
+// headURL asks for a page's status and size without transferring the body.
+func headURL(ctx context.Context, client *http.Client, urlNow, ua string, timeout time.Duration) dlResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", urlNow, nil)
+	if err != nil {
+		return dlResult{Err: err}
+	}
+	req.Header.Set("User-Agent", ua)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return dlResult{Err: err}
+	}
+	resp.Body.Close()
+
+	res := dlResult{StatusCode: resp.StatusCode, Size: resp.ContentLength, Limit: parseRateLimit(resp.Header), Meta: metaFromResponse(resp)}
+	if dur, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		res.RetryAfter = dur
 	}
-	time.Sleep(wait)
+	return res
 }
 
-func downloadFile(client *http.Client, urlNow, fileNow, ua string, timeout time.Duration) dlResult {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+// downloadFile fetches urlNow into fileNow via a .part file, or hands the
+// whole body to sink when it is set. With autoExt, fileNow is a stem and the
+// extension is taken from the response.
+func downloadFile(ctx context.Context, client *http.Client, urlNow, fileNow, ua string, autoExt bool, timeout time.Duration, sink pageSink, sv saving) (res dlResult) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", urlNow, nil)
@@ -218,6 +763,7 @@ func downloadFile(client *http.Client, urlNow, fileNow, ua string, timeout time.
 		return dlResult{Err: err}
 	}
 	req.Header.Set("User-Agent", ua)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -225,7 +771,10 @@ func downloadFile(client *http.Client, urlNow, fileNow, ua string, timeout time.
 	}
 	defer resp.Body.Close()
 
-	res := dlResult{StatusCode: resp.StatusCode}
+	res = dlResult{StatusCode: resp.StatusCode, Limit: parseRateLimit(resp.Header)}
+	wire := &countingReader{r: resp.Body}
+	var ranged int64 // received by -chunks' extra requests
+	defer func() { res.Wire = wire.n + ranged }()
 
 	// Parse Retry-After if any (delta-seconds or HTTP date)
 	if ra := resp.Header.Get("Retry-After"); ra != "" {
@@ -234,11 +783,51 @@ func downloadFile(client *http.Client, urlNow, fileNow, ua string, timeout time.
 		}
 	}
 
+	decoded, err := decodeBody(wire, resp.Header.Get("Content-Encoding"))
+	if err != nil && resp.StatusCode == http.StatusOK {
+		res.Err = err
+		return res
+	} else if err != nil {
+		decoded = wire // an error page that is not worth failing over
+	}
+	br := bufio.NewReaderSize(decoded, challengePeek)
+	if isChallenge(resp, br) {
+		res.Challenge = true
+		return res
+	}
 	if resp.StatusCode != http.StatusOK {
 		return res
 	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		res.Modified = t
+	}
+	res.Meta = metaFromResponse(resp)
+
+	var body io.Reader = br
+	if autoExt {
+		head, _ := br.Peek(512)
+		fileNow += "." + detectExt(resp.Header.Get("Content-Type"), head)
+	}
+
+	if sink != nil {
+		// read it all first, so a broken transfer never reaches the stream
+		b, err := io.ReadAll(body)
+		res.Size = int64(len(b))
+		sum := newPageSum(sv.crc32)
+		sum.Write(b)
+		res.SHA256, res.CRC32 = sum.sums()
+		if err == nil {
+			err = sink.put(fileNow, b, res.Modified)
+		}
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.File = fileNow
+		return res
+	}
 
-	tmp := fileNow + ".part"
+	tmp := sv.partName(fileNow)
 	f, err := os.Create(tmp)
 	if err != nil {
 		res.Err = err
@@ -246,18 +835,56 @@ func downloadFile(client *http.Client, urlNow, fileNow, ua string, timeout time.
 	}
 	defer f.Close()
 
-	if _, err := io.Copy(f, resp.Body); err != nil {
+	var n int64
+	if sv.chunks.use(resp) {
+		// the chunks arrive out of order; the manifest hashes the file instead
+		if ranged, err = fetchChunks(ctx, client, req, resp, body, f, sv.chunks.n); err == nil {
+			n = resp.ContentLength
+		}
+	} else {
+		sum := newPageSum(sv.crc32)
+		if n, err = io.Copy(f, io.TeeReader(body, sum)); err == nil {
+			res.SHA256, res.CRC32 = sum.sums()
+		}
+	}
+	res.Size = n
+	if err != nil {
 		res.Err = err
 		return res
 	}
+	if sv.fsync {
+		// the data must be on disk before the name points at it
+		if err := f.Sync(); err != nil {
+			res.Err = err
+			return res
+		}
+	}
 	if err := f.Close(); err != nil {
 		res.Err = err
 		return res
 	}
-	if err := os.Rename(tmp, fileNow); err != nil {
+	if sv.strip {
+		if cut, err := stripFile(tmp, sv.fsync); err != nil {
+			fmt.Printf("[WARN] strip metadata from %s: %v; kept as is\n", filepath.Base(fileNow), err)
+		} else if cut > 0 {
+			res.Remote = res.Size
+			res.Size -= int64(cut) // what is on disk, for the manifest
+			if res.SHA256 != "" {
+				res.SHA256, res.CRC32, _ = hashFile(tmp, sv.crc32)
+			}
+		}
+	}
+	if err := sv.moveIntoPlace(tmp, fileNow); err != nil {
 		res.Err = err
 		return res
 	}
+	if sv.fsync {
+		if err := syncDir(filepath.Dir(fileNow)); err != nil {
+			res.Err = err
+			return res
+		}
+	}
+	res.File = fileNow
 	return res
 }
 
@@ -301,9 +928,106 @@ func toDec(s string) int {
 	return n
 }
 
+// listFlag collects a flag that may be given several times.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Exit codes, so wrappers can tell outcomes apart. A run of several jobs
+// exits with the worst code of its jobs, ranked as listed.
+const (
+	exitOK          = 0
+	exitMissing     = 3   // completed, but some pages were missing or failed
+	exitInterrupted = 130 // Ctrl-C, SIGTERM, q in the dashboard, a canceled job, -max-total-bytes or -max-duration
+	exitAborted     = 4   // stopped by -max-errors
+	exitError       = 1   // a job could not run or the run itself failed
+	exitBadArgs     = 2   // invalid arguments or configuration
+)
+
+var exitRank = []int{exitOK, exitMissing, exitInterrupted, exitAborted, exitError}
+
+func jobExitCode(res jobResult, err error) int {
+	switch {
+	case err != nil:
+		return exitError
+	case res.Aborted:
+		return exitAborted
+	case res.Canceled, res.Stopped:
+		return exitInterrupted
+	case res.Pages.Missing > 0 || res.Pages.Failed > 0:
+		return exitMissing
+	}
+	return exitOK
+}
+
+// worseExit picks the more serious of two exit codes.
+func worseExit(a, b int) int {
+	if slices.Index(exitRank, b) > slices.Index(exitRank, a) {
+		return b
+	}
+	return a
+}
+
+// exit gives the terminal back, flushes the log file and exits.
+func exit(code int) {
+	stopTUI()
+	stopOutput()
+	stopHAR()
+	stopRecording()
+	stopControl()
+	stopLogFile()
+	stopColor()
+	os.Exit(code)
+}
+
 func exitErr(err error) {
+	stopTUI()
 	fmt.Println("[ERROR]", err)
-	os.Exit(1)
+	exit(exitError)
+}
+
+func exitUsage(err error) {
+	fmt.Println("[ERROR]", err)
+	exit(exitBadArgs)
+}
+
+// exitOnSignal stops the run on Ctrl-C or SIGTERM: waits and requests in
+// flight end at once and the job stops as if its budget ran out, saving its
+// state, so the run exits with exitInterrupted. A second signal, or a run
+// that has not wound down after stopGrace (serve never does), exits there
+// and then, after the dashboard and the log file are closed properly.
+func exitOnSignal(s *session) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		fmt.Println("Interrupted; stopping (again to quit at once).")
+		s.stop(errInterrupted)
+		t := time.NewTimer(stopGrace)
+		select {
+		case <-sig:
+		case <-t.C:
+		}
+		stopTUI()
+		fmt.Println("Interrupted.")
+		exit(exitInterrupted)
+	}()
 }
 
 func min(a, b int) int {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("120"); !ok || d != 2*time.Minute {
+		t.Errorf("delta: %v %v", d, ok)
+	}
+	if d, ok := parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)); !ok || d != 0 {
+		t.Errorf("past date: %v %v", d, ok)
+	}
+	if d, ok := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); !ok || d < 59*time.Minute {
+		t.Errorf("date an hour ahead: %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("later"); ok {
+		t.Error("garbage was accepted")
+	}
+}
+
+func TestDownloadHashesWhileCopying(t *testing.T) {
+	body := []byte("not really a png, but bytes all the same")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "001.png")
+	res := downloadFile(context.Background(), srv.Client(), srv.URL, file, defaultUA, false, 5*time.Second, nil, saving{crc32: true})
+	if res.Err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("download: %d %v", res.StatusCode, res.Err)
+	}
+	want, err := fileSHA256(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SHA256 != want {
+		t.Errorf("SHA256 = %q, want %q", res.SHA256, want)
+	}
+	if crc := fmt.Sprintf("%08x", crc32.ChecksumIEEE(body)); res.CRC32 != crc {
+		t.Errorf("CRC32 = %q, want %q", res.CRC32, crc)
+	}
+
+	res = downloadFile(context.Background(), srv.Client(), srv.URL, file, defaultUA, false, 5*time.Second, nil, saving{})
+	if res.SHA256 != want || res.CRC32 != "" {
+		t.Errorf("without -crc32: %q %q", res.SHA256, res.CRC32)
+	}
+}
+
+// The subcommands return the named exit codes, so the README's table cannot
+// drift from what they do.
+func TestSubcommandsUseExitCodeNames(t *testing.T) {
+	fset := token.NewFileSet()
+	files, _ := filepath.Glob("*.go")
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range f.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "cmd") || fn.Body == nil {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				if _, ok := n.(*ast.FuncLit); ok {
+					return false
+				}
+				if r, ok := n.(*ast.ReturnStmt); ok && len(r.Results) == 1 {
+					if _, lit := r.Results[0].(*ast.BasicLit); lit {
+						t.Errorf("%s: %s returns a literal exit code", fset.Position(r.Pos()), fn.Name.Name)
+					}
+				}
+				return true
+			})
+		}
+	}
+}
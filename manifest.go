@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The manifest is the folder's record of where every page came from, kept
+// across runs: its source URL, what is on disk (size and SHA-256), when it
+// was fetched and the outcome of every run that asked for it. The state file
+// says what one run did; the manifest says what the folder holds.
+
+const (
+	manifestFile    = "qxdl-manifest.json"
+	manifestVersion = 1
+	// maxAttempts keeps a page's history short on a folder refreshed daily
+	maxAttempts = 20
+)
+
+type manifest struct {
+	Version int                      `json:"version"`
+	Pages   map[string]*manifestPage `json:"pages"` // by file name
+
+	name string
+}
+
+type manifestPage struct {
+	Num      int        `json:"num"`
+	URL      string     `json:"url"`
+	Status   string     `json:"status"` // of the latest request; a skipped page keeps it
+	Bytes    int64      `json:"bytes,omitempty"`
+	Remote   int64      `json:"remote_bytes,omitempty"` // as the server sent it, if -strip-metadata or -convert changed it
+	SHA256   string     `json:"sha256,omitempty"`
+	CRC32    string     `json:"crc32,omitempty"`
+	ETag     string     `json:"etag,omitempty"`
+	Modified *time.Time `json:"modified,omitempty"` // the server's Last-Modified
+	First    *time.Time `json:"first_fetched,omitempty"`
+	Last     *time.Time `json:"last_fetched,omitempty"`
+	Attempts []attempt  `json:"attempts,omitempty"`
+}
+
+// attempt is one run's outcome for a page.
+type attempt struct {
+	Time   time.Time `json:"time"`
+	Run    string    `json:"run"`
+	Status string    `json:"status"`
+	Code   int       `json:"code,omitempty"`
+	Err    string    `json:"error,omitempty"`
+}
+
+func loadManifest(folder string) (*manifest, error) {
+	m := &manifest{Version: manifestVersion, Pages: map[string]*manifestPage{}, name: filepath.Join(folder, manifestFile)}
+	b, err := os.ReadFile(m.name)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", m.name, err)
+	}
+	if m.Version > manifestVersion {
+		return nil, fmt.Errorf("%s: version %d is newer than this qxdl knows (%d)", m.name, m.Version, manifestVersion)
+	}
+	if m.Pages == nil {
+		m.Pages = map[string]*manifestPage{}
+	}
+	return m, nil
+}
+
+// add records a page outcome. A saved page is hashed; a skipped one only
+// when the manifest does not know it yet or its size changed.
+func (m *manifest) add(run string, ps pageState, file string, res dlResult) {
+	key := filepath.Base(file)
+	p := m.Pages[key]
+	if p == nil {
+		p = &manifestPage{}
+		m.Pages[key] = p
+	}
+	p.Num, p.URL = ps.Num, ps.URL
+	now := time.Now().UTC().Truncate(time.Second)
+	switch ps.Status {
+	case pageSkipped:
+		if p.Status == "" {
+			p.Status = pageOK // fetched before the manifest, or by hand
+		}
+		fi, err := os.Stat(file)
+		if err != nil || p.SHA256 != "" && fi.Size() == p.Bytes {
+			return
+		}
+		p.Bytes = fi.Size()
+		p.SHA256, _ = fileSHA256(file)
+		p.CRC32 = ""
+		return
+	case pageOK:
+		p.Bytes, p.Remote = res.Size, res.Remote
+		p.SHA256, p.CRC32 = res.SHA256, res.CRC32
+		if p.SHA256 == "" {
+			p.SHA256, _ = fileSHA256(file)
+		}
+		if res.Meta != nil {
+			p.ETag = res.Meta.ETag
+		}
+		if !res.Modified.IsZero() {
+			t := res.Modified.UTC()
+			p.Modified = &t
+		}
+		if p.First == nil {
+			p.First = &now
+		}
+		p.Last = &now
+	}
+	p.Status = ps.Status
+	p.Attempts = append(p.Attempts, attempt{Time: now, Run: run, Status: ps.Status, Code: ps.Code, Err: ps.Err})
+	if len(p.Attempts) > maxAttempts {
+		p.Attempts = p.Attempts[len(p.Attempts)-maxAttempts:]
+	}
+}
+
+func (m *manifest) save() error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.name+".part", b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(m.name+".part", m.name)
+}
+
+// remoteSize is the size the server should report for file: the size it
+// sent, as recorded, while the file on disk is still the one recorded,
+// otherwise onDisk.
+func (m *manifest) remoteSize(file string, onDisk int64) int64 {
+	if m == nil {
+		return onDisk
+	}
+	p := m.Pages[filepath.Base(file)]
+	if p == nil || p.Remote == 0 || p.Bytes != onDisk {
+		return onDisk
+	}
+	return p.Remote
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Many CDNs serve the same files from s1/s2/s3 subdomains. With -mirror, a
+// page the primary host would not give (missing, or failed after its
+// retries) is asked for on each mirror in turn, same path and query.
+
+func parseMirrors(v string) ([]string, error) {
+	var out []string
+	for _, m := range strings.Split(v, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		check := m
+		if !strings.Contains(m, "://") {
+			check = "http://" + m
+		}
+		u, err := url.Parse(check)
+		if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("mirror must be a host like s2.example.com or https://s2.example.com (got %q)", m)
+		}
+		out = append(out, strings.TrimSuffix(m, "/"))
+	}
+	return out, nil
+}
+
+// mirrorURL is pageURL on mirror m, which may bring its own scheme.
+func mirrorURL(pageURL, m string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return pageURL
+	}
+	if scheme, host, ok := strings.Cut(m, "://"); ok {
+		u.Scheme, u.Host = scheme, host
+	} else {
+		u.Host = m
+	}
+	return u.String()
+}
+
+// fromMirrors tries the page on every mirror and returns the first good
+// answer and its URL.
+func (jr *jobRun) fromMirrors(pageURL, fileNow string) (dlResult, string, bool) {
+	for _, m := range jr.o.mirrors {
+		mu := mirrorURL(pageURL, m)
+		fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[mirr] %s\n", mu)
+		dres := jr.get(mu, fileNow)
+		if dres.Err == nil && dres.StatusCode == http.StatusOK && !dres.Challenge {
+			return dres, mu, true
+		}
+		fmt.Fprintf(logAt(jr.o.verbosity, lvlVerbose), "[why ] mirror %s: %v, status=%d\n", m, dres.Err, dres.StatusCode)
+	}
+	return dlResult{}, "", false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// jobReport is what a finished job tells the outside world.
+type jobReport struct {
+	Event       string      `json:"event"` // finished, aborted, canceled, stopped or failed
+	URL         string      `json:"url"`
+	Folder      string      `json:"folder"`
+	Started     time.Time   `json:"started"`
+	Duration    float64     `json:"duration_seconds"`
+	Error       string      `json:"error,omitempty"`
+	Banned      bool        `json:"banned,omitempty"`
+	Chapters    int         `json:"chapters,omitempty"`
+	EndFound    string      `json:"end_found,omitempty"`
+	Pages       jobProgress `json:"pages"`
+	FailedPages []int       `json:"failed_pages"`
+	FailedURLs  []string    `json:"failed_urls"`
+
+	// Text and Content carry the one-line summary for Slack and Discord
+	// incoming webhooks, which only show those fields.
+	Text    string `json:"text,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+func newJobReport(j job, res jobResult, err error, took time.Duration) jobReport {
+	r := jobReport{
+		Event: "finished", URL: j.URL, Folder: j.folder(), Started: time.Now().Add(-took),
+		Duration: took.Round(time.Millisecond).Seconds(), Banned: res.Banned, Chapters: res.Chapters,
+		EndFound: res.EndFound, Pages: res.Pages, FailedPages: res.FailedPages, FailedURLs: res.FailedURLs,
+	}
+	if r.FailedPages == nil {
+		r.FailedPages, r.FailedURLs = []int{}, []string{}
+	}
+	switch {
+	case err != nil:
+		r.Event, r.Error = "failed", err.Error()
+	case res.Canceled:
+		r.Event = "canceled"
+	case res.Aborted:
+		r.Event = "aborted"
+	case res.Stopped:
+		r.Event = "stopped"
+	}
+	r.Text = fmt.Sprintf("qxdl %s: %s -> %s in %v (ok %d, skipped %d, missing %d, failed %d)",
+		r.Event, r.URL, r.Folder, took.Round(time.Second), r.Pages.OK, r.Pages.Skipped, r.Pages.Missing, r.Pages.Failed)
+	if r.Error != "" {
+		r.Text += ": " + r.Error
+	}
+	r.Content = r.Text
+	return r
+}
+
+// finished runs after every job, however it ended.
+func (s *session) finished(j job, res jobResult, err error, took time.Duration) {
+	if s.o.webhook == "" && !s.o.notify && s.o.report == "" && s.o.execAfterRun == "" {
+		return
+	}
+	r := newJobReport(j, res, err, took)
+	if s.o.execAfterRun != "" {
+		s.runHookFor(r)
+	}
+	if s.o.report != "" {
+		s.reports = append(s.reports, r)
+	}
+	if s.o.webhook != "" {
+		if err := postWebhook(s.o.webhook, r); err != nil {
+			fmt.Println("[WARN] webhook:", err)
+		}
+	}
+	if s.o.notify {
+		body := fmt.Sprintf("%s: ok %d, missing %d, failed %d", r.Folder, r.Pages.OK, r.Pages.Missing, r.Pages.Failed)
+		if r.Error != "" {
+			body = r.Folder + ": " + r.Error
+		}
+		if err := desktopNotify("qxdl "+r.Event, body); err != nil {
+			fmt.Println("[WARN] notify:", err)
+		}
+	}
+}
+
+// desktopNotify shows a native notification. Title and body travel in the
+// environment so no quoting can break the script.
+func desktopNotify(title, body string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e",
+			`display notification (system attribute "QXDL_BODY") with title (system attribute "QXDL_TITLE")`)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToast)
+	default:
+		cmd = exec.Command("notify-send", "--app-name=qxdl", title, body)
+	}
+	cmd.Env = append(os.Environ(), "QXDL_TITLE="+title, "QXDL_BODY="+body)
+	out, err := cmd.CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+	return err
+}
+
+const windowsToast = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName('text')
+$x.Item(0).AppendChild($t.CreateTextNode($env:QXDL_TITLE)) > $null
+$x.Item(1).AppendChild($t.CreateTextNode($env:QXDL_BODY)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('qxdl').Show([Windows.UI.Notifications.ToastNotification]::new($t))
+`
+
+// postWebhook sends the report with its own short-lived client: the hook is
+// not the site being downloaded, so it is neither paced nor proxied like it.
+func postWebhook(url string, r jobReport) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	c := &http.Client{Timeout: 15 * time.Second}
+	resp, err := c.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -optimize-cmd runs a command such as an image optimizer on every saved
+// page, in -optimize-workers processes of its own. Pages queue up without
+// limit, so a slow optimizer never holds back the next request; a job waits
+// for its pages only before -export and -pack, which need the final files.
+
+type optimizer struct {
+	command   string
+	verbosity int
+
+	mu      sync.Mutex
+	changed *sync.Cond
+	queue   []string
+	busy    int
+	failed  int
+}
+
+func newOptimizer(command string, workers, verbosity int) *optimizer {
+	op := &optimizer{command: fileArg(command), verbosity: verbosity}
+	op.changed = sync.NewCond(&op.mu)
+	for range workers {
+		go op.work()
+	}
+	return op
+}
+
+// fileArg turns {file} into the quoted QXDL_FILE variable, so the file name
+// travels in the environment like every hook's values.
+func fileArg(command string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ReplaceAll(command, "{file}", `"%QXDL_FILE%"`)
+	}
+	return strings.ReplaceAll(command, "{file}", `"$QXDL_FILE"`)
+}
+
+func (op *optimizer) add(file string) {
+	op.mu.Lock()
+	op.queue = append(op.queue, file)
+	op.mu.Unlock()
+	op.changed.Broadcast()
+}
+
+// wait blocks until every queued page is done.
+func (op *optimizer) wait() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if n := len(op.queue) + op.busy; n > 0 {
+		fmt.Fprintf(logAt(op.verbosity, lvlNormal), "[opt ] waiting for %d page(s) to be optimized\n", n)
+	}
+	for len(op.queue) > 0 || op.busy > 0 {
+		op.changed.Wait()
+	}
+}
+
+// optimized lets the pages still queued for -optimize-cmd finish before the
+// run ends.
+func (s *session) optimized() {
+	if s.opt != nil {
+		s.opt.wait()
+	}
+}
+
+func (op *optimizer) work() {
+	for {
+		op.mu.Lock()
+		for len(op.queue) == 0 {
+			op.changed.Wait()
+		}
+		file := op.queue[0]
+		op.queue = op.queue[1:]
+		op.busy++
+		op.mu.Unlock()
+
+		start := time.Now()
+		cmd := shellCommand(op.command, "QXDL_FILE="+file)
+		out, err := cmd.CombinedOutput()
+
+		op.mu.Lock()
+		op.busy--
+		if err != nil {
+			op.failed++
+		}
+		op.mu.Unlock()
+		op.changed.Broadcast()
+		if err != nil {
+			fmt.Printf("[WARN] optimize %s: %v: %s\n", filepath.Base(file), err, strings.TrimSpace(string(out)))
+			continue
+		}
+		fmt.Fprintf(logAt(op.verbosity, lvlVerbose), "[opt ] %s in %v\n", filepath.Base(file), time.Since(start).Round(time.Millisecond))
+	}
+}
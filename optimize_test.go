@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestOptimizerRunsEveryQueuedFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	op := newOptimizer("cp {file} {file}.done", 3, lvlQuiet)
+	var files []string
+	for _, name := range []string{"01 a.png", "02 'b'.png", "03;c.png", "04.png"} {
+		f := filepath.Join(dir, name)
+		os.WriteFile(f, []byte(name), 0o644)
+		files = append(files, f)
+		op.add(f)
+	}
+	op.wait()
+	for _, f := range files {
+		if b, err := os.ReadFile(f + ".done"); err != nil || string(b) != filepath.Base(f) {
+			t.Errorf("%s: %q, %v", f, b, err)
+		}
+	}
+	if op.failed != 0 {
+		t.Errorf("%d failed", op.failed)
+	}
+}
+
+func TestOptimizerCountsFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	op := newOptimizer("exit 3", 1, lvlQuiet)
+	op.add("x.png")
+	op.add("y.png")
+	op.wait()
+	if op.failed != 2 {
+		t.Errorf("failed = %d, want 2", op.failed)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// -organize sorts jobs into one tree by where and when they came from:
+// -organize host/date puts a series under <root>/<host>/<YYYY-MM-DD>/<series>,
+// with the series folder named as without -organize (-out or the URL's
+// parent folder). An absolute or remote -out is used as it is.
+
+var organizeParts = map[string]bool{"host": true, "date": true, "month": true, "year": true}
+
+func parseOrganize(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, "/")
+	for _, p := range parts {
+		if !organizeParts[p] {
+			return nil, fmt.Errorf("-organize: unknown part %q (host, date, month, year, separated by /)", p)
+		}
+	}
+	return parts, nil
+}
+
+// organized is where j's folder goes under -organize on day now.
+func organized(o options, j job, now time.Time) string {
+	dirs := []string{o.organizeRoot}
+	for _, p := range o.organize {
+		switch p {
+		case "host":
+			host := "unknown-host"
+			raw := j.URL
+			if i := strings.IndexByte(raw, '{'); i >= 0 {
+				raw = raw[:i]
+			}
+			if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+				host = u.Hostname()
+			}
+			dirs = append(dirs, sanitizeName(host))
+		case "date":
+			dirs = append(dirs, now.Format("2006-01-02"))
+		case "month":
+			dirs = append(dirs, now.Format("2006-01"))
+		case "year":
+			dirs = append(dirs, now.Format("2006"))
+		}
+	}
+	return filepath.Join(append(dirs, j.folder())...)
+}
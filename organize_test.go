@@ -0,0 +1,30 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOrganizedFolder(t *testing.T) {
+	day := time.Date(2026, 3, 7, 12, 0, 0, 0, time.Local)
+	o := options{organizeRoot: "downloads"}
+	var err error
+	if o.organize, err = parseOrganize("host/date"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		j    job
+		want string
+	}{
+		{job{URL: "https://cdn.example:8443/My%20Series/{num}.png"}, "downloads/cdn.example/2026-03-07/My Series"},
+		{job{URL: "https://cdn.example/a/b/0001.png", Out: "vol1"}, "downloads/cdn.example/2026-03-07/vol1"},
+	} {
+		if got := organized(o, tc.j, day); got != filepath.FromSlash(tc.want) {
+			t.Errorf("organized(%s) = %s, want %s", tc.j.URL, got, tc.want)
+		}
+	}
+	if _, err := parseOrganize("host/week"); err == nil {
+		t.Error("unknown part accepted")
+	}
+}
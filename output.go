@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pageSink takes pages instead of the output folder: under -output their
+// bodies go to stdout and the log moves to stderr so it cannot mix with
+// them; with -out s3:// or dav:// they go to a bucket or share. Nothing is
+// written to disk.
+type pageSink interface {
+	put(name string, body []byte, modified time.Time) error
+	exists(name string) bool // for skipping pages a rerun already has
+	close() error
+}
+
+func newPageSink(mode string, w io.Writer) (pageSink, error) {
+	switch mode {
+	case "-":
+		return &rawSink{w: w}, nil
+	case "tar":
+		return &tarSink{tw: tar.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("output must be - (bodies back to back) or tar (got %q)", mode)
+}
+
+// rawSink writes the bodies back to back.
+type rawSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *rawSink) put(name string, body []byte, modified time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(body)
+	return err
+}
+
+func (s *rawSink) exists(name string) bool { return false }
+func (s *rawSink) close() error            { return nil }
+
+// tarSink writes one tar entry per page, named by its would-be path.
+type tarSink struct {
+	mu sync.Mutex
+	tw *tar.Writer
+}
+
+func (s *tarSink) put(name string, body []byte, modified time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	hdr := &tar.Header{Name: filepath.ToSlash(name), Mode: 0o644, Size: int64(len(body)), ModTime: modified}
+	if err := s.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := s.tw.Write(body)
+	return err
+}
+
+func (s *tarSink) exists(name string) bool { return false }
+
+func (s *tarSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tw.Close()
+}
+
+// isRemote reports whether an -out value is a bucket or share rather than
+// a folder.
+func isRemote(out string) bool {
+	return isS3(out) || isDAV(out)
+}
+
+// newRemoteSink opens the sink for a remote -out and returns the folder its
+// pages are named in.
+func newRemoteSink(out string) (pageSink, string, error) {
+	if isDAV(out) {
+		return newDAVSink(out)
+	}
+	return newS3Sink(out)
+}
+
+// needsDisk names the first option that only works with pages on disk, or
+// "" if o can run with a pageSink.
+func (o options) needsDisk() string {
+	switch {
+	case o.parts != "":
+		return "-parts"
+	case len(o.exports) > 0:
+		return "-export"
+	case o.packFormat != "":
+		return "-pack"
+	case o.checkImages:
+		return "-check-images"
+	case o.onDuplicate != "" && o.onDuplicate != "off":
+		return "-on-duplicate"
+	case o.watch:
+		return "-watch"
+	case o.saveHeaders:
+		return "-save-headers"
+	case o.convert != "":
+		return "-convert"
+	case o.optimizeCmd != "":
+		return "-optimize-cmd"
+	case o.save.strip:
+		return "-strip-metadata"
+	}
+	return ""
+}
+
+// runOutput is the -output sink; nil when pages go to files.
+var runOutput pageSink
+
+// stopOutput finishes the stream (the tar trailer) before the process ends.
+func stopOutput() {
+	if runOutput == nil {
+		return
+	}
+	if err := runOutput.close(); err != nil {
+		fmt.Println("[WARN] output:", err)
+	}
+	runOutput = nil
+}
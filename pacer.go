@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pacer keeps a per-host timeline of requests so every kind of request, GET
+// or HEAD, spends from the same politeness budget: a HEAD still delays the
+// GET that follows it, it just needs a much smaller gap of its own.
+type pacer struct {
+	mu        sync.Mutex
+	last      map[string]time.Time
+	gets      map[string]int
+	heads     map[string]int
+	verbosity int
+	// hold is, per host, the rate limit floor: no request before it
+	hold map[string]time.Time
+	// cool is, per host, the end of a cooldown after a 429 or 503; it is
+	// shared with other qxdl runs through dir (see cooldown.go)
+	cool map[string]time.Time
+	dir  string
+	// clock and sleeper are the wall clock but in tests
+	clock   clock
+	sleeper sleeper
+}
+
+func newPacer(verbosity int, dir string) *pacer {
+	return &pacer{last: map[string]time.Time{}, gets: map[string]int{}, heads: map[string]int{}, hold: map[string]time.Time{},
+		cool: map[string]time.Time{}, dir: dir, verbosity: verbosity, clock: realClock{}, sleeper: realClock{}}
+}
+
+// before sleeps until at least gap has passed since the previous request to
+// host, or until ctx is done, then books the next slot for a request of the
+// given method.
+func (p *pacer) before(ctx context.Context, host, method string, gap time.Duration) time.Duration {
+	p.mu.Lock()
+	now := p.clock.Now()
+	wait := p.last[host].Add(gap).Sub(now)
+	why := "pacing " + method
+	if held := p.hold[host].Sub(now); held > wait {
+		wait, why = held, "rate limit of "+host
+	}
+	if cooled := p.cooledUntil(host).Sub(now); cooled > wait {
+		wait, why = cooled, "cooldown of "+host
+	}
+	p.mu.Unlock()
+	if wait > 0 {
+		fmt.Fprintf(logAt(p.verbosity, lvlNormal), "waiting %v (%s)...\n", wait.Round(time.Millisecond), why)
+		wait = p.sleeper.Sleep(ctx, wait)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last[host] = p.clock.Now()
+	if method == "HEAD" {
+		p.heads[host]++
+	} else {
+		p.gets[host]++
+	}
+	return max(wait, 0)
+}
+
+// limit folds a response's rate limit headers into host's timeline: the
+// next request waits out rl.gap(), at most ceiling, from now. It reports
+// the gap it set, 0 if the quota needs no slowing down.
+func (p *pacer) limit(host string, rl rateLimit, ceiling time.Duration) time.Duration {
+	gap := rl.gap()
+	if gap > ceiling {
+		gap = ceiling
+	}
+	if gap <= 0 {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hold[host] = p.clock.Now().Add(gap)
+	return gap
+}
+
+// summary describes how many requests went to each host.
+func (p *pacer) summary() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []string
+	for host := range p.last {
+		out = append(out, fmt.Sprintf("%s: %d GET, %d HEAD", host, p.gets[host], p.heads[host]))
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testPacer() (*pacer, *fakeClock) {
+	c := newFakeClock()
+	p := newPacer(lvlQuiet, "")
+	p.clock, p.sleeper = c, c
+	return p, c
+}
+
+func TestPacerSpacesRequestsToAHost(t *testing.T) {
+	p, c := testPacer()
+	if w := p.before(context.Background(), "a.example", "GET", 6*time.Second); w != 0 {
+		t.Fatalf("first request waited %v", w)
+	}
+	c.Sleep(context.Background(), 2*time.Second) // the page took a while
+	if w := p.before(context.Background(), "a.example", "GET", 6*time.Second); w != 4*time.Second {
+		t.Fatalf("second request waited %v, want 4s", w)
+	}
+	if w := p.before(context.Background(), "b.example", "GET", 6*time.Second); w != 0 {
+		t.Fatalf("another host waited %v", w)
+	}
+	p.before(context.Background(), "a.example", "HEAD", time.Second)
+	if p.gets["a.example"] != 2 || p.heads["a.example"] != 1 {
+		t.Fatalf("counted %d GET, %d HEAD", p.gets["a.example"], p.heads["a.example"])
+	}
+}
+
+func TestPacerHoldsForRateLimit(t *testing.T) {
+	p, _ := testPacer()
+	p.before(context.Background(), "a.example", "GET", 0)
+	rl := rateLimit{known: true, remaining: 0, reset: 30 * time.Second}
+	if gap := p.limit("a.example", rl, time.Minute); gap != 30*time.Second {
+		t.Fatalf("gap %v, want 30s", gap)
+	}
+	if w := p.before(context.Background(), "a.example", "GET", time.Second); w != 30*time.Second {
+		t.Fatalf("waited %v, want the 30s until the quota refills", w)
+	}
+	if gap := p.limit("a.example", rl, 10*time.Second); gap != 10*time.Second {
+		t.Fatalf("gap %v, want it capped at 10s", gap)
+	}
+}
+
+func TestPacerWaitsOutCooldown(t *testing.T) {
+	p, _ := testPacer()
+	until, ok := p.cooldown("a.example", time.Minute)
+	if !ok {
+		t.Fatal("cooldown was not set")
+	}
+	if _, ok := p.cooldown("a.example", time.Second); ok {
+		t.Fatal("a shorter cooldown replaced a longer one")
+	}
+	if w := p.before(context.Background(), "a.example", "GET", time.Second); w != time.Minute {
+		t.Fatalf("waited %v, want 1m", w)
+	}
+	if !p.last["a.example"].Equal(until) {
+		t.Fatalf("request booked at %v, want %v", p.last["a.example"], until)
+	}
+}
+
+func TestPacerStopsWaitingWhenCanceled(t *testing.T) {
+	p := newPacer(lvlQuiet, "")
+	p.cooldown("a.example", time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	p.before(ctx, "a.example", "GET", 0)
+	if took := time.Since(start); took > 5*time.Second {
+		t.Fatalf("a canceled wait took %v", took)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// provenanceName is the file every archive carries about where its pages
+// came from, so it can be verified or re-synced without sidecars.
+const provenanceName = "qxdl.json"
+
+type provenance struct {
+	Tool    string           `json:"tool"`
+	Version string           `json:"version"`
+	Packed  time.Time        `json:"packed"`
+	Run     string           `json:"run,omitempty"`
+	Source  string           `json:"source,omitempty"` // URL or {num} template
+	Start   int              `json:"start,omitempty"`
+	End     int              `json:"end,omitempty"`
+	Step    int              `json:"step,omitempty"`
+	Pages   []provenancePage `json:"pages"`
+
+	urls map[int]string // page URLs from the state, for pages without sidecars
+}
+
+type provenancePage struct {
+	Name   string `json:"name"`
+	Num    int    `json:"num"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url,omitempty"`
+}
+
+// newProvenance fills the run details from the folder's state snapshot if
+// there is one; archives of hand-made folders just list their pages.
+func newProvenance(dir string) *provenance {
+	pv := &provenance{Tool: "qxdl-gentle", Version: version, Packed: time.Now().UTC(), urls: map[int]string{}}
+	st, err := loadState(filepath.Join(dir, stateFileName(0, 0)))
+	if err != nil {
+		if files, _ := stateFiles([]string{dir}); len(files) > 0 {
+			st, err = loadState(files[0])
+		}
+	}
+	if err == nil {
+		pv.Run, pv.Source, pv.Start, pv.End, pv.Step = st.ID, st.URL, st.Start, st.End, st.Step
+		for _, p := range st.Pages {
+			pv.urls[p.Num] = p.URL
+		}
+	}
+	return pv
+}
+
+// packFolder writes the pages of dir, in page order, into a CBZ or ZIP
+// archive. An empty out puts <folder>.<format> next to the folder.
+func packFolder(dir, format, out string) (string, error) {
+	format = strings.ToLower(format)
+	if format != "cbz" && format != "zip" {
+		return "", fmt.Errorf("unknown pack format %q (want cbz or zip)", format)
+	}
+	pages, err := scanFolder(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(pages) == 0 {
+		return "", fmt.Errorf("no pages in %s", dir)
+	}
+	if out == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		out = abs + "." + format
+	}
+
+	tmp := out + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	pv := newProvenance(dir)
+	for _, p := range pages {
+		sum, err := addToZip(zw, p.File, filepath.Base(p.File))
+		if err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		u := sourceURL(p.File)
+		if u == "" {
+			u = pv.urls[p.Num]
+		}
+		pv.Pages = append(pv.Pages, provenancePage{Name: filepath.Base(p.File), Num: p.Num, Size: p.Size, SHA256: sum, URL: u})
+	}
+	if err := writeProvenance(zw, pv); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return out, os.Rename(tmp, out)
+}
+
+// addToZip stores file as name and returns its SHA-256.
+func addToZip(zw *zip.Writer, file, name string) (string, error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+	hdr, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return "", err
+	}
+	hdr.Name = name
+	// images are already compressed; storing keeps readers fast
+	hdr.Method = zip.Store
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), src); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeProvenance(zw *zip.Writer, pv *provenance) error {
+	b, err := json.MarshalIndent(pv, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: provenanceName, Method: zip.Deflate, Modified: pv.Packed})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// verifyArchive checks every page of a packed archive against the hashes in
+// its qxdl.json.
+func verifyArchive(name string) (int, []pageProblem, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	var pv provenance
+	byName := map[string]*zip.File{}
+	for _, f := range zr.File {
+		byName[f.Name] = f
+	}
+	pf, ok := byName[provenanceName]
+	if !ok {
+		return 0, nil, fmt.Errorf("%s has no %s (packed by an older qxdl?)", name, provenanceName)
+	}
+	rc, err := pf.Open()
+	if err != nil {
+		return 0, nil, err
+	}
+	err = json.NewDecoder(rc).Decode(&pv)
+	rc.Close()
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", provenanceName, err)
+	}
+
+	var problems []pageProblem
+	for _, p := range pv.Pages {
+		f, ok := byName[p.Name]
+		if !ok {
+			problems = append(problems, pageProblem{File: p.Name, Reason: "listed in qxdl.json but not in the archive"})
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			problems = append(problems, pageProblem{File: p.Name, Reason: err.Error()})
+			continue
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			problems = append(problems, pageProblem{File: p.Name, Reason: err.Error()})
+		} else if sum := hex.EncodeToString(h.Sum(nil)); sum != p.SHA256 {
+			problems = append(problems, pageProblem{File: p.Name, Reason: "sha256 mismatch"})
+		}
+	}
+	return len(pv.Pages), problems, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+)
+
+// -save-headers: what the server said about each saved page, kept in a
+// 0001.png.meta.json sidecar, so a later run can check the page against
+// the server (If-None-Match, If-Modified-Since) or find where it really
+// came from after redirects.
+
+const metaSuffix = ".meta.json"
+
+type pageMeta struct {
+	URL          string    `json:"url"` // after redirects
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+func metaFromResponse(resp *http.Response) *pageMeta {
+	return &pageMeta{
+		URL:          resp.Request.URL.String(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		Fetched:      time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// writeMeta saves m as file's sidecar.
+func writeMeta(file string, m *pageMeta) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := file + metaSuffix
+	if err := os.WriteFile(name+".part", append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(name+".part", name)
+}
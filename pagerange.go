@@ -0,0 +1,62 @@
+package main
+
+import "fmt"
+
+// pageRange walks the page numbers of a run in the requested order.
+type pageRange struct {
+	start, end int
+	step       int // >= 1
+	reverse    bool
+}
+
+func (r pageRange) first() int {
+	if r.reverse {
+		// the last number the forward walk would reach
+		return r.end - (r.end-r.start)%r.step
+	}
+	return r.start
+}
+
+// contains reports whether i is still inside the range.
+func (r pageRange) contains(i int) bool {
+	return i >= r.start && i <= r.end
+}
+
+func (r pageRange) next(i int) int {
+	if r.reverse {
+		return i - r.step
+	}
+	return i + r.step
+}
+
+// last reports whether i is the final page the walk will visit.
+func (r pageRange) last(i int) bool {
+	return !r.contains(r.next(i))
+}
+
+// index is i's position in the forward walk, 0-based.
+func (r pageRange) index(i int) int {
+	return (i - r.start) / r.step
+}
+
+// local is the number page i is saved under: its place in the forward walk
+// counted from from, as -rename-start asks, or i itself when from is "".
+// A zero-padded from sets the width; otherwise it stays pad.
+func (r pageRange) local(i int, from string, pad int) (int, string) {
+	if from == "" {
+		return i, fmt.Sprintf("%0*d", pad, i)
+	}
+	n := toDec(from) + r.index(i)
+	if len(from) > 1 && from[0] == '0' {
+		pad = len(from)
+	}
+	return n, fmt.Sprintf("%0*d", pad, n)
+}
+
+// left is how many pages the walk still visits, i included.
+func (r pageRange) left(i int) int {
+	if r.reverse {
+		return r.index(i) + 1
+	}
+	return r.index(r.end) - r.index(i) + 1
+}
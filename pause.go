@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// pauseGate holds every job of the run between pages while it is closed:
+// SIGUSR1 closes it, SIGUSR2 opens it again. The page in flight finishes
+// first, so a pause only ever gives up bandwidth, never a half-done page.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{} // closed when the gate opens
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{}
+}
+
+// set closes or opens the gate and reports whether that changed anything.
+func (g *pauseGate) set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == paused {
+		return false
+	}
+	g.paused = paused
+	if paused {
+		g.resume = make(chan struct{})
+	} else {
+		close(g.resume)
+	}
+	return true
+}
+
+// wait blocks while the gate is closed, or until ctx is done. page names
+// what is held back, for the log.
+func (g *pauseGate) wait(ctx context.Context, page string) {
+	g.mu.Lock()
+	paused, resume := g.paused, g.resume
+	g.mu.Unlock()
+	if !paused {
+		return
+	}
+	fmt.Printf("[hold] paused before page %s; send SIGUSR2 to resume\n", page)
+	select {
+	case <-resume:
+	case <-ctx.Done():
+	}
+}
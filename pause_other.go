@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// pauseOnSignal does nothing where there is no SIGUSR1 or SIGUSR2.
+func pauseOnSignal(g *pauseGate) {}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPauseGate(t *testing.T) {
+	g := newPauseGate()
+	g.wait(context.Background(), "01") // open: returns at once
+	if !g.set(true) || g.set(true) {
+		t.Fatal("set(true) did not report the change once")
+	}
+	done := make(chan struct{})
+	go func() {
+		g.wait(context.Background(), "02")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("wait returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	g.set(false)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return on resume")
+	}
+
+	g.set(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g.wait(ctx, "03") // a stopped run is not held
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// pauseOnSignal closes g on SIGUSR1 and opens it on SIGUSR2.
+func pauseOnSignal(g *pauseGate) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for s := range sig {
+			switch paused := s == syscall.SIGUSR1; {
+			case !g.set(paused):
+			case paused:
+				fmt.Println("[hold] SIGUSR1: pausing after the current page")
+			default:
+				fmt.Println("[hold] SIGUSR2: resuming")
+			}
+		}
+	}()
+}
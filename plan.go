@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// -interactive: before a job sends its first request, it shows what it is
+// about to do and asks. A typo in -end (10000 for 100) is cheap to catch
+// here and expensive to catch in the host's logs.
+
+// bigPlan is the request count that earns an extra warning.
+const bigPlan = 1000
+
+// plannedRequests is how many page requests j makes at most, or -1 when
+// that is only known as it goes (-end auto, a URL list, -chap-end auto or
+// -parts N-auto).
+func plannedRequests(j job, o options) int {
+	if j.listed() || j.End == "auto" || j.ChapEnd == "auto" || o.parts != "" && o.partLast < 0 {
+		return -1
+	}
+	total := (toDec(j.End)-toDec(j.Start))/o.step + 1
+	if o.shards > 1 {
+		// pages are dealt round-robin, shard k gets indexes k-1, k-1+n, ...
+		total = (total - (o.shard - 1) + o.shards - 1) / o.shards
+	}
+	if o.parts != "" {
+		total *= o.partLast - o.partFirst + 1
+	}
+	if j.ChapStart != "" {
+		chapEnd := j.ChapEnd
+		if chapEnd == "" {
+			chapEnd = j.ChapStart
+		}
+		total *= toDec(chapEnd) - toDec(j.ChapStart) + 1
+	}
+	return max(total, 0)
+}
+
+// confirm shows the plan for j and asks whether to go ahead. No answer, as
+// when stdin is not a terminal, is a no.
+func (s *session) confirm(j job, o options, tmpl, folder, host string) bool {
+	fmt.Println("About to fetch:")
+	switch {
+	case j.URLCmd != "":
+		fmt.Printf("  URLs     from -url-cmd %s\n", j.URLCmd)
+	case j.FromPage != "":
+		fmt.Printf("  URLs     from %s (%s)\n", j.FromPage, j.Selector)
+	case j.FromFeed != "":
+		fmt.Printf("  URLs     new media in the feed %s\n", j.FromFeed)
+	case j.FromJSON != "":
+		fmt.Printf("  URLs     from %s (%s)\n", j.FromJSON, j.JSONPath)
+	default:
+		fmt.Printf("  URL      %s\n", tmpl)
+	}
+	fmt.Printf("  FOLDER   %s\n", folder)
+	interval := time.Duration(o.interval) * time.Second
+	n := plannedRequests(j, o)
+	if n < 0 {
+		fmt.Printf("  PAGES    from %s until the end is found\n", j.Start)
+		fmt.Printf("  TIME     %v per page plus transfer\n", interval)
+	} else {
+		fmt.Printf("  PAGES    %s to %s: %d request(s) to %s\n", j.Start, j.End, n, host)
+		fmt.Printf("  TIME     about %v plus transfer; pages already on disk go faster\n", time.Duration(n)*interval)
+		if n >= bigPlan {
+			fmt.Printf("[WARN] that is %d requests; check -start/-end\n", n)
+		}
+	}
+	fmt.Print("Start? [y/N] ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println("\nno terminal to ask; not starting")
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
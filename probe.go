@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxPadProbes caps how many alternative paddings are tried, so a genuinely
+// missing page costs the host only a handful of extra requests.
+const maxPadProbes = 4
+
+// padCandidates lists zero-padding widths that spell n differently from
+// width pad, nearest width first (so 0064 tries 064, 00064, 64, ...).
+func padCandidates(n, pad int) []int {
+	cur := fmt.Sprintf("%0*d", pad, n)
+	seen := map[string]bool{cur: true}
+	var widths []int
+	for w := 1; w <= 8; w++ {
+		s := fmt.Sprintf("%0*d", w, n)
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		widths = append(widths, w)
+	}
+	sort.SliceStable(widths, func(i, j int) bool {
+		return absInt(widths[i]-pad) < absInt(widths[j]-pad)
+	})
+	if len(widths) > maxPadProbes {
+		widths = widths[:maxPadProbes]
+	}
+	return widths
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
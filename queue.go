@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// The queue lets jobs be added during the day and drained later by one
+// `qxdl queue run`. It lives in the session directory next to the
+// blocklist, so every invocation sees the same queue.
+
+const (
+	queueFile = "queue.json"
+
+	queuePending = "pending"
+	queueFailed  = "failed"
+)
+
+type queueEntry struct {
+	ID       int       `json:"id"`
+	Added    time.Time `json:"added"`
+	Status   string    `json:"status"`
+	Attempts int       `json:"attempts,omitempty"`
+	Err      string    `json:"error,omitempty"`
+	Job      job       `json:"job"`
+}
+
+type jobQueue struct {
+	NextID  int          `json:"next_id"`
+	Entries []queueEntry `json:"entries"`
+}
+
+// withQueue loads the queue under a lock file, lets fn change it and saves
+// it. The lock keeps `queue add` from racing a running `queue run`.
+func withQueue(dir string, fn func(q *jobQueue) error) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	lock := filepath.Join(dir, queueFile+".lock")
+	var lf *os.File
+	for tries := 0; ; tries++ {
+		var err error
+		lf, err = os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) || tries >= 50 {
+			return fmt.Errorf("queue is locked (remove %s if no qxdl is running): %w", lock, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer os.Remove(lock)
+	defer lf.Close()
+
+	name := filepath.Join(dir, queueFile)
+	q := &jobQueue{NextID: 1}
+	b, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, q); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err := fn(q); err != nil {
+		return err
+	}
+	if b, err = json.MarshalIndent(q, "", "  "); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name+".part", b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(name+".part", name)
+}
+
+func (q *jobQueue) add(j job) int {
+	id := q.NextID
+	q.NextID++
+	q.Entries = append(q.Entries, queueEntry{ID: id, Added: time.Now(), Status: queuePending, Job: j})
+	return id
+}
+
+func (q *jobQueue) find(id int) *queueEntry {
+	for i := range q.Entries {
+		if q.Entries[i].ID == id {
+			return &q.Entries[i]
+		}
+	}
+	return nil
+}
+
+func (q *jobQueue) remove(id int) bool {
+	for i, e := range q.Entries {
+		if e.ID == id {
+			q.Entries = append(q.Entries[:i], q.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func cmdQueue(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("Usage: qxdl queue add|list|rm|run ...")
+		return exitBadArgs
+	}
+	switch args[0] {
+	case "add":
+		return cmdQueueAdd(args[1:])
+	case "list", "ls":
+		return cmdQueueList(args[1:])
+	case "rm":
+		return cmdQueueRm(args[1:])
+	}
+	// "queue run" takes the download flags and is handled in main
+	fmt.Printf("[ERROR] unknown queue command %q\n", args[0])
+	return exitBadArgs
+}
+
+func cmdQueueAdd(args []string) int {
+	fs := flag.NewFlagSet("queue add", flag.ExitOnError)
+	dir := fs.String("session-dir", defaultSessionDir(), "Directory holding the queue")
+	jobsName := fs.String("jobs", "", "Add every job of a jobs file")
+	var j job
+	fs.StringVar(&j.URL, "url", "", "Page URL or {num} template, as for a download")
+	fs.StringVar(&j.Start, "start", "", "Start page")
+	fs.StringVar(&j.End, "end", "", "End page or auto (default = start)")
+	fs.StringVar(&j.ChapStart, "chap-start", "", "First chapter for {chap}")
+	fs.StringVar(&j.ChapEnd, "chap-end", "", "Last chapter for {chap}, or auto")
+	fs.StringVar(&j.ChapFolder, "chap-folder", "", "Per-chapter subfolder (default ch{chap})")
+	fs.StringVar(&j.Out, "out", "", "Destination directory")
+	var interval, step int
+	var ext, export, pack string
+	fs.IntVar(&interval, "interval", 0, "Override the run's -interval for this job")
+	fs.IntVar(&step, "step", 0, "Override the run's -step for this job")
+	fs.StringVar(&ext, "ext", "", "Override the run's -ext for this job")
+	fs.StringVar(&export, "export", "", "Override the run's -export for this job")
+	fs.StringVar(&pack, "pack", "", "Override the run's -pack for this job")
+	fs.Parse(args)
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "interval":
+			j.Interval = &interval
+		case "step":
+			j.Step = &step
+		case "ext":
+			j.Ext = &ext
+		case "export":
+			j.Export = &export
+		case "pack":
+			j.Pack = &pack
+		}
+	})
+
+	var jobs []job
+	switch {
+	case *jobsName != "":
+		var err error
+		if jobs, err = loadJobs(*jobsName); err != nil {
+			fmt.Println("[ERROR]", err)
+			return exitError
+		}
+	case j.URL != "" && j.Start != "":
+		jobs = []job{j}
+	default:
+		fmt.Println("Usage: qxdl queue add -url URL -start N [-end N] [flags]  |  qxdl queue add -jobs FILE")
+		fs.PrintDefaults()
+		return exitBadArgs
+	}
+	for i := range jobs {
+		// the run checks again with its own options; this catches typos now
+		check := jobs[i]
+		if err := check.validate(options{}); err != nil {
+			fmt.Printf("[ERROR] job %d: %v\n", i+1, err)
+			return exitBadArgs
+		}
+	}
+
+	err := withQueue(*dir, func(q *jobQueue) error {
+		for _, j := range jobs {
+			id := q.add(j)
+			fmt.Printf("[queue] #%d %s %s..%s\n", id, j.URL, j.Start, orDefault(j.End, j.Start))
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func cmdQueueList(args []string) int {
+	fs := flag.NewFlagSet("queue list", flag.ExitOnError)
+	dir := fs.String("session-dir", defaultSessionDir(), "Directory holding the queue")
+	asJSON := fs.Bool("json", false, "Print the queue as JSON")
+	fs.Parse(args)
+
+	var q jobQueue
+	err := withQueue(*dir, func(cur *jobQueue) error {
+		q = *cur
+		return nil
+	})
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(q.Entries, "", "  ")
+		fmt.Println(string(b))
+		return exitOK
+	}
+	for _, e := range q.Entries {
+		fmt.Printf("#%-4d %-7s %s  %s %s..%s", e.ID, e.Status, e.Added.Format(time.DateTime),
+			e.Job.URL, e.Job.Start, orDefault(e.Job.End, e.Job.Start))
+		if e.Err != "" {
+			fmt.Printf("  (%d attempt(s): %s)", e.Attempts, e.Err)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d job(s) queued\n", len(q.Entries))
+	return exitOK
+}
+
+func cmdQueueRm(args []string) int {
+	fs := flag.NewFlagSet("queue rm", flag.ExitOnError)
+	dir := fs.String("session-dir", defaultSessionDir(), "Directory holding the queue")
+	all := fs.Bool("all", false, "Remove every job")
+	failed := fs.Bool("failed", false, "Remove every failed job")
+	fs.Parse(args)
+	if fs.NArg() == 0 && !*all && !*failed {
+		fmt.Println("Usage: qxdl queue rm [-all|-failed] [ID ...]")
+		return exitBadArgs
+	}
+	var ids []int
+	for _, a := range fs.Args() {
+		id, err := strconv.Atoi(a)
+		if err != nil {
+			fmt.Printf("[ERROR] bad queue id %q\n", a)
+			return exitBadArgs
+		}
+		ids = append(ids, id)
+	}
+
+	removed := 0
+	err := withQueue(*dir, func(q *jobQueue) error {
+		for _, e := range append([]queueEntry(nil), q.Entries...) {
+			if *all || (*failed && e.Status == queueFailed) {
+				removed++
+				q.remove(e.ID)
+			}
+		}
+		for _, id := range ids {
+			if !q.remove(id) {
+				fmt.Printf("[WARN] no job #%d in the queue\n", id)
+				continue
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	fmt.Printf("%d job(s) removed\n", removed)
+	return exitOK
+}
+
+// drainQueue runs pending queue entries oldest first until none are left.
+// The queue is re-read before every job, so entries added or removed while
+// it runs are honored. Finished jobs leave the queue; failed ones stay,
+// marked failed, for `queue list` and a later `queue run -retry-failed`.
+func drainQueue(s *session, retryFailed bool) {
+	tried := map[int]bool{}
+	done, failed, code := 0, 0, exitOK
+	for {
+		var next *queueEntry
+		err := withQueue(s.o.sessionDir, func(q *jobQueue) error {
+			for i := range q.Entries {
+				e := &q.Entries[i]
+				if tried[e.ID] || (e.Status == queueFailed && !retryFailed) {
+					continue
+				}
+				c := *e
+				next = &c
+				return nil
+			}
+			return nil
+		})
+		if err != nil {
+			exitErr(err)
+		}
+		if next == nil {
+			break
+		}
+		tried[next.ID] = true
+		fmt.Fprintf(logAt(s.o.verbosity, lvlNormal), "=== queue #%d: %s ===\n", next.ID, next.Job.URL)
+		res, jerr := s.runJob(next.Job)
+		code = worseExit(code, jobExitCode(res, jerr))
+		if res.Stopped {
+			// keep the entry queued; the next drain picks it up again
+			break
+		}
+		switch {
+		case jerr != nil:
+			fmt.Printf("[ERROR] queue #%d: %v\n", next.ID, jerr)
+		case res.Aborted:
+			jerr = errors.New("stopped after too many consecutive errors")
+		}
+
+		err = withQueue(s.o.sessionDir, func(q *jobQueue) error {
+			if jerr == nil {
+				q.remove(next.ID)
+				return nil
+			}
+			if e := q.find(next.ID); e != nil {
+				e.Status, e.Err = queueFailed, jerr.Error()
+				e.Attempts++
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println("[WARN] update queue:", err)
+		}
+		if jerr == nil {
+			done++
+		} else {
+			failed++
+		}
+	}
+	s.summary(fmt.Sprintf("Done: %d queued job(s) finished, %d failed.", done, failed))
+	if code != exitOK {
+		exit(code)
+	}
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
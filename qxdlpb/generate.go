@@ -0,0 +1,5 @@
+// Package qxdlpb is the generated client and server code for qxdl serve's
+// gRPC API.
+package qxdlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative qxdl.proto
@@ -0,0 +1,688 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: qxdl.proto
+
+// The gRPC side of qxdl serve (-grpc-listen): submit jobs, follow their
+// progress as a stream and pause, resume or cancel them. It runs the same
+// queue as the JSON API on -listen.
+
+package qxdlpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type JobStatus int32
+
+const (
+	JobStatus_JOB_STATUS_UNSPECIFIED JobStatus = 0
+	JobStatus_JOB_STATUS_QUEUED      JobStatus = 1
+	JobStatus_JOB_STATUS_RUNNING     JobStatus = 2
+	JobStatus_JOB_STATUS_PAUSED      JobStatus = 3
+	JobStatus_JOB_STATUS_DONE        JobStatus = 4
+	JobStatus_JOB_STATUS_FAILED      JobStatus = 5
+	JobStatus_JOB_STATUS_CANCELED    JobStatus = 6
+)
+
+// Enum value maps for JobStatus.
+var (
+	JobStatus_name = map[int32]string{
+		0: "JOB_STATUS_UNSPECIFIED",
+		1: "JOB_STATUS_QUEUED",
+		2: "JOB_STATUS_RUNNING",
+		3: "JOB_STATUS_PAUSED",
+		4: "JOB_STATUS_DONE",
+		5: "JOB_STATUS_FAILED",
+		6: "JOB_STATUS_CANCELED",
+	}
+	JobStatus_value = map[string]int32{
+		"JOB_STATUS_UNSPECIFIED": 0,
+		"JOB_STATUS_QUEUED":      1,
+		"JOB_STATUS_RUNNING":     2,
+		"JOB_STATUS_PAUSED":      3,
+		"JOB_STATUS_DONE":        4,
+		"JOB_STATUS_FAILED":      5,
+		"JOB_STATUS_CANCELED":    6,
+	}
+)
+
+func (x JobStatus) Enum() *JobStatus {
+	p := new(JobStatus)
+	*p = x
+	return p
+}
+
+func (x JobStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JobStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_qxdl_proto_enumTypes[0].Descriptor()
+}
+
+func (JobStatus) Type() protoreflect.EnumType {
+	return &file_qxdl_proto_enumTypes[0]
+}
+
+func (x JobStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JobStatus.Descriptor instead.
+func (JobStatus) EnumDescriptor() ([]byte, []int) {
+	return file_qxdl_proto_rawDescGZIP(), []int{0}
+}
+
+// JobSpec is a -jobs entry.
+type JobSpec struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Url        string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Start      string                 `protobuf:"bytes,2,opt,name=start,proto3" json:"start,omitempty"`
+	End        string                 `protobuf:"bytes,3,opt,name=end,proto3" json:"end,omitempty"`
+	ChapStart  string                 `protobuf:"bytes,4,opt,name=chap_start,json=chapStart,proto3" json:"chap_start,omitempty"`
+	ChapEnd    string                 `protobuf:"bytes,5,opt,name=chap_end,json=chapEnd,proto3" json:"chap_end,omitempty"`
+	ChapFolder string                 `protobuf:"bytes,6,opt,name=chap_folder,json=chapFolder,proto3" json:"chap_folder,omitempty"`
+	Out        string                 `protobuf:"bytes,7,opt,name=out,proto3" json:"out,omitempty"`
+	UrlCmd     string                 `protobuf:"bytes,8,opt,name=url_cmd,json=urlCmd,proto3" json:"url_cmd,omitempty"`
+	FromPage   string                 `protobuf:"bytes,9,opt,name=from_page,json=fromPage,proto3" json:"from_page,omitempty"`
+	Selector   string                 `protobuf:"bytes,10,opt,name=selector,proto3" json:"selector,omitempty"`
+	FromFeed   string                 `protobuf:"bytes,11,opt,name=from_feed,json=fromFeed,proto3" json:"from_feed,omitempty"`
+	FromJson   string                 `protobuf:"bytes,12,opt,name=from_json,json=fromJson,proto3" json:"from_json,omitempty"`
+	JsonPath   string                 `protobuf:"bytes,13,opt,name=json_path,json=jsonPath,proto3" json:"json_path,omitempty"`
+	// per-job option overrides as a JSON object with the jobs file's keys,
+	// e.g. {"interval": 5, "referer": "https://host/"}
+	OverridesJson string `protobuf:"bytes,14,opt,name=overrides_json,json=overridesJson,proto3" json:"overrides_json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobSpec) Reset() {
+	*x = JobSpec{}
+	mi := &file_qxdl_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobSpec) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobSpec) ProtoMessage() {}
+
+func (x *JobSpec) ProtoReflect() protoreflect.Message {
+	mi := &file_qxdl_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobSpec.ProtoReflect.Descriptor instead.
+func (*JobSpec) Descriptor() ([]byte, []int) {
+	return file_qxdl_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *JobSpec) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *JobSpec) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *JobSpec) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+func (x *JobSpec) GetChapStart() string {
+	if x != nil {
+		return x.ChapStart
+	}
+	return ""
+}
+
+func (x *JobSpec) GetChapEnd() string {
+	if x != nil {
+		return x.ChapEnd
+	}
+	return ""
+}
+
+func (x *JobSpec) GetChapFolder() string {
+	if x != nil {
+		return x.ChapFolder
+	}
+	return ""
+}
+
+func (x *JobSpec) GetOut() string {
+	if x != nil {
+		return x.Out
+	}
+	return ""
+}
+
+func (x *JobSpec) GetUrlCmd() string {
+	if x != nil {
+		return x.UrlCmd
+	}
+	return ""
+}
+
+func (x *JobSpec) GetFromPage() string {
+	if x != nil {
+		return x.FromPage
+	}
+	return ""
+}
+
+func (x *JobSpec) GetSelector() string {
+	if x != nil {
+		return x.Selector
+	}
+	return ""
+}
+
+func (x *JobSpec) GetFromFeed() string {
+	if x != nil {
+		return x.FromFeed
+	}
+	return ""
+}
+
+func (x *JobSpec) GetFromJson() string {
+	if x != nil {
+		return x.FromJson
+	}
+	return ""
+}
+
+func (x *JobSpec) GetJsonPath() string {
+	if x != nil {
+		return x.JsonPath
+	}
+	return ""
+}
+
+func (x *JobSpec) GetOverridesJson() string {
+	if x != nil {
+		return x.OverridesJson
+	}
+	return ""
+}
+
+type JobRef struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobRef) Reset() {
+	*x = JobRef{}
+	mi := &file_qxdl_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobRef) ProtoMessage() {}
+
+func (x *JobRef) ProtoReflect() protoreflect.Message {
+	mi := &file_qxdl_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobRef.ProtoReflect.Descriptor instead.
+func (*JobRef) Descriptor() ([]byte, []int) {
+	return file_qxdl_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *JobRef) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_qxdl_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_qxdl_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_qxdl_proto_rawDescGZIP(), []int{2}
+}
+
+type ListResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*Job                 `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_qxdl_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_qxdl_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListResponse.ProtoReflect.Descriptor instead.
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return file_qxdl_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+// Progress counts page outcomes of the job so far.
+type Progress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Current       int32                  `protobuf:"varint,1,opt,name=current,proto3" json:"current,omitempty"` // page being fetched
+	Ok            int32                  `protobuf:"varint,2,opt,name=ok,proto3" json:"ok,omitempty"`
+	Skipped       int32                  `protobuf:"varint,3,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	Missing       int32                  `protobuf:"varint,4,opt,name=missing,proto3" json:"missing,omitempty"`
+	Failed        int32                  `protobuf:"varint,5,opt,name=failed,proto3" json:"failed,omitempty"`
+	Bytes         int64                  `protobuf:"varint,6,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Progress) Reset() {
+	*x = Progress{}
+	mi := &file_qxdl_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Progress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Progress) ProtoMessage() {}
+
+func (x *Progress) ProtoReflect() protoreflect.Message {
+	mi := &file_qxdl_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Progress.ProtoReflect.Descriptor instead.
+func (*Progress) Descriptor() ([]byte, []int) {
+	return file_qxdl_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Progress) GetCurrent() int32 {
+	if x != nil {
+		return x.Current
+	}
+	return 0
+}
+
+func (x *Progress) GetOk() int32 {
+	if x != nil {
+		return x.Ok
+	}
+	return 0
+}
+
+func (x *Progress) GetSkipped() int32 {
+	if x != nil {
+		return x.Skipped
+	}
+	return 0
+}
+
+func (x *Progress) GetMissing() int32 {
+	if x != nil {
+		return x.Missing
+	}
+	return 0
+}
+
+func (x *Progress) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *Progress) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type Job struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Spec          *JobSpec               `protobuf:"bytes,2,opt,name=spec,proto3" json:"spec,omitempty"`
+	Status        JobStatus              `protobuf:"varint,3,opt,name=status,proto3,enum=qxdl.v1.JobStatus" json:"status,omitempty"`
+	Added         *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=added,proto3" json:"added,omitempty"`
+	Started       *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=started,proto3" json:"started,omitempty"`
+	Finished      *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=finished,proto3" json:"finished,omitempty"`
+	Error         string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	Progress      *Progress              `protobuf:"bytes,8,opt,name=progress,proto3" json:"progress,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_qxdl_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_qxdl_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_qxdl_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Job) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Job) GetSpec() *JobSpec {
+	if x != nil {
+		return x.Spec
+	}
+	return nil
+}
+
+func (x *Job) GetStatus() JobStatus {
+	if x != nil {
+		return x.Status
+	}
+	return JobStatus_JOB_STATUS_UNSPECIFIED
+}
+
+func (x *Job) GetAdded() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Added
+	}
+	return nil
+}
+
+func (x *Job) GetStarted() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Started
+	}
+	return nil
+}
+
+func (x *Job) GetFinished() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Finished
+	}
+	return nil
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetProgress() *Progress {
+	if x != nil {
+		return x.Progress
+	}
+	return nil
+}
+
+var File_qxdl_proto protoreflect.FileDescriptor
+
+const file_qxdl_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"qxdl.proto\x12\aqxdl.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x80\x03\n" +
+	"\aJobSpec\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x14\n" +
+	"\x05start\x18\x02 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x03 \x01(\tR\x03end\x12\x1d\n" +
+	"\n" +
+	"chap_start\x18\x04 \x01(\tR\tchapStart\x12\x19\n" +
+	"\bchap_end\x18\x05 \x01(\tR\achapEnd\x12\x1f\n" +
+	"\vchap_folder\x18\x06 \x01(\tR\n" +
+	"chapFolder\x12\x10\n" +
+	"\x03out\x18\a \x01(\tR\x03out\x12\x17\n" +
+	"\aurl_cmd\x18\b \x01(\tR\x06urlCmd\x12\x1b\n" +
+	"\tfrom_page\x18\t \x01(\tR\bfromPage\x12\x1a\n" +
+	"\bselector\x18\n" +
+	" \x01(\tR\bselector\x12\x1b\n" +
+	"\tfrom_feed\x18\v \x01(\tR\bfromFeed\x12\x1b\n" +
+	"\tfrom_json\x18\f \x01(\tR\bfromJson\x12\x1b\n" +
+	"\tjson_path\x18\r \x01(\tR\bjsonPath\x12%\n" +
+	"\x0eoverrides_json\x18\x0e \x01(\tR\roverridesJson\"\x18\n" +
+	"\x06JobRef\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\"\r\n" +
+	"\vListRequest\"0\n" +
+	"\fListResponse\x12 \n" +
+	"\x04jobs\x18\x01 \x03(\v2\f.qxdl.v1.JobR\x04jobs\"\x96\x01\n" +
+	"\bProgress\x12\x18\n" +
+	"\acurrent\x18\x01 \x01(\x05R\acurrent\x12\x0e\n" +
+	"\x02ok\x18\x02 \x01(\x05R\x02ok\x12\x18\n" +
+	"\askipped\x18\x03 \x01(\x05R\askipped\x12\x18\n" +
+	"\amissing\x18\x04 \x01(\x05R\amissing\x12\x16\n" +
+	"\x06failed\x18\x05 \x01(\x05R\x06failed\x12\x14\n" +
+	"\x05bytes\x18\x06 \x01(\x03R\x05bytes\"\xcc\x02\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12$\n" +
+	"\x04spec\x18\x02 \x01(\v2\x10.qxdl.v1.JobSpecR\x04spec\x12*\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x12.qxdl.v1.JobStatusR\x06status\x120\n" +
+	"\x05added\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x05added\x124\n" +
+	"\astarted\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\astarted\x126\n" +
+	"\bfinished\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\bfinished\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\x12-\n" +
+	"\bprogress\x18\b \x01(\v2\x11.qxdl.v1.ProgressR\bprogress*\xb2\x01\n" +
+	"\tJobStatus\x12\x1a\n" +
+	"\x16JOB_STATUS_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11JOB_STATUS_QUEUED\x10\x01\x12\x16\n" +
+	"\x12JOB_STATUS_RUNNING\x10\x02\x12\x15\n" +
+	"\x11JOB_STATUS_PAUSED\x10\x03\x12\x13\n" +
+	"\x0fJOB_STATUS_DONE\x10\x04\x12\x15\n" +
+	"\x11JOB_STATUS_FAILED\x10\x05\x12\x17\n" +
+	"\x13JOB_STATUS_CANCELED\x10\x062\xaf\x02\n" +
+	"\x04Jobs\x12(\n" +
+	"\x06Submit\x12\x10.qxdl.v1.JobSpec\x1a\f.qxdl.v1.Job\x123\n" +
+	"\x04List\x12\x14.qxdl.v1.ListRequest\x1a\x15.qxdl.v1.ListResponse\x12$\n" +
+	"\x03Get\x12\x0f.qxdl.v1.JobRef\x1a\f.qxdl.v1.Job\x12&\n" +
+	"\x05Pause\x12\x0f.qxdl.v1.JobRef\x1a\f.qxdl.v1.Job\x12'\n" +
+	"\x06Resume\x12\x0f.qxdl.v1.JobRef\x1a\f.qxdl.v1.Job\x12'\n" +
+	"\x06Cancel\x12\x0f.qxdl.v1.JobRef\x1a\f.qxdl.v1.Job\x12(\n" +
+	"\x05Watch\x12\x0f.qxdl.v1.JobRef\x1a\f.qxdl.v1.Job0\x01B%Z#github.com/fafuu/qxdl-gentle/qxdlpbb\x06proto3"
+
+var (
+	file_qxdl_proto_rawDescOnce sync.Once
+	file_qxdl_proto_rawDescData []byte
+)
+
+func file_qxdl_proto_rawDescGZIP() []byte {
+	file_qxdl_proto_rawDescOnce.Do(func() {
+		file_qxdl_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_qxdl_proto_rawDesc), len(file_qxdl_proto_rawDesc)))
+	})
+	return file_qxdl_proto_rawDescData
+}
+
+var file_qxdl_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_qxdl_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_qxdl_proto_goTypes = []any{
+	(JobStatus)(0),                // 0: qxdl.v1.JobStatus
+	(*JobSpec)(nil),               // 1: qxdl.v1.JobSpec
+	(*JobRef)(nil),                // 2: qxdl.v1.JobRef
+	(*ListRequest)(nil),           // 3: qxdl.v1.ListRequest
+	(*ListResponse)(nil),          // 4: qxdl.v1.ListResponse
+	(*Progress)(nil),              // 5: qxdl.v1.Progress
+	(*Job)(nil),                   // 6: qxdl.v1.Job
+	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
+}
+var file_qxdl_proto_depIdxs = []int32{
+	6,  // 0: qxdl.v1.ListResponse.jobs:type_name -> qxdl.v1.Job
+	1,  // 1: qxdl.v1.Job.spec:type_name -> qxdl.v1.JobSpec
+	0,  // 2: qxdl.v1.Job.status:type_name -> qxdl.v1.JobStatus
+	7,  // 3: qxdl.v1.Job.added:type_name -> google.protobuf.Timestamp
+	7,  // 4: qxdl.v1.Job.started:type_name -> google.protobuf.Timestamp
+	7,  // 5: qxdl.v1.Job.finished:type_name -> google.protobuf.Timestamp
+	5,  // 6: qxdl.v1.Job.progress:type_name -> qxdl.v1.Progress
+	1,  // 7: qxdl.v1.Jobs.Submit:input_type -> qxdl.v1.JobSpec
+	3,  // 8: qxdl.v1.Jobs.List:input_type -> qxdl.v1.ListRequest
+	2,  // 9: qxdl.v1.Jobs.Get:input_type -> qxdl.v1.JobRef
+	2,  // 10: qxdl.v1.Jobs.Pause:input_type -> qxdl.v1.JobRef
+	2,  // 11: qxdl.v1.Jobs.Resume:input_type -> qxdl.v1.JobRef
+	2,  // 12: qxdl.v1.Jobs.Cancel:input_type -> qxdl.v1.JobRef
+	2,  // 13: qxdl.v1.Jobs.Watch:input_type -> qxdl.v1.JobRef
+	6,  // 14: qxdl.v1.Jobs.Submit:output_type -> qxdl.v1.Job
+	4,  // 15: qxdl.v1.Jobs.List:output_type -> qxdl.v1.ListResponse
+	6,  // 16: qxdl.v1.Jobs.Get:output_type -> qxdl.v1.Job
+	6,  // 17: qxdl.v1.Jobs.Pause:output_type -> qxdl.v1.Job
+	6,  // 18: qxdl.v1.Jobs.Resume:output_type -> qxdl.v1.Job
+	6,  // 19: qxdl.v1.Jobs.Cancel:output_type -> qxdl.v1.Job
+	6,  // 20: qxdl.v1.Jobs.Watch:output_type -> qxdl.v1.Job
+	14, // [14:21] is the sub-list for method output_type
+	7,  // [7:14] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_qxdl_proto_init() }
+func file_qxdl_proto_init() {
+	if File_qxdl_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_qxdl_proto_rawDesc), len(file_qxdl_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_qxdl_proto_goTypes,
+		DependencyIndexes: file_qxdl_proto_depIdxs,
+		EnumInfos:         file_qxdl_proto_enumTypes,
+		MessageInfos:      file_qxdl_proto_msgTypes,
+	}.Build()
+	File_qxdl_proto = out.File
+	file_qxdl_proto_goTypes = nil
+	file_qxdl_proto_depIdxs = nil
+}
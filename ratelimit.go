@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimit is what a response said about the host's request quota: the
+// X-RateLimit-* family (GitHub, most APIs), X-Rate-Limit-*, Discord's
+// X-RateLimit-Reset-After, and the IETF RateLimit header in both its
+// "limit=, remaining=, reset=" and its "r=;t=" forms.
+type rateLimit struct {
+	known     bool
+	remaining int
+	limit     int           // 0 if not sent
+	reset     time.Duration // until the quota refills; 0 if not sent
+}
+
+func parseRateLimit(h http.Header) rateLimit {
+	var rl rateLimit
+	first := func(names ...string) string {
+		for _, n := range names {
+			if v := strings.TrimSpace(h.Get(n)); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	if v := first("X-RateLimit-Remaining", "X-Rate-Limit-Remaining", "RateLimit-Remaining"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			rl.known, rl.remaining = true, n
+		}
+	}
+	if v := first("X-RateLimit-Limit", "X-Rate-Limit-Limit", "RateLimit-Limit"); v != "" {
+		// "100, 100;w=60" in some drafts; the first number is the quota
+		v, _, _ = strings.Cut(v, ",")
+		v, _, _ = strings.Cut(v, ";")
+		rl.limit, _ = strconv.Atoi(strings.TrimSpace(v))
+	}
+	if v := first("X-RateLimit-Reset-After", "RateLimit-Reset"); v != "" {
+		rl.reset = parseSeconds(v)
+	} else if v := first("X-RateLimit-Reset", "X-Rate-Limit-Reset"); v != "" {
+		rl.reset = parseResetTime(v)
+	}
+	if v := h.Get("RateLimit"); v != "" && !rl.known {
+		if !strings.Contains(v, "remaining=") {
+			// "default";r=50;t=30, ...: the first policy item is the one in force
+			v, _, _ = strings.Cut(v, ",")
+		}
+		for _, p := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' }) {
+			k, val, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(k) {
+			case "remaining", "r":
+				if n, err := strconv.Atoi(val); err == nil {
+					rl.known, rl.remaining = true, n
+				}
+			case "limit", "l":
+				rl.limit, _ = strconv.Atoi(val)
+			case "reset", "t":
+				rl.reset = parseSeconds(val)
+			}
+		}
+	}
+	return rl
+}
+
+// parseSeconds reads a delta in (possibly fractional) seconds.
+func parseSeconds(v string) time.Duration {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+// parseResetTime reads X-RateLimit-Reset, which is a Unix time on most hosts
+// but a delta on some, and an HTTP date on a few.
+func parseResetTime(v string) time.Duration {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n < 1e9 {
+			return time.Duration(n) * time.Second // too small for a date
+		}
+		return max(time.Until(time.Unix(n, 0)), 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return parseSeconds(v)
+}
+
+// gap is how far apart the next requests must be to make the quota last
+// until it refills: the whole wait once it is used up, the rest of the
+// window spread over what is left otherwise. It is 0 when the host did not
+// say when the quota refills.
+func (rl rateLimit) gap() time.Duration {
+	if !rl.known || rl.reset <= 0 {
+		return 0
+	}
+	if rl.remaining <= 0 {
+		return rl.reset
+	}
+	return rl.reset / time.Duration(rl.remaining)
+}
+
+// rateLimited slows host down ahead of a 429 when a response shows its
+// quota running low. The gap is capped by -max-wait like every adaptive
+// wait; a Retry-After on an actual 429 is handled by the retry path.
+func (jr *jobRun) rateLimited(host string, res dlResult) {
+	rl := res.Limit
+	if gap := jr.pace.limit(host, rl, time.Duration(jr.o.maxWait)*time.Second); gap > jr.interval() {
+		fmt.Fprintf(logAt(jr.o.verbosity, lvlVerbose), "[rate] %s: %d request(s) left, quota refills in %v; next request in %v\n",
+			host, rl.remaining, rl.reset.Round(time.Second), gap.Round(time.Millisecond))
+	}
+}
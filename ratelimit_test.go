@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   rateLimit
+	}{
+		{"none", nil, rateLimit{}},
+		{"x-ratelimit delta", map[string]string{"X-RateLimit-Remaining": "5", "X-RateLimit-Limit": "60", "X-RateLimit-Reset": "30"},
+			rateLimit{known: true, remaining: 5, limit: 60, reset: 30 * time.Second}},
+		{"reset-after", map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset-After": "1.5"},
+			rateLimit{known: true, remaining: 0, reset: 1500 * time.Millisecond}},
+		{"draft fields", map[string]string{"RateLimit-Remaining": "9", "RateLimit-Limit": "100, 100;w=60", "RateLimit-Reset": "12"},
+			rateLimit{known: true, remaining: 9, limit: 100, reset: 12 * time.Second}},
+		{"structured", map[string]string{"RateLimit": `"default";r=3;t=9, "burst";r=50;t=1`},
+			rateLimit{known: true, remaining: 3, reset: 9 * time.Second}},
+		{"long form", map[string]string{"RateLimit": "limit=10, remaining=2, reset=4"},
+			rateLimit{known: true, remaining: 2, limit: 10, reset: 4 * time.Second}},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.header {
+			h.Set(k, v)
+		}
+		if got := parseRateLimit(h); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitGap(t *testing.T) {
+	tests := []struct {
+		rl   rateLimit
+		want time.Duration
+	}{
+		{rateLimit{}, 0},
+		{rateLimit{known: true, remaining: 5}, 0}, // no reset time
+		{rateLimit{known: true, remaining: 0, reset: 20 * time.Second}, 20 * time.Second},
+		{rateLimit{known: true, remaining: 4, reset: 20 * time.Second}, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.rl.gap(); got != tt.want {
+			t.Errorf("%+v: gap %v, want %v", tt.rl, got, tt.want)
+		}
+	}
+}
+
+func TestParseResetTime(t *testing.T) {
+	if d := parseResetTime("45"); d != 45*time.Second {
+		t.Errorf("delta: %v", d)
+	}
+	if d := parseResetTime("soon"); d != 0 {
+		t.Errorf("garbage: %v", d)
+	}
+	epoch := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	if d := parseResetTime(epoch); d < 50*time.Second || d > time.Minute {
+		t.Errorf("epoch a minute ahead: %v", d)
+	}
+}
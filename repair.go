@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cmdRepair fetches again the pages verify flags: corrupt or zero-byte
+// files, SHA256SUMS or manifest mismatches and pages the manifest has as
+// saved but that are gone. The URL comes from the manifest, or failing that
+// from the page's .urls.txt/.xmp sidecar; requests are paced like a run.
+func cmdRepair(args []string) int {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	interval := fs.Int("interval", 6, "Base interval in seconds between pages")
+	retries := fs.Int("retries", 2, "Retry times per page on failure")
+	timeout := fs.Int("timeout", 30, "HTTP timeout in seconds")
+	ua := fs.String("ua", defaultUA, "User-Agent header")
+	sessionDir := fs.String("session-dir", defaultSessionDir(), "Directory for state shared between runs (host cooldowns)")
+	checkImages := fs.Bool("check-images", false, "Check every new copy is a complete PNG, JPEG, GIF or WEBP, as a run's -check-images does")
+	dryRun := fs.Bool("n", false, "Only list the pages that would be fetched again")
+	dir := folderArg(fs, args)
+
+	o := options{
+		interval: *interval, jitterFrac: 0.2, retries: *retries, timeout: *timeout, maxWait: 300, maxRetryAfter: -1, retryAfterPolicy: "cap",
+		backoff: 2, backoffStrategy: backoffExponential, backoffSteps: 6, ua: *ua,
+		verbosity: lvlNormal, sessionDir: *sessionDir, serverMtime: true, checkImages: *checkImages,
+	}
+	fixed, failed, err := repairFolder(dir, o, *dryRun)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	if *dryRun {
+		fmt.Printf("%d page(s) to fetch again, %d without a source URL\n", fixed, failed)
+		return exitOK
+	}
+	fmt.Printf("%d page(s) repaired, %d not\n", fixed, failed)
+	if failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// repairFolder fetches the flagged pages of dir again, each over its old
+// copy through the usual .part file, and records the outcome in the
+// manifest. It returns how many pages were repaired and how many were not.
+func repairFolder(dir string, o options, dryRun bool) (fixed, failed int, err error) {
+	_, problems, err := verifyFolder(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	m, more, err := verifyManifest(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	type target struct{ file, url string }
+	var todo []target
+	seen := map[string]bool{}
+	for _, p := range append(problems, more...) {
+		if seen[p.File] {
+			continue
+		}
+		seen[p.File] = true
+		u := sourceURL(p.File)
+		if mp := m.Pages[filepath.Base(p.File)]; mp != nil && mp.URL != "" {
+			u = mp.URL
+		}
+		if u == "" {
+			fmt.Printf("[skip] %s (%s): no source URL in the manifest or sidecars\n", p.File, p.Reason)
+			failed++
+			continue
+		}
+		todo = append(todo, target{p.File, u})
+	}
+	if dryRun {
+		for _, t := range todo {
+			fmt.Printf("[redo] %s <- %s\n", t.file, t.url)
+		}
+		return len(todo), failed, nil
+	}
+	if len(todo) == 0 {
+		return 0, failed, nil
+	}
+
+	client, err := newHTTPClient(nil, time.Duration(o.timeout)*time.Second)
+	if err != nil {
+		return 0, 0, err
+	}
+	s, err := newSession(o, client)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer s.cancel()
+	run := newRunID()
+	for i, t := range todo {
+		jr := &jobRun{session: s, ctx: s.ctx, xfer: s.base, o: o}
+		if u, err := url.Parse(t.url); err == nil {
+			jr.host = u.Host
+		}
+		if i > 0 {
+			jr.sleep(jr.interval())
+		}
+		fmt.Printf("[redo] %s <- %s\n", t.file, t.url)
+		res := jr.get(t.url, t.file)
+		for attempt := 1; attempt <= o.retries && (res.Err != nil || res.StatusCode != http.StatusOK); attempt++ {
+			wait, _ := jr.backoffWait(attempt)
+			if limit := time.Duration(o.maxWait) * time.Second; wait > limit {
+				wait = limit
+			}
+			if res.RetryAfter > 0 {
+				wait, _ = o.retryAfter(res.RetryAfter) // repair retries whatever it is told
+			}
+			jr.sleep(wait)
+			fmt.Printf("[retry %d/%d] %s\n", attempt, o.retries, t.url)
+			res = jr.get(t.url, t.file)
+		}
+		if res.Err != nil || res.StatusCode != http.StatusOK {
+			// The old copy and its entry stay as they were, so verify
+			// still flags the page.
+			fmt.Printf("[fail] %s (%v, status=%d)\n", t.file, res.Err, res.StatusCode)
+			failed++
+			continue
+		}
+		ps := pageState{URL: t.url, Status: pageOK, Code: res.StatusCode}
+		if mp := m.Pages[filepath.Base(t.file)]; mp != nil {
+			ps.Num = mp.Num
+		}
+		fmt.Printf("[ ok ] %s\n", filepath.Base(t.file))
+		fixed++
+		m.add(run, ps, t.file, res)
+	}
+	if err := m.save(); err != nil {
+		return fixed, failed, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "SHA256SUMS")); err == nil && fixed > 0 {
+		fmt.Println("[WARN] SHA256SUMS may be stale now; run qxdl export -export sha256 to rewrite it")
+	}
+	return fixed, failed, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepairKeepsTheEntryOfAPageItCouldNotFetch(t *testing.T) {
+	body := map[string][]byte{"/1.pdf": []byte("%PDF-1.7 fresh copy")}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b, ok := body[r.URL.Path]; ok {
+			w.Write(b)
+			return
+		}
+		http.Error(w, "gone", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	m, _ := loadManifest(dir)
+	for i, name := range []string{"1.pdf", "2.pdf"} {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte("good"), 0o644)
+		sum, _, _ := hashFile(file, false)
+		m.add("r1", pageState{Num: i + 1, URL: srv.URL + "/" + name, Status: pageOK}, file, dlResult{Size: 4, SHA256: sum})
+		os.WriteFile(file, []byte("bad!"), 0o644) // same size, other content
+	}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+	before := *m.Pages["2.pdf"]
+
+	o := testOptions(t)
+	o.interval, o.retries, o.jitterFrac = 0, 0, 0
+	fixed, failed, err := repairFolder(dir, o, false)
+	if err != nil || fixed != 1 || failed != 1 {
+		t.Fatalf("repair = %d fixed, %d failed, %v; want 1, 1", fixed, failed, err)
+	}
+	m, _ = loadManifest(dir)
+	if got := m.Pages["2.pdf"]; got.Status != pageOK || got.SHA256 != before.SHA256 || len(got.Attempts) != len(before.Attempts) {
+		t.Errorf("failed page's entry changed: %+v, was %+v", got, before)
+	}
+	_, problems, _ := verifyManifest(dir)
+	if len(problems) != 1 || filepath.Base(problems[0].File) != "2.pdf" {
+		t.Errorf("verify after repair = %v, want only 2.pdf", problems)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// folderReport summarizes what a download folder holds.
+type folderReport struct {
+	Folder  string `json:"folder"`
+	Pages   int    `json:"pages"`
+	First   int    `json:"first"`
+	Last    int    `json:"last"`
+	Missing []int  `json:"missing"`
+	Bytes   int64  `json:"bytes"`
+	Partial int    `json:"partial_files"`
+}
+
+// runReport is the -report summary of a whole run, one entry per job.
+type runReport struct {
+	Started    time.Time   `json:"started"`
+	Duration   float64     `json:"duration_seconds"`
+	Jobs       int         `json:"jobs"`
+	JobsFailed int         `json:"jobs_failed"`
+	Pages      jobProgress `json:"pages"`
+	WireBytes  int64       `json:"wire_bytes"` // received; pages.bytes counts them decompressed
+	FailedURLs []string    `json:"failed_urls"`
+	Results    []jobReport `json:"results"`
+}
+
+// writeReport writes the -report summary to its file, or to stdout for "-".
+func (s *session) writeReport() {
+	if s.o.report == "" {
+		return
+	}
+	r := runReport{Started: s.started, Duration: time.Since(s.started).Round(time.Millisecond).Seconds(),
+		Jobs: len(s.reports), WireBytes: s.stats.received(), FailedURLs: []string{}, Results: s.reports}
+	if r.Results == nil {
+		r.Results = []jobReport{}
+	}
+	for i, jr := range s.reports {
+		r.Results[i].Text, r.Results[i].Content = "", "" // only for chat webhooks
+		if jr.Event != "finished" {
+			r.JobsFailed++
+		}
+		r.Pages.OK += jr.Pages.OK
+		r.Pages.Skipped += jr.Pages.Skipped
+		r.Pages.Missing += jr.Pages.Missing
+		r.Pages.Failed += jr.Pages.Failed
+		r.Pages.Bytes += jr.Pages.Bytes
+		r.FailedURLs = append(r.FailedURLs, jr.FailedURLs...)
+	}
+	b, _ := json.MarshalIndent(r, "", "  ")
+	if s.o.report == "-" {
+		fmt.Println(string(b))
+		return
+	}
+	err := os.WriteFile(s.o.report+".part", append(b, '\n'), 0o644)
+	if err == nil {
+		err = os.Rename(s.o.report+".part", s.o.report)
+	}
+	if err != nil {
+		fmt.Println("[WARN] report:", err)
+	}
+}
+
+func reportFolder(dir string) (folderReport, error) {
+	rep := folderReport{Folder: dir, Missing: []int{}}
+	pages, err := scanFolder(dir)
+	if err != nil {
+		return rep, err
+	}
+	rep.Pages = len(pages)
+	for i, p := range pages {
+		rep.Bytes += p.Size
+		if i == 0 {
+			rep.First = p.Num
+		} else {
+			for n := pages[i-1].Num + 1; n < p.Num; n++ {
+				rep.Missing = append(rep.Missing, n)
+			}
+		}
+		rep.Last = p.Num
+	}
+	parts, _ := filepath.Glob(filepath.Join(dir, "*.part"))
+	rep.Partial = len(parts)
+	return rep, nil
+}
+
+// normalizeFolder renames pages to a uniform zero padding (0 = widest in use)
+// and lower-case canonical extensions, keeping any name prefix and carrying
+// sidecars along.
+func normalizeFolder(dir string, pad int, dryRun bool) (int, error) {
+	pages, err := scanFolder(dir)
+	if err != nil {
+		return 0, err
+	}
+	if pad <= 0 {
+		for _, p := range pages {
+			pad = max(pad, p.Pad)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	renamed := map[string]string{}
+	for _, p := range pages {
+		ext := strings.ToLower(p.Ext)
+		if ext == "jpeg" {
+			ext = "jpg"
+		}
+		oldName := filepath.Base(p.File)
+		newName := p.Prefix + itoaPad(p.Num, pad) + "." + ext
+		if oldName == newName {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, newName)); err == nil && !strings.EqualFold(oldName, newName) {
+			return len(renamed), fmt.Errorf("%s: %s already exists", oldName, newName)
+		}
+		fmt.Printf("[norm] %s -> %s\n", oldName, newName)
+		renamed[oldName] = newName
+		if dryRun {
+			continue
+		}
+		if err := os.Rename(p.File, filepath.Join(dir, newName)); err != nil {
+			return len(renamed), err
+		}
+		for _, e := range entries {
+			if side, ok := strings.CutPrefix(e.Name(), oldName+"."); ok {
+				if err := os.Rename(filepath.Join(dir, e.Name()), filepath.Join(dir, newName+"."+side)); err != nil {
+					return len(renamed), err
+				}
+			}
+		}
+	}
+	if len(renamed) > 0 && !dryRun {
+		if err := renameInSums(dir, renamed); err != nil {
+			return len(renamed), err
+		}
+		if err := renameInManifest(dir, renamed); err != nil {
+			return len(renamed), err
+		}
+	}
+	return len(renamed), nil
+}
+
+func renameInSums(dir string, renamed map[string]string) error {
+	name := filepath.Join(dir, "SHA256SUMS")
+	b, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(b), "\n")
+	for i, line := range lines {
+		if sum, file, ok := strings.Cut(line, "  "); ok {
+			if nn, ok := renamed[file]; ok {
+				lines[i] = sum + "  " + nn
+			}
+		}
+	}
+	if err := os.WriteFile(name+".part", []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(name+".part", name)
+}
+
+// renameInManifest moves the renamed pages' manifest entries, which are kept
+// by file name, along with them.
+func renameInManifest(dir string, renamed map[string]string) error {
+	if _, err := os.Stat(filepath.Join(dir, manifestFile)); os.IsNotExist(err) {
+		return nil
+	}
+	m, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+	pages := make(map[string]*manifestPage, len(m.Pages))
+	for name, p := range m.Pages {
+		if nn, ok := renamed[name]; ok {
+			name = nn
+		}
+		pages[name] = p
+	}
+	m.Pages = pages
+	return m.save()
+}
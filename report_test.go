@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeKeepsTheManifestInStep(t *testing.T) {
+	dir := t.TempDir()
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"1.png", "2.png", "10.png"} {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte("page "+name), 0o644)
+		m.add("r1", pageState{Num: i + 1, Status: pageOK}, file, dlResult{Size: int64(len("page " + name))})
+	}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+	writeSHA256Sums(dir, []exportPage{{File: filepath.Join(dir, "1.png")}, {File: filepath.Join(dir, "2.png")}, {File: filepath.Join(dir, "10.png")}})
+
+	n, err := normalizeFolder(dir, 3, false)
+	if err != nil || n != 3 {
+		t.Fatalf("normalize = %d, %v", n, err)
+	}
+	_, problems, err := verifyManifest(dir)
+	if err != nil || len(problems) > 0 {
+		t.Errorf("verify after normalize = %v, %v", problems, err)
+	}
+	m, _ = loadManifest(dir)
+	for _, name := range []string{"001.png", "002.png", "010.png"} {
+		if m.Pages[name] == nil {
+			t.Errorf("manifest has no %s: %v", name, m.Pages)
+		}
+	}
+	if len(m.Pages) != 3 {
+		t.Errorf("manifest has %d pages, want 3", len(m.Pages))
+	}
+	if problems := verifySums(t, dir); len(problems) > 0 {
+		t.Errorf("SHA256SUMS after normalize: %v", problems)
+	}
+}
+
+func verifySums(t *testing.T, dir string) []string {
+	t.Helper()
+	sums, err := readSums(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var problems []string
+	for name, want := range sums {
+		if got, err := fileSHA256(filepath.Join(dir, name)); err != nil || got != want {
+			problems = append(problems, name)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testOptions are the command line defaults, quiet, without jitter and with
+// the session kept in a temporary folder.
+func testOptions(t *testing.T) options {
+	return options{
+		interval: 6, retries: 2, timeout: 30, maxWait: 300, backoff: 2, maxErrors: 8,
+		backoffStrategy: backoffExponential, backoffSteps: 6,
+		ext: "png", ua: defaultUA, verbosity: lvlQuiet, sessionDir: t.TempDir(),
+		banThresh: 2, banCooloff: 24 * time.Hour, hostMemory: true,
+		nameTmpl: "{num}.{ext}", autoStop: 3, keepRuns: 20, headGap: time.Second, step: 1,
+		tileTmpl: "{num}_{part}.{ext}", onAnomaly: "off", onChallenge: "pause", anomalyRatio: 10,
+		onLowDisk: "pause", onDuplicate: "off", onLocked: "fail", maxRetryAfter: -1, retryAfterPolicy: "cap", serverMtime: true, altExts: parseAltExts("none"),
+		save: saving{chunks: chunking{n: 1}},
+	}
+}
+
+// testSession runs against srv on a fake clock.
+func testSession(t *testing.T, o options, srv *fakeServer) (*session, *fakeClock) {
+	t.Helper()
+	s, err := newSession(o, &http.Client{Transport: srv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.cancel)
+	c := newFakeClock()
+	s.pace.clock, s.pace.sleeper = c, c
+	return s, c
+}
+
+func testJob(t *testing.T, start, end string) job {
+	return job{URL: "http://pages.example/book/" + start + ".png", Start: start, End: end, Out: t.TempDir()}
+}
+
+func hasSleep(slept []time.Duration, d time.Duration) bool {
+	for _, s := range slept {
+		if s == d {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRetryAfterIsWaitedOut(t *testing.T) {
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {
+			{status: 429, header: map[string]string{"Retry-After": "120"}},
+			{status: 200, body: "page one"},
+		},
+	}}
+	s, c := testSession(t, testOptions(t), srv)
+	j := testJob(t, "01", "01")
+	start := time.Now()
+	res, err := s.runJob(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Pages.OK != 1 {
+		t.Fatalf("pages: %+v", res.Pages)
+	}
+	if !hasSleep(c.sleeps(), 120*time.Second) {
+		t.Errorf("sleeps %v do not include the 2m Retry-After", c.sleeps())
+	}
+	if took := time.Since(start); took > 10*time.Second {
+		t.Errorf("the test took %v of real time", took)
+	}
+	if b, err := os.ReadFile(filepath.Join(j.Out, "01.png")); err != nil || string(b) != "page one" {
+		t.Errorf("saved %q, %v", b, err)
+	}
+	if hr := s.hosts["pages.example"]; hr == nil || hr.Throttled != 1 || hr.Requests != 2 {
+		t.Errorf("host memory: %+v", hr)
+	}
+}
+
+func TestRetryAfterIsCappedByMaxWait(t *testing.T) {
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {
+			{status: 503, header: map[string]string{"Retry-After": "86400"}},
+			{status: 200, body: "page one"},
+		},
+	}}
+	o := testOptions(t)
+	o.maxWait = 90
+	s, c := testSession(t, o, srv)
+	if _, err := s.runJob(testJob(t, "01", "01")); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range c.sleeps() {
+		if d > 90*time.Second {
+			t.Fatalf("slept %v past -max-wait 90", d)
+		}
+	}
+	if !hasSleep(c.sleeps(), 90*time.Second) {
+		t.Errorf("sleeps %v do not include the capped 90s", c.sleeps())
+	}
+}
+
+func TestRetryAfterPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy  string
+		slept   time.Duration
+		aborted bool
+	}{
+		{"cap", 600 * time.Second, false},
+		{"honor", 3600 * time.Second, false},
+		{"abort", 0, true},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			srv := &fakeServer{replies: map[string][]reply{
+				"http://pages.example/book/01.png": {
+					{status: 429, header: map[string]string{"Retry-After": "3600"}},
+					{status: 200, body: "page one"},
+				},
+			}}
+			o := testOptions(t)
+			o.maxWait, o.maxRetryAfter, o.retryAfterPolicy = 60, 600, tc.policy
+			s, c := testSession(t, o, srv)
+			res, err := s.runJob(testJob(t, "01", "01"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Aborted != tc.aborted || tc.aborted && (!res.Banned || len(srv.requests()) != 1) {
+				t.Fatalf("result %+v after %d request(s)", res, len(srv.requests()))
+			}
+			if tc.slept > 0 && !hasSleep(c.sleeps(), tc.slept) {
+				t.Errorf("sleeps %v do not include %v", c.sleeps(), tc.slept)
+			}
+			for _, d := range c.sleeps() {
+				if d > max(tc.slept, time.Duration(o.interval)*time.Second) {
+					t.Errorf("slept %v", d)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeoutsBackOffThenFail(t *testing.T) {
+	timeout := &timeoutError{}
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {{err: timeout}},
+	}}
+	o := testOptions(t)
+	o.interval = 1
+	s, c := testSession(t, o, srv)
+	res, err := s.runJob(testJob(t, "01", "01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Pages.Failed != 1 {
+		t.Fatalf("pages: %+v", res.Pages)
+	}
+	if n := len(srv.requests()); n != 1+o.retries {
+		t.Errorf("%d request(s), want %d", n, 1+o.retries)
+	}
+	// the first failure backs off one step (1s x 2), each failed retry waits the interval
+	want := []time.Duration{2 * time.Second, time.Second, time.Second}
+	got := c.sleeps()
+	if len(got) < len(want) {
+		t.Fatalf("sleeps %v, want %v first", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sleeps %v, want %v first", got, want)
+		}
+	}
+}
+
+func TestEndAutoStopsAfter404s(t *testing.T) {
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {{status: 200, body: "1"}},
+		"http://pages.example/book/02.png": {{status: 200, body: "2"}},
+	}}
+	o := testOptions(t)
+	o.probePad = false
+	s, c := testSession(t, o, srv)
+	res, err := s.runJob(testJob(t, "01", "auto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Pages.OK != 2 || res.EndFound != "02" {
+		t.Errorf("pages %+v, end found %q", res.Pages, res.EndFound)
+	}
+	if n := len(srv.requests()); n != 2+o.autoStop {
+		t.Errorf("%d request(s), want %d", n, 2+o.autoStop)
+	}
+	// every request after the first is spaced by the interval
+	if c.total() < time.Duration(len(srv.requests())-1)*6*time.Second {
+		t.Errorf("slept %v for %d requests", c.total(), len(srv.requests()))
+	}
+}
+
+func TestRenameStartNumbersFromOne(t *testing.T) {
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/0064.png": {{status: 200, body: "64"}},
+		"http://pages.example/book/0066.png": {{status: 200, body: "66"}},
+	}}
+	o := testOptions(t)
+	o.step, o.renameFrom = 2, "01"
+	s, _ := testSession(t, o, srv)
+	j := testJob(t, "0064", "0066")
+	if _, err := s.runJob(j); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"01.png": "64", "02.png": "66"} {
+		if b, err := os.ReadFile(filepath.Join(j.Out, name)); err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v; want %q", name, b, err, want)
+		}
+	}
+}
+
+func TestCompleteFolderIsSkipped(t *testing.T) {
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {{status: 200, body: "1"}},
+		"http://pages.example/book/02.png": {{status: 200, body: "2"}},
+	}}
+	o := testOptions(t)
+	o.probePad = false
+	s, _ := testSession(t, o, srv)
+	j := testJob(t, "01", "auto")
+	if _, err := s.runJob(j); err != nil {
+		t.Fatal(err)
+	}
+	m := readComplete(j.Out)
+	if m == nil || m.Pages != 2 || m.EndFound != "02" {
+		t.Fatalf("marker %+v", m)
+	}
+	sent := len(srv.requests())
+	res, err := s.runJob(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.requests()); n != sent {
+		t.Errorf("%d request(s) for a complete folder", n-sent)
+	}
+	if res.Pages.Skipped != 2 || res.EndFound != "02" {
+		t.Errorf("second run: %+v", res)
+	}
+	// another range into the same folder is not covered by the marker
+	j.End = "02"
+	if _, err := s.runJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if m := readComplete(j.Out); m == nil || m.End != "02" {
+		t.Errorf("marker after the fixed range: %+v", m)
+	}
+}
+
+func TestFailedPageLeavesNoMarker(t *testing.T) {
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {{status: 200, body: "1"}},
+		"http://pages.example/book/02.png": {{status: 500}},
+	}}
+	o := testOptions(t)
+	o.retries = 0
+	s, _ := testSession(t, o, srv)
+	j := testJob(t, "01", "02")
+	if _, err := s.runJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if m := readComplete(j.Out); m != nil {
+		t.Errorf("marker %+v after a failed page", m)
+	}
+}
+
+func TestStoppedRunSendsNothing(t *testing.T) {
+	srv := &fakeServer{}
+	s, _ := testSession(t, testOptions(t), srv)
+	s.cancel()
+	jr := &jobRun{session: s, ctx: s.ctx, xfer: s.base, o: s.o, host: "pages.example"}
+	res := jr.get("http://pages.example/book/01.png", filepath.Join(t.TempDir(), "01.png"))
+	if !errors.Is(res.Err, context.Canceled) || len(srv.requests()) != 0 {
+		t.Errorf("err %v after %d request(s)", res.Err, len(srv.requests()))
+	}
+}
+
+func TestInterruptStopsTheRun(t *testing.T) {
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {{status: 200, body: "1"}},
+		"http://pages.example/book/02.png": {{status: 200, body: "2"}},
+	}}
+	s, _ := testSession(t, testOptions(t), srv)
+	s.pace.sleeper = realClock{} // a real 6s wait, cut short below
+	time.AfterFunc(50*time.Millisecond, func() { s.stop(errInterrupted) })
+	start := time.Now()
+	res, err := s.runJob(testJob(t, "01", "02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > 3*time.Second {
+		t.Errorf("stopping took %v", took)
+	}
+	if !res.Stopped || res.Pages.OK != 1 || len(srv.requests()) != 1 {
+		t.Errorf("stopped %v, pages %+v after %d request(s)", res.Stopped, res.Pages, len(srv.requests()))
+	}
+	if code := jobExitCode(res, nil); code != exitInterrupted {
+		t.Errorf("exit code %d", code)
+	}
+}
+
+// slowPage serves every page in two halves, the second after a pause.
+func slowPage(pause time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "8")
+		w.Write([]byte("half"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(pause):
+			w.Write([]byte("page"))
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+func TestMaxDurationFinishesThePageInProgress(t *testing.T) {
+	srv := slowPage(300 * time.Millisecond)
+	defer srv.Close()
+	o := testOptions(t)
+	o.maxDuration = 100 * time.Millisecond
+	s, err := newSession(o, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.cancel()
+	j := job{URL: srv.URL + "/book/01.png", Start: "01", End: "02", Out: t.TempDir()}
+	res, err := s.runJob(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Stopped || res.Pages.OK != 1 {
+		t.Errorf("stopped %v, pages %+v", res.Stopped, res.Pages)
+	}
+	if b, err := os.ReadFile(filepath.Join(j.folder(), "01.png")); string(b) != "halfpage" {
+		t.Errorf("page 01 = %q, %v", b, err)
+	}
+}
+
+func TestInterruptCutsTheTransferShort(t *testing.T) {
+	srv := slowPage(time.Minute)
+	defer srv.Close()
+	s, err := newSession(testOptions(t), srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.cancel()
+	time.AfterFunc(100*time.Millisecond, func() { s.stop(errInterrupted) })
+	start := time.Now()
+	res, err := s.runJob(job{URL: srv.URL + "/book/01.png", Start: "01", End: "02", Out: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > 3*time.Second || res.Pages.OK != 0 {
+		t.Errorf("stopping took %v, pages %+v", took, res.Pages)
+	}
+}
+
+func TestCancelThroughAPIEndsTheWait(t *testing.T) {
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {{status: 200, body: "1"}},
+		"http://pages.example/book/02.png": {{status: 200, body: "2"}},
+	}}
+	s, _ := testSession(t, testOptions(t), srv)
+	s.pace.sleeper = realClock{}
+	s.ctl = newJobControl()
+	time.AfterFunc(50*time.Millisecond, s.ctl.cancel)
+	start := time.Now()
+	res, err := s.runJob(testJob(t, "01", "02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > 3*time.Second {
+		t.Errorf("canceling took %v", took)
+	}
+	if !res.Canceled || s.ctx.Err() != nil {
+		t.Errorf("canceled %v, run context %v", res.Canceled, s.ctx.Err())
+	}
+}
+
+// timeoutError is what the client returns when -timeout runs out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "Client.Timeout exceeded while awaiting headers" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
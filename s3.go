@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Sink uploads pages to an S3-compatible bucket for -out s3://bucket/prefix,
+// with the usual AWS_* environment: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN, AWS_REGION, and AWS_ENDPOINT_URL_S3 (or
+// AWS_ENDPOINT_URL) for other providers. Requests are signed with SigV4 by
+// hand to keep the dependency list short.
+type s3Sink struct {
+	bucket   string
+	endpoint *url.URL // nil = AWS, virtual-hosted style
+	region   string
+	key      string
+	secret   string
+	token    string
+	client   *http.Client
+}
+
+// isS3 reports whether an -out value names a bucket.
+func isS3(out string) bool {
+	return strings.HasPrefix(out, "s3://")
+}
+
+// newS3Sink checks the credentials and splits s3://bucket/prefix; the prefix
+// is where the job's pages are named, like a folder.
+func newS3Sink(out string) (*s3Sink, string, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(out, "s3://"), "/")
+	if bucket == "" {
+		return nil, "", fmt.Errorf("out %q names no bucket", out)
+	}
+	s := &s3Sink{
+		bucket: bucket,
+		region: orDefault(os.Getenv("AWS_REGION"), orDefault(os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")),
+		key:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:  os.Getenv("AWS_SESSION_TOKEN"),
+		// the bucket is not the site being downloaded, so it is not paced
+		client: &http.Client{Timeout: 2 * time.Minute},
+	}
+	if s.key == "" || s.secret == "" {
+		return nil, "", errors.New("-out s3:// needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if ep := orDefault(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")); ep != "" {
+		u, err := url.Parse(ep)
+		if err != nil || u.Host == "" {
+			return nil, "", fmt.Errorf("bad S3 endpoint %q", ep)
+		}
+		s.endpoint = u
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		prefix = "."
+	}
+	return s, prefix, nil
+}
+
+// objectURL is where key lives: path style on a custom endpoint, virtual
+// hosted on AWS.
+func (s *s3Sink) objectURL(key string) *url.URL {
+	u := &url.URL{Scheme: "https", Host: s.bucket + ".s3." + s.region + ".amazonaws.com", Path: "/" + key}
+	if s.endpoint != nil {
+		c := *s.endpoint
+		c.Path = path.Join("/", c.Path, s.bucket, key)
+		u = &c
+	}
+	// SigV4 wants everything but unreserved characters and / escaped, and
+	// the request must carry the path exactly as signed
+	var b strings.Builder
+	for _, c := range []byte(u.Path) {
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	u.RawPath = b.String()
+	return u
+}
+
+func (s *s3Sink) put(name string, body []byte, modified time.Time) error {
+	req, err := http.NewRequest("PUT", s.objectURL(path.Clean(filepathToKey(name))).String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		req.Header.Set("Content-Type", ct)
+	}
+	if !modified.IsZero() {
+		req.Header.Set("X-Amz-Meta-Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	resp, err := s.do(req, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 put %s: %s: %s", name, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// exists asks the bucket for name, so reruns skip uploaded pages like
+// files on disk.
+func (s *s3Sink) exists(name string) bool {
+	req, err := http.NewRequest("HEAD", s.objectURL(path.Clean(filepathToKey(name))).String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (s *s3Sink) close() error { return nil }
+
+// do signs req with AWS Signature Version 4 and sends it.
+func (s *s3Sink) do(req *http.Request, body []byte) (*http.Response, error) {
+	now := time.Now().UTC()
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+
+	// sign host and every x-amz-* header
+	signed := []string{"host"}
+	for k := range req.Header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-") {
+			signed = append(signed, lk)
+		}
+	}
+	sort.Strings(signed)
+	var canonHeaders strings.Builder
+	for _, k := range signed {
+		v := req.URL.Host
+		if k != "host" {
+			v = strings.TrimSpace(req.Header.Get(k))
+		}
+		canonHeaders.WriteString(k + ":" + v + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery,
+		canonHeaders.String(), signedHeaders, payload}, "\n")
+
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	creq := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(creq[:])
+	k := hmacSHA256([]byte("AWS4"+s.secret), day)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		k = hmacSHA256(k, part)
+	}
+	sig := hex.EncodeToString(hmacSHA256(k, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.key, scope, signedHeaders, sig))
+	return s.client.Do(req)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// filepathToKey turns a page path built with filepath.Join into an object key.
+func filepathToKey(name string) string {
+	return strings.TrimPrefix(strings.ReplaceAll(name, `\`, "/"), "./")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Folder and file names qxdl derives from URLs and templates are made safe
+// on every platform, the same way everywhere so a folder copied between
+// machines keeps matching its runs: characters Windows refuses become _,
+// trailing dots and spaces go, reserved device names get a leading _, and
+// a name too long for most filesystems is cut short with a hash of the
+// whole so distinct names stay distinct.
+
+// maxNameBytes leaves room under the common 255-byte limit for the .part
+// suffix and the sidecars' extensions.
+const maxNameBytes = 200
+
+var reservedNames = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true}
+
+func init() {
+	for _, d := range "123456789" {
+		reservedNames["COM"+string(d)] = true
+		reservedNames["LPT"+string(d)] = true
+	}
+}
+
+// sanitizeName makes one path component safe.
+func sanitizeName(name string) string {
+	clean := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	clean = strings.TrimRight(clean, ". ")
+	if clean == "" {
+		return "_"
+	}
+	stem, _, _ := strings.Cut(clean, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		clean = "_" + clean
+	}
+	if len(clean) > maxNameBytes {
+		ext := filepath.Ext(clean)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		h := sha256.Sum256([]byte(name))
+		keep := maxNameBytes - len(ext) - 9
+		for keep > 0 && !utf8.RuneStart(clean[keep]) {
+			keep--
+		}
+		clean = clean[:keep] + "~" + hex.EncodeToString(h[:4]) + ext
+	}
+	return clean
+}
+
+// sanitizePath makes every component of a slash-separated relative name
+// safe, and returns it in the platform's form. "." and ".." components are
+// replaced, so a name never leaves the folder it is meant for.
+func sanitizePath(name string) string {
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		switch p {
+		case "":
+		case ".", "..":
+			parts = append(parts, "_")
+		default:
+			parts = append(parts, sanitizeName(p))
+		}
+	}
+	return filepath.Join(parts...)
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// -from-page: fetch one gallery or chapter page, pick the page images out of
+// it with -selector and download them in document order. The HTML is read
+// with a small tag scanner rather than a full parser; a selector only needs
+// start tags, their attributes and which elements they sit inside.
+
+// maxIndexPage bounds how much of the index page is read.
+const maxIndexPage = 8 << 20
+
+// pageSelector matches elements with a CSS selector list, or the raw HTML
+// with a regular expression ("re:" prefix).
+type pageSelector struct {
+	alts [][]compound // selector list; each is a descendant chain, outermost first
+	re   *regexp.Regexp
+}
+
+// compound is one simple selector like img.page#p1[data-src].
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatch
+}
+
+type attrMatch struct {
+	name, op, val string // op is "" (present), =, ~=, ^=, $= or *=
+}
+
+// parseSelector accepts tag, #id, .class and [attr], [attr=v], [attr^=v],
+// [attr$=v], [attr*=v], [attr~=v], descendants separated by spaces and
+// alternatives by commas. "re:PATTERN" is a regular expression instead;
+// its first group (or the whole match) is the URL.
+func parseSelector(s string) (*pageSelector, error) {
+	if p, ok := strings.CutPrefix(s, "re:"); ok {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("selector: %w", err)
+		}
+		return &pageSelector{re: re}, nil
+	}
+	sel := &pageSelector{}
+	for _, alt := range strings.Split(s, ",") {
+		var chain []compound
+		for _, part := range strings.Fields(alt) {
+			c, err := parseCompound(part)
+			if err != nil {
+				return nil, fmt.Errorf("selector %q: %w", s, err)
+			}
+			chain = append(chain, c)
+		}
+		if len(chain) == 0 {
+			return nil, fmt.Errorf("selector %q: empty alternative", s)
+		}
+		sel.alts = append(sel.alts, chain)
+	}
+	return sel, nil
+}
+
+func parseCompound(s string) (compound, error) {
+	var c compound
+	name := func(i int) int {
+		j := i
+		for j < len(s) && (s[j] == '-' || s[j] == '_' || s[j] >= '0' && s[j] <= '9' || s[j]|0x20 >= 'a' && s[j]|0x20 <= 'z') {
+			j++
+		}
+		return j
+	}
+	i := name(0)
+	c.tag = strings.ToLower(s[:i])
+	if c.tag == "" && i < len(s) && s[i] == '*' {
+		i++
+	}
+	for i < len(s) {
+		switch s[i] {
+		case '#', '.':
+			j := name(i + 1)
+			if j == i+1 {
+				return c, fmt.Errorf("missing name after %q", s[i])
+			}
+			if s[i] == '#' {
+				c.id = s[i+1 : j]
+			} else {
+				c.classes = append(c.classes, s[i+1:j])
+			}
+			i = j
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return c, errors.New("unclosed [")
+			}
+			body := s[i+1 : i+end]
+			a := attrMatch{name: strings.ToLower(body)}
+			if k := strings.IndexByte(body, '='); k > 0 {
+				a.name, a.op, a.val = body[:k], "=", strings.Trim(body[k+1:], `"'`)
+				if strings.ContainsRune("~^$*", rune(body[k-1])) {
+					a.name, a.op = body[:k-1], body[k-1:k+1]
+				}
+				a.name = strings.ToLower(a.name)
+			}
+			c.attrs = append(c.attrs, a)
+			i += end + 1
+		case '>', '+', '~':
+			return c, fmt.Errorf("combinator %q is not supported; use a space", s[i])
+		default:
+			return c, fmt.Errorf("unexpected %q", s[i])
+		}
+	}
+	return c, nil
+}
+
+// element is a start tag as the scanner saw it.
+type element struct {
+	tag   string
+	attrs map[string]string
+}
+
+func (c compound) matches(e element) bool {
+	if c.tag != "" && c.tag != e.tag {
+		return false
+	}
+	if c.id != "" && e.attrs["id"] != c.id {
+		return false
+	}
+	have := strings.Fields(e.attrs["class"])
+	for _, cl := range c.classes {
+		found := false
+		for _, h := range have {
+			found = found || h == cl
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, a := range c.attrs {
+		v, ok := e.attrs[a.name]
+		switch {
+		case !ok:
+			return false
+		case a.op == "=" && v != a.val,
+			a.op == "^=" && !strings.HasPrefix(v, a.val),
+			a.op == "$=" && !strings.HasSuffix(v, a.val),
+			a.op == "*=" && !strings.Contains(v, a.val):
+			return false
+		case a.op == "~=":
+			found := false
+			for _, f := range strings.Fields(v) {
+				found = found || f == a.val
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchChain reports whether e, inside the open elements stack (outermost
+// first), matches a descendant chain.
+func matchChain(chain []compound, stack []element, e element) bool {
+	if !chain[len(chain)-1].matches(e) {
+		return false
+	}
+	k := len(chain) - 2
+	for i := len(stack) - 1; i >= 0 && k >= 0; i-- {
+		if chain[k].matches(stack[i]) {
+			k--
+		}
+	}
+	return k < 0
+}
+
+// voidTags never have an end tag, so they are not kept on the stack.
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// scanTags calls fn for every start tag in doc with the elements it sits in.
+// Comments, doctypes and the insides of script and style are skipped.
+func scanTags(doc string, fn func(stack []element, e element)) {
+	var stack []element
+	for i := 0; i < len(doc); {
+		lt := strings.IndexByte(doc[i:], '<')
+		if lt < 0 {
+			return
+		}
+		i += lt
+		switch {
+		case strings.HasPrefix(doc[i:], "<!--"):
+			end := strings.Index(doc[i+4:], "-->")
+			if end < 0 {
+				return
+			}
+			i += 4 + end + 3
+			continue
+		case strings.HasPrefix(doc[i:], "<!"), strings.HasPrefix(doc[i:], "<?"):
+			end := strings.IndexByte(doc[i:], '>')
+			if end < 0 {
+				return
+			}
+			i += end + 1
+			continue
+		case strings.HasPrefix(doc[i:], "</"):
+			end := strings.IndexByte(doc[i:], '>')
+			if end < 0 {
+				return
+			}
+			tag := strings.ToLower(strings.TrimSpace(doc[i+2 : i+end]))
+			for k := len(stack) - 1; k >= 0; k-- {
+				if stack[k].tag == tag {
+					stack = stack[:k]
+					break
+				}
+			}
+			i += end + 1
+			continue
+		}
+		e, n, selfClose := parseTag(doc[i:])
+		if n == 0 {
+			i++ // a stray '<' in text
+			continue
+		}
+		i += n
+		fn(stack, e)
+		if e.tag == "script" || e.tag == "style" {
+			end := strings.Index(strings.ToLower(doc[i:]), "</"+e.tag)
+			if end < 0 {
+				return
+			}
+			i += end
+			continue
+		}
+		if !voidTags[e.tag] && !selfClose {
+			stack = append(stack, e)
+		}
+	}
+}
+
+// parseTag reads the start tag at the beginning of s and returns how many
+// bytes it took, 0 if s does not start with one.
+func parseTag(s string) (e element, n int, selfClose bool) {
+	i := 1
+	for i < len(s) && (s[i]|0x20 >= 'a' && s[i]|0x20 <= 'z' || i > 1 && (s[i] >= '0' && s[i] <= '9' || s[i] == '-')) {
+		i++
+	}
+	if i == 1 {
+		return e, 0, false
+	}
+	e = element{tag: strings.ToLower(s[1:i]), attrs: map[string]string{}}
+	for i < len(s) {
+		for i < len(s) && strings.IndexByte(" \t\r\n\f", s[i]) >= 0 {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		if s[i] == '>' {
+			return e, i + 1, selfClose
+		}
+		if s[i] == '/' {
+			selfClose = true
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && strings.IndexByte(" \t\r\n\f=>/", s[j]) < 0 {
+			j++
+		}
+		name := strings.ToLower(s[i:j])
+		if j == i {
+			j++ // a stray character; step over it
+		}
+		i, selfClose = j, false
+		for i < len(s) && strings.IndexByte(" \t\r\n\f", s[i]) >= 0 {
+			i++
+		}
+		val := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && strings.IndexByte(" \t\r\n\f", s[i]) >= 0 {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				end := strings.IndexByte(s[i+1:], s[i])
+				if end < 0 {
+					return e, 0, false
+				}
+				val, i = s[i+1:i+1+end], i+end+2
+			} else {
+				j := i
+				for j < len(s) && strings.IndexByte(" \t\r\n\f>", s[j]) < 0 {
+					j++
+				}
+				val, i = s[i:j], j
+			}
+		}
+		if _, dup := e.attrs[name]; !dup && name != "" {
+			e.attrs[name] = html.UnescapeString(val)
+		}
+	}
+	return e, 0, false
+}
+
+// urlAttrs are tried in order on a matched element: lazy loaders keep the
+// real image in a data- attribute and put a placeholder in src.
+var urlAttrs = []string{"data-src", "data-original", "data-lazy-src", "data-url", "src", "href", "srcset"}
+
+func elementURL(e element) string {
+	for _, a := range urlAttrs {
+		v := strings.TrimSpace(e.attrs[a])
+		if a == "srcset" {
+			v, _, _ = strings.Cut(v, " ") // first candidate
+		}
+		if v != "" && !strings.HasPrefix(v, "data:") {
+			return v
+		}
+	}
+	return ""
+}
+
+// extract returns the page URLs doc holds, resolved against base (or the
+// page's own <base href>), in document order without repeats.
+func (sel *pageSelector) extract(doc string, base *url.URL) []string {
+	var raw []string
+	if sel.re != nil {
+		for _, m := range sel.re.FindAllStringSubmatch(doc, -1) {
+			v := m[0]
+			if len(m) > 1 {
+				v = m[1]
+			}
+			raw = append(raw, html.UnescapeString(v))
+		}
+	}
+	scanTags(doc, func(stack []element, e element) {
+		if e.tag == "base" && e.attrs["href"] != "" {
+			if b, err := base.Parse(e.attrs["href"]); err == nil {
+				base = b
+			}
+		}
+		for _, chain := range sel.alts {
+			if matchChain(chain, stack, e) {
+				if v := elementURL(e); v != "" {
+					raw = append(raw, v)
+				}
+				return
+			}
+		}
+	})
+	seen := map[string]bool{}
+	var urls []string
+	for _, v := range raw {
+		u, err := base.Parse(strings.TrimSpace(v))
+		if err != nil || !isSourceURL(u.String()) || seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		urls = append(urls, u.String())
+	}
+	return urls
+}
+
+// fetchIndexPage GETs the page (or feed, or manifest) that lists the pages
+// and returns it with the URL it ended up at after redirects, which relative
+// links resolve against.
+func fetchIndexPage(ctx context.Context, client *http.Client, pageURL, ua, accept string, timeout time.Duration) (string, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", ua)
+	req.Header.Set("Accept", accept+",*/*;q=0.8")
+	c := *client
+	c.Timeout = timeout
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("%s answered %s", pageURL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxIndexPage))
+	if err != nil {
+		return "", nil, err
+	}
+	return string(b), resp.Request.URL, nil
+}
+
+// scrapeURLSource fetches the index page and lists the pages on it as a
+// urlSource, so the run treats them like -url-cmd lines.
+func (jr *jobRun) scrapeURLSource(pageURL, selector string) (*urlSource, error) {
+	sel, err := parseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	host := jr.host
+	if u, err := url.Parse(pageURL); err == nil {
+		host = u.Host
+	}
+	jr.pace.before(jr.ctx, host, "GET", jr.getGap())
+	fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[page] %s\n", pageURL)
+	doc, base, err := fetchIndexPage(jr.ctx, jr.client, pageURL, jr.o.ua, "text/html,application/xhtml+xml;q=0.9", jr.timeout())
+	if err != nil {
+		return nil, fmt.Errorf("from-page: %w", err)
+	}
+	urls := sel.extract(doc, base)
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("from-page: selector %q matched no image URLs on %s", selector, pageURL)
+	}
+	fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[list] %d page URL(s) on %s\n", len(urls), pageURL)
+	return &urlSource{name: "-from-page", lines: urls, done: true}, nil
+}
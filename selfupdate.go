@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// self-update fetches the latest release for this platform, checks it
+// against the release's SHA256SUMS, and that file against its ed25519
+// signature when a release key is known, then swaps the binary in place.
+
+const defaultReleaseURL = "https://api.github.com/repos/fafuu/qxdl-gentle/releases/latest"
+
+// releaseKey is the base64 ed25519 public key release SHA256SUMS files are
+// signed with, set with -ldflags "-X main.releaseKey=...". Without it (or
+// -pubkey) nothing is installed unless -insecure-skip-signature says so.
+var releaseKey = ""
+
+// release is the part of a GitHub release the update needs.
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r release) asset(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// assetName is the release file for this platform, e.g.
+// qxdl-gentle_linux_arm64 or qxdl-gentle_windows_amd64.exe.
+func assetName() string {
+	name := "qxdl-gentle_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func cmdSelfUpdate(args []string) int {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	endpoint := fs.String("endpoint", defaultReleaseURL, "Release API URL (GitHub's \"latest release\" JSON)")
+	key := fs.String("pubkey", releaseKey, "Base64 ed25519 key the release's SHA256SUMS.sig must verify with")
+	check := fs.Bool("check", false, "Only say whether a newer release exists")
+	force := fs.Bool("force", false, "Install even when the release is not newer, or this build has no release version")
+	insecure := fs.Bool("insecure-skip-signature", false, "Install without a release key, trusting a checksum from the same server as the binary")
+	fs.Parse(args)
+
+	client, err := newHTTPClient(nil, 5*time.Minute)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return exitError
+	}
+	var rel release
+	b, err := fetchRelease(client, *endpoint, 1<<20)
+	if err == nil {
+		err = json.Unmarshal(b, &rel)
+	}
+	if err != nil {
+		fmt.Println("[ERROR] release:", err)
+		return exitError
+	}
+	cur := readBuildInfo().Version
+	newer, comparable := newerVersion(rel.Tag, cur)
+	switch {
+	case *check:
+		if newer {
+			fmt.Printf("%s is available (this is %s)\n", rel.Tag, cur)
+		} else {
+			fmt.Printf("%s is the latest release (this is %s)\n", rel.Tag, cur)
+		}
+		return exitOK
+	case !comparable && !*force:
+		fmt.Printf("[ERROR] this build (%s) has no release version to compare with %s; pass -force to install it anyway\n", cur, rel.Tag)
+		return exitError
+	case !newer && !*force:
+		fmt.Printf("already up to date (%s)\n", cur)
+		return exitOK
+	}
+
+	if err := installRelease(client, rel, *key, *insecure); err != nil {
+		fmt.Println("[ERROR] self-update:", err)
+		return exitError
+	}
+	fmt.Printf("updated %s -> %s\n", cur, rel.Tag)
+	return exitOK
+}
+
+// installRelease downloads this platform's binary next to the running one,
+// checks it and renames it over the old one. Without a key it refuses unless
+// skipSig is set.
+func installRelease(client *http.Client, rel release, key string, skipSig bool) error {
+	if key == "" && !skipSig {
+		return errors.New("no release key in this build or -pubkey, so the release cannot be authenticated; pass -insecure-skip-signature to install on its checksum alone")
+	}
+	name := assetName()
+	binURL, sumsURL := rel.asset(name), rel.asset("SHA256SUMS")
+	if binURL == "" || sumsURL == "" {
+		return fmt.Errorf("release %s has no %s or no SHA256SUMS", rel.Tag, name)
+	}
+	sums, err := fetchRelease(client, sumsURL, 1<<20)
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		sigURL := rel.asset("SHA256SUMS.sig")
+		if sigURL == "" {
+			return errors.New("release has no SHA256SUMS.sig to check")
+		}
+		sig, err := fetchRelease(client, sigURL, 4096)
+		if err != nil {
+			return err
+		}
+		if err := verifySignature(sums, sig, key); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println("[WARN] -insecure-skip-signature: checking the checksum only, which comes from the same server as the binary")
+	}
+	want := ""
+	for _, line := range strings.Split(string(sums), "\n") {
+		if sum, file, ok := strings.Cut(strings.TrimSpace(line), "  "); ok && strings.TrimPrefix(file, "*") == name {
+			want = sum
+		}
+	}
+	if want == "" {
+		return fmt.Errorf("SHA256SUMS does not list %s", name)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	// in the same folder, so the rename below cannot cross filesystems
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".qxdl-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	got, err := downloadRelease(client, binURL, tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%s: sha256 %s, SHA256SUMS says %s", name, got, want)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// a running .exe cannot be replaced, only renamed out of the way
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), exe); err != nil {
+			os.Rename(old, exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+func verifySignature(msg, sig []byte, key string) error {
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("release key is not a base64 ed25519 public key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil {
+		raw = sig // a raw 64-byte signature
+	}
+	if !ed25519.Verify(pub, msg, raw) {
+		return errors.New("SHA256SUMS.sig does not verify with the release key")
+	}
+	return nil
+}
+
+func releaseRequest(u string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", defaultUA)
+	return req, nil
+}
+
+// fetchRelease reads a small release file, at most limit bytes.
+func fetchRelease(client *http.Client, u string, limit int64) ([]byte, error) {
+	req, err := releaseRequest(u)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// downloadRelease writes the binary to w and returns its SHA-256.
+func downloadRelease(client *http.Client, u string, w io.Writer) (string, error) {
+	req, err := releaseRequest(u)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), resp.Body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newerVersion reports whether tag is a later vMAJOR.MINOR.PATCH than cur,
+// and whether cur is such a version at all.
+func newerVersion(tag, cur string) (newer, comparable bool) {
+	t, ok1 := parseSemver(tag)
+	c, ok2 := parseSemver(cur)
+	if !ok1 || !ok2 {
+		return false, false
+	}
+	for i := range t {
+		if t[i] != c[i] {
+			return t[i] > c[i], true
+		}
+	}
+	return false, true
+}
+
+// parseSemver reads v1.2.3; pre-releases and pseudo-versions do not count.
+func parseSemver(v string) ([3]int, bool) {
+	var out [3]int
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(parts) != 3 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInstallReleaseNeedsAKey(t *testing.T) {
+	// the release has no assets, so getting past the key check fails differently
+	err := installRelease(&http.Client{Transport: &fakeServer{}}, release{Tag: "v9.9.9"}, "", false)
+	if err == nil || !strings.Contains(err.Error(), "-insecure-skip-signature") {
+		t.Errorf("without a key: %v", err)
+	}
+}
+
+func TestInstallReleaseSkipSignatureGoesOn(t *testing.T) {
+	err := installRelease(&http.Client{Transport: &fakeServer{}}, release{Tag: "v9.9.9"}, "", true)
+	if err == nil || !strings.Contains(err.Error(), "no SHA256SUMS") {
+		t.Errorf("with -insecure-skip-signature: %v", err)
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// qxdl serve keeps one session alive and runs submitted jobs one at a time,
+// so everything sent to it shares the same politeness budget. The API is
+// plain JSON over HTTP and only meant for localhost; grpc.go serves the same
+// queue over gRPC.
+//
+//	POST   /jobs             submit a job (same fields as a -jobs entry)
+//	GET    /jobs             list jobs with their progress
+//	GET    /jobs/{id}        one job
+//	POST   /jobs/{id}/pause  pause before the next page
+//	POST   /jobs/{id}/resume
+//	POST   /jobs/{id}/cancel stop before the next page (or drop it if queued)
+//	GET    /jobs/{id}/events the job again on every change, one JSON object per
+//	                         line, until it is finished
+
+// Job states reported by the API.
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobPaused   = "paused"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// jobProgress counts page outcomes of a running job.
+type jobProgress struct {
+	Current int   `json:"current"` // page being fetched
+	OK      int   `json:"ok"`
+	Skipped int   `json:"skipped"`
+	Missing int   `json:"missing"`
+	Failed  int   `json:"failed"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// jobControl is shared between a running job and the API handlers.
+type jobControl struct {
+	mu       sync.Mutex
+	resumed  *sync.Cond
+	paused   bool
+	canceled bool
+	skip     bool // -tui: stop the current job only, once
+	progress jobProgress
+	stop     context.CancelFunc // ends the running job's waits and requests
+	changed  func()             // told after every change; serve's notify
+}
+
+func newJobControl() *jobControl {
+	c := &jobControl{}
+	c.resumed = sync.NewCond(&c.mu)
+	return c
+}
+
+// checkpoint is called before each page. It blocks while the job is paused
+// and reports whether it was canceled.
+func (c *jobControl) checkpoint(num int) bool {
+	defer c.notify()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.paused && !c.canceled {
+		c.resumed.Wait()
+	}
+	c.progress.Current = num
+	if c.skip {
+		c.skip = false
+		return true
+	}
+	return c.canceled
+}
+
+func (c *jobControl) record(p pageState, size int64) {
+	defer c.notify()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch p.Status {
+	case pageOK:
+		c.progress.OK++
+		c.progress.Bytes += size
+	case pageSkipped:
+		c.progress.Skipped++
+	case pageMissing:
+		c.progress.Missing++
+	case pageFailed:
+		c.progress.Failed++
+	}
+}
+
+// wait blocks while the job is paused and reports whether it was canceled.
+func (c *jobControl) wait() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.paused && !c.canceled {
+		c.resumed.Wait()
+	}
+	return c.canceled
+}
+
+func (c *jobControl) setPaused(v bool) {
+	c.mu.Lock()
+	c.paused = v
+	c.mu.Unlock()
+	c.resumed.Broadcast()
+	c.notify()
+}
+
+func (c *jobControl) cancel() {
+	c.mu.Lock()
+	c.canceled = true
+	if c.stop != nil {
+		c.stop()
+	}
+	c.mu.Unlock()
+	c.resumed.Broadcast()
+	c.notify()
+}
+
+func (c *jobControl) notify() {
+	if c.changed != nil {
+		c.changed()
+	}
+}
+
+// bind lets cancel end the job's context, at once if it came first.
+func (c *jobControl) bind(stop context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop = stop
+	if c.canceled {
+		stop()
+	}
+}
+
+type serveJob struct {
+	ID       int         `json:"id"`
+	Job      job         `json:"job"`
+	Status   string      `json:"status"`
+	Added    time.Time   `json:"added"`
+	Started  time.Time   `json:"started"`
+	Finished time.Time   `json:"finished"`
+	Err      string      `json:"error,omitempty"`
+	Progress jobProgress `json:"progress"`
+
+	ctl     *jobControl
+	requeue bool // canceled by a restart, to be run again
+}
+
+type server struct {
+	s    *session
+	mu   sync.Mutex
+	jobs []*serveJob
+	wake chan struct{}
+
+	gen     int       // worker loop generation; restart bumps it
+	running *serveJob // the job the worker loop is on
+
+	// run runs one job; the session's runJob, replaced in tests
+	run func(j job, ctl *jobControl) (jobResult, error)
+
+	chMu    sync.Mutex
+	changed chan struct{} // closed at the next change to a job; nil if no one waits
+}
+
+func newServer(s *session) *server {
+	srv := &server{s: s, wake: make(chan struct{}, 1)}
+	srv.run = func(j job, ctl *jobControl) (jobResult, error) {
+		srv.s.ctl = ctl
+		defer func() { srv.s.ctl = nil }()
+		return srv.s.runJob(j)
+	}
+	return srv
+}
+
+// serve runs the API on addr, and the gRPC service on grpcAddr unless it is
+// empty, until the process is stopped.
+func (srv *server) serve(addr, grpcAddr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[serve] API on http://%s/jobs\n", ln.Addr())
+	if grpcAddr != "" {
+		gln, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		fmt.Printf("[serve] gRPC on %s\n", gln.Addr())
+		go func() {
+			if err := newGRPCServer(srv).Serve(gln); err != nil {
+				fmt.Println("[ERROR] gRPC:", err)
+			}
+		}()
+	}
+	go srv.work(0)
+	return http.Serve(ln, srv.handler())
+}
+
+func (srv *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", srv.submit)
+	mux.HandleFunc("GET /jobs", srv.list)
+	mux.HandleFunc("GET /jobs/{id}", srv.get)
+	mux.HandleFunc("GET /jobs/{id}/events", srv.events)
+	mux.HandleFunc("POST /jobs/{id}/{action}", srv.control)
+	return mux
+}
+
+// work runs queued jobs in submission order, one at a time. A loop whose
+// generation is outdated hands over to a new one and returns.
+func (srv *server) work(gen int) {
+	for {
+		sj, current := srv.next(gen)
+		if !current {
+			if srv.s != nil {
+				srv.s.client.CloseIdleConnections()
+			}
+			go srv.work(gen + 1)
+			return
+		}
+		if sj == nil {
+			<-srv.wake
+			continue
+		}
+		res, err := srv.run(sj.Job, sj.ctl)
+
+		srv.mu.Lock()
+		srv.running = nil
+		if sj.requeue {
+			// from the start, minus the pages it already saved
+			sj.Status, sj.Started, sj.requeue, sj.ctl = jobQueued, time.Time{}, false, srv.newControl()
+			srv.mu.Unlock()
+			srv.notify()
+			continue
+		}
+		sj.Finished = time.Now()
+		switch {
+		case err != nil:
+			sj.Status, sj.Err = jobFailed, err.Error()
+		case res.Canceled:
+			sj.Status = jobCanceled
+		case res.Stopped:
+			sj.Status, sj.Err = jobCanceled, "run budget used up"
+		case res.Aborted:
+			sj.Status, sj.Err = jobFailed, "stopped after too many consecutive errors"
+		default:
+			sj.Status = jobDone
+		}
+		srv.mu.Unlock()
+		srv.notify()
+	}
+}
+
+// next takes the first queued job, unless the loop of generation gen has
+// been restarted.
+func (srv *server) next(gen int) (*serveJob, bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if gen != srv.gen {
+		return nil, false
+	}
+	for _, sj := range srv.jobs {
+		if sj.Status == jobQueued {
+			sj.Status, sj.Started = jobRunning, time.Now()
+			srv.running = sj
+			srv.notify()
+			return sj, true
+		}
+	}
+	return nil, true
+}
+
+// restart is the watchdog's onTrip with -watchdog-restart: the running job
+// is stopped and queued again, and the worker loop starts over with fresh
+// connections once that job has let go.
+func (srv *server) restart(reason string) {
+	srv.mu.Lock()
+	srv.gen++
+	if sj := srv.running; sj != nil {
+		sj.requeue = true
+		sj.ctl.cancel()
+	}
+	srv.mu.Unlock()
+	fmt.Printf("[serve] restarting the worker loop: %s\n", reason)
+	select {
+	case srv.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (srv *server) submit(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(w, r) {
+		return
+	}
+	// a form or text/plain POST is what a web page can send without asking
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		httpError(w, http.StatusUnsupportedMediaType, errors.New("Content-Type must be application/json"))
+		return
+	}
+	var j job
+	if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	snap, err := srv.add(j)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, snap)
+}
+
+// add checks j against the session's options and queues it.
+func (srv *server) add(j job) (serveJob, error) {
+	if err := apiSafe(j); err != nil {
+		return serveJob{}, err
+	}
+	o, err := j.apply(srv.s.o)
+	if err == nil {
+		err = j.validate(o)
+	}
+	if err != nil {
+		return serveJob{}, err
+	}
+
+	srv.mu.Lock()
+	sj := &serveJob{ID: len(srv.jobs) + 1, Job: j, Status: jobQueued, Added: time.Now(), ctl: srv.newControl()}
+	srv.jobs = append(srv.jobs, sj)
+	snap := srv.snapshot(sj)
+	srv.mu.Unlock()
+	srv.notify()
+	select {
+	case srv.wake <- struct{}{}:
+	default:
+	}
+	fmt.Fprintf(logAt(srv.s.o.verbosity, lvlNormal), "[serve] job %d queued: %s\n", sj.ID, j.URL)
+	return snap, nil
+}
+
+func (srv *server) list(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, srv.all())
+}
+
+func (srv *server) all() []serveJob {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	out := make([]serveJob, 0, len(srv.jobs))
+	for _, sj := range srv.jobs {
+		out = append(out, srv.snapshot(sj))
+	}
+	return out
+}
+
+func (srv *server) get(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	sj := srv.lookup(w, r)
+	if sj != nil {
+		writeJSON(w, http.StatusOK, srv.snapshot(sj))
+	}
+}
+
+func (srv *server) control(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(w, r) {
+		return
+	}
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	snap, err := srv.act(id, r.PathValue("action"))
+	if err != nil {
+		httpError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, snap)
+}
+
+var errNoJob = errors.New("no such job")
+
+// apiSafe refuses what a job that came over the API may not do. The API has
+// no authentication, so a job from it gets no more than a download into the
+// folder serve runs in: no -url-cmd, which runs a shell command, and no
+// folder or file name that leads out of it, nor a remote -out.
+func apiSafe(j job) error {
+	if j.URLCmd != "" {
+		return errors.New("url_cmd is only accepted from the command line or a jobs file")
+	}
+	for _, p := range []struct{ field, v string }{
+		{"out", j.Out}, {"chap_folder", j.ChapFolder}, {"name_template", deref(j.NameTemplate)},
+	} {
+		if p.v != "" && (strings.Contains(p.v, "://") || !filepath.IsLocal(filepath.FromSlash(p.v))) {
+			return fmt.Errorf("%s %q leads out of the folder serve runs in", p.field, p.v)
+		}
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// sameOrigin answers 403 to a request a web page on another site sent; a
+// browser names that page in Origin. Programs send none.
+func sameOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return true
+	}
+	httpError(w, http.StatusForbidden, fmt.Errorf("requests from %s are not accepted", origin))
+	return false
+}
+
+// act pauses, resumes or cancels job id.
+func (srv *server) act(id int, action string) (serveJob, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	sj := srv.byID(id)
+	if sj == nil {
+		return serveJob{}, errNoJob
+	}
+	switch action {
+	case "pause":
+		if !finished(sj.Status) {
+			sj.ctl.setPaused(true)
+		}
+	case "resume":
+		sj.ctl.setPaused(false)
+	case "cancel":
+		if sj.Status == jobQueued {
+			sj.Status, sj.Finished = jobCanceled, time.Now()
+		}
+		sj.requeue = false
+		sj.ctl.cancel()
+	default:
+		return serveJob{}, fmt.Errorf("unknown action %q", action)
+	}
+	return srv.snapshot(sj), nil
+}
+
+// events streams the job as newline-delimited JSON: once at once, then each
+// time its status or progress changes, ending after it is finished or when
+// the client goes away.
+func (srv *server) events(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	sj := srv.lookup(w, r)
+	srv.mu.Unlock()
+	if sj == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	srv.follow(r.Context(), sj, func(snap serveJob) error {
+		if err := enc.Encode(snap); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+}
+
+// follow calls send with the job as it stands and again after each change of
+// its status or progress, until it is finished, send fails or ctx ends.
+func (srv *server) follow(ctx context.Context, sj *serveJob, send func(serveJob) error) error {
+	var last serveJob
+	for first := true; ; first = false {
+		changed := srv.changes() // before the snapshot, so no change slips between
+		srv.mu.Lock()
+		snap := srv.snapshot(sj)
+		srv.mu.Unlock()
+		if first || snap.Status != last.Status || snap.Progress != last.Progress {
+			if err := send(snap); err != nil {
+				return err
+			}
+			last = snap
+		}
+		if finished(snap.Status) {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// changes returns a channel that is closed at the next change to any job.
+func (srv *server) changes() <-chan struct{} {
+	srv.chMu.Lock()
+	defer srv.chMu.Unlock()
+	if srv.changed == nil {
+		srv.changed = make(chan struct{})
+	}
+	return srv.changed
+}
+
+// notify wakes everyone following a job.
+func (srv *server) notify() {
+	srv.chMu.Lock()
+	defer srv.chMu.Unlock()
+	if srv.changed != nil {
+		close(srv.changed)
+		srv.changed = nil
+	}
+}
+
+func (srv *server) newControl() *jobControl {
+	c := newJobControl()
+	c.changed = srv.notify
+	return c
+}
+
+func finished(status string) bool {
+	return status == jobDone || status == jobFailed || status == jobCanceled
+}
+
+// lookup finds the job named in the path; the caller holds srv.mu.
+func (srv *server) lookup(w http.ResponseWriter, r *http.Request) *serveJob {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	sj := srv.byID(id)
+	if sj == nil {
+		httpError(w, http.StatusNotFound, errNoJob)
+	}
+	return sj
+}
+
+// byID returns job id, or nil; the caller holds srv.mu.
+func (srv *server) byID(id int) *serveJob {
+	if id < 1 || id > len(srv.jobs) {
+		return nil
+	}
+	return srv.jobs[id-1]
+}
+
+// snapshot copies sj with its live progress; the caller holds srv.mu.
+func (srv *server) snapshot(sj *serveJob) serveJob {
+	c := *sj
+	sj.ctl.mu.Lock()
+	c.Progress = sj.ctl.progress
+	if c.Status == jobRunning && sj.ctl.paused {
+		c.Status = jobPaused
+	}
+	sj.ctl.mu.Unlock()
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
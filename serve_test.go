@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventsFollowTheJobUntilItIsFinished(t *testing.T) {
+	srv := &server{}
+	sj := &serveJob{ID: 1, Status: jobRunning, ctl: srv.newControl()}
+	srv.jobs = []*serveJob{sj}
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/jobs/1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	next := func() serveJob {
+		t.Helper()
+		if !sc.Scan() {
+			t.Fatalf("stream ended early: %v", sc.Err())
+		}
+		var e serveJob
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		return e
+	}
+
+	// each change is made only after the event before it arrived, so none
+	// of them can be folded into another
+	if e := next(); e.Status != jobRunning || e.Progress.OK != 0 {
+		t.Fatalf("first event = %+v", e)
+	}
+	for i := 1; i <= 3; i++ {
+		sj.ctl.record(pageState{Status: pageOK}, 10)
+		if e := next(); e.Progress.OK != i || e.Progress.Bytes != int64(10*i) {
+			t.Fatalf("event after page %d = %+v", i, e.Progress)
+		}
+	}
+	srv.mu.Lock()
+	sj.Status = jobDone
+	srv.mu.Unlock()
+	srv.notify()
+	if e := next(); e.Status != jobDone || e.Progress.OK != 3 {
+		t.Errorf("last event = %+v", e)
+	}
+	if sc.Scan() {
+		t.Errorf("event after the job finished: %s", sc.Text())
+	}
+}
+
+func TestEventsOfAnUnknownJob(t *testing.T) {
+	srv := &server{}
+	r := httptest.NewRequest("GET", "/jobs/7/events", nil)
+	r.SetPathValue("id", "7")
+	w := httptest.NewRecorder()
+	srv.events(w, r)
+	if w.Code != 404 {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestRestartQueuesTheRunningJobAgain(t *testing.T) {
+	srv := &server{wake: make(chan struct{}, 1)}
+	runs := make(chan int, 2)
+	srv.run = func(j job, ctl *jobControl) (jobResult, error) {
+		runs <- 1
+		if len(runs) == 1 {
+			// the first run hangs until something stops it
+			ctl.setPaused(true)
+			return jobResult{Canceled: ctl.wait()}, nil
+		}
+		return jobResult{}, nil
+	}
+	sj := &serveJob{ID: 1, Status: jobQueued, ctl: newJobControl()}
+	srv.jobs = []*serveJob{sj}
+	go srv.work(0)
+
+	for {
+		srv.mu.Lock()
+		running := srv.running != nil
+		srv.mu.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	srv.restart("test")
+	for {
+		srv.mu.Lock()
+		status := sj.Status
+		srv.mu.Unlock()
+		if status == jobDone || status == jobCanceled || status == jobFailed {
+			if status != jobDone {
+				t.Fatalf("status = %s, want %s after the restart ran it again", status, jobDone)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(runs) != 2 {
+		t.Errorf("ran %d times, want 2", len(runs))
+	}
+	srv.mu.Lock()
+	if srv.gen != 1 {
+		t.Errorf("generation = %d, want 1", srv.gen)
+	}
+	srv.mu.Unlock()
+}
+
+func TestSubmitRefusesWhatAWebPageCouldAbuse(t *testing.T) {
+	s, _ := testSession(t, testOptions(t), &fakeServer{})
+	srv := newServer(s)
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	post := func(body, ctype, origin string) int {
+		t.Helper()
+		req, _ := http.NewRequest("POST", ts.URL+"/jobs", strings.NewReader(body))
+		if ctype != "" {
+			req.Header.Set("Content-Type", ctype)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	ok := `{"url":"http://pages.example/b/001.png","start":"001","end":"002","out":"b"}`
+	for _, tc := range []struct {
+		name, body, ctype, origin string
+		want                      int
+	}{
+		{"text/plain", ok, "text/plain", "", http.StatusUnsupportedMediaType},
+		{"no content type", ok, "", "", http.StatusUnsupportedMediaType},
+		{"foreign origin", ok, "application/json", "https://evil.example", http.StatusForbidden},
+		{"url_cmd", `{"url":"http://pages.example/b/","start":"001","url_cmd":"touch /tmp/pwned"}`, "application/json", "", http.StatusBadRequest},
+		{"absolute out", `{"url":"http://pages.example/b/001.png","start":"001","out":"/etc"}`, "application/json", "", http.StatusBadRequest},
+		{"out with ..", `{"url":"http://pages.example/b/001.png","start":"001","out":"../up"}`, "application/json", "", http.StatusBadRequest},
+		{"remote out", `{"url":"http://pages.example/b/001.png","start":"001","out":"s3://bucket/x"}`, "application/json", "", http.StatusBadRequest},
+		{"name_template with ..", `{"url":"http://pages.example/b/001.png","start":"001","name_template":"../{num}.png"}`, "application/json", "", http.StatusBadRequest},
+		{"fine", ok, "application/json; charset=utf-8", "", http.StatusCreated},
+		{"same origin", ok, "application/json", ts.URL, http.StatusCreated},
+	} {
+		if got := post(tc.body, tc.ctype, tc.origin); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+	if n := len(srv.all()); n != 2 {
+		t.Errorf("%d jobs queued, want 2", n)
+	}
+}
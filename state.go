@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page outcomes recorded in the run state.
+const (
+	pageOK      = "ok"
+	pageSkipped = "skipped" // already on disk
+	pageMissing = "missing" // 404
+	pageFailed  = "failed"
+)
+
+// runMeta identifies what a run was asked to fetch.
+type runMeta struct {
+	URL    string `json:"url"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Step   int    `json:"step,omitempty"`
+	Shard  int    `json:"shard,omitempty"`
+	Shards int    `json:"shards,omitempty"`
+}
+
+// runState is what one run (or one shard of it) did, saved in the folder so
+// shards from several machines can be merged afterwards. It is a snapshot
+// compacted from the run's event log (see events.go).
+type runState struct {
+	ID string `json:"run,omitempty"`
+	runMeta
+	Started  time.Time   `json:"started"`
+	Finished time.Time   `json:"finished"`
+	Pages    []pageState `json:"pages"`
+
+	folder   string
+	log      *eventLog
+	manifest *manifest                                   // the folder's qxdl-manifest.json
+	onRecord func(ps pageState, file string, size int64) // progress reporting for serve and -tui, hooks
+}
+
+type pageState struct {
+	Num    int    `json:"num"`
+	URL    string `json:"url"`
+	File   string `json:"file,omitempty"`
+	Status string `json:"status"`
+	Code   int    `json:"code,omitempty"`
+	Err    string `json:"error,omitempty"`
+}
+
+// parseShard parses "K/N" (1-based K).
+func parseShard(v string) (k, n int, err error) {
+	if v == "" {
+		return 0, 0, nil
+	}
+	ks, ns, ok := strings.Cut(v, "/")
+	if ok {
+		k, err = strconv.Atoi(ks)
+		if err == nil {
+			n, err = strconv.Atoi(ns)
+		}
+	}
+	if !ok || err != nil || n < 1 || k < 1 || k > n {
+		return 0, 0, fmt.Errorf("shard must look like 2/5 (got %q)", v)
+	}
+	return k, n, nil
+}
+
+// inShard reports whether the i-th page of the range (0-based) belongs to
+// shard k of n. Pages are dealt round-robin so every shard sees the whole
+// range spread out, not one contiguous block.
+func inShard(i, k, n int) bool {
+	return n <= 1 || i%n == k-1
+}
+
+func stateFileName(k, n int) string {
+	if n > 1 {
+		return fmt.Sprintf(".qxdl-state.%dof%d.json", k, n)
+	}
+	return ".qxdl-state.json"
+}
+
+// begin starts the run's event log in folder.
+func (st *runState) begin(folder string) error {
+	st.ID, st.folder, st.Started = newRunID(), folder, time.Now()
+	log, err := openEventLog(folder, st.Shard, st.Shards)
+	if err != nil {
+		return err
+	}
+	st.log = log
+	if st.manifest, err = loadManifest(folder); err != nil {
+		fmt.Println("[WARN] manifest:", err) // the run goes on; only provenance is lost
+	}
+	meta := st.runMeta
+	return st.log.append(event{Time: st.Started, Run: st.ID, Type: evRunStart, Meta: &meta})
+}
+
+func (st *runState) record(num int, url, file, status string, res dlResult) {
+	ps := pageState{Num: num, URL: url, Status: status, Code: res.StatusCode}
+	if status == pageOK || status == pageSkipped {
+		ps.File = filepath.Base(file)
+	}
+	if res.Err != nil {
+		ps.Err = res.Err.Error()
+	}
+	st.Pages = append(st.Pages, ps)
+	if st.manifest != nil {
+		st.manifest.add(st.ID, ps, file, res)
+	}
+	if st.onRecord != nil {
+		st.onRecord(ps, file, res.Size)
+	}
+	if st.log == nil {
+		return
+	}
+	if err := st.log.append(event{Time: time.Now(), Run: st.ID, Type: evPage, Page: &ps}); err != nil {
+		fmt.Println("[WARN] event log:", err)
+	}
+	if len(st.Pages)%compactEvery == 0 {
+		if err := st.save(st.folder); err != nil {
+			fmt.Println("[WARN] save state:", err)
+		}
+	}
+}
+
+// finish closes the event log, writes the final snapshot and drops events of
+// all but the newest keepRuns runs.
+func (st *runState) finish(keepRuns int) error {
+	st.Finished = time.Now()
+	if st.log != nil {
+		meta := st.runMeta
+		st.log.append(event{Time: st.Finished, Run: st.ID, Type: evRunEnd, Meta: &meta})
+		st.log.Close()
+		if keepRuns > 0 {
+			if err := trimEventLog(st.log.name, keepRuns); err != nil {
+				return err
+			}
+		}
+	}
+	return st.save(st.folder)
+}
+
+func (st *runState) save(folder string) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if st.manifest != nil {
+		if err := st.manifest.save(); err != nil {
+			return err
+		}
+	}
+	name := filepath.Join(folder, stateFileName(st.Shard, st.Shards))
+	if err := os.WriteFile(name+".part", b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(name+".part", name)
+}
+
+func loadState(name string) (*runState, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var st runState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &st, nil
+}
+
+// stateFiles expands folders into the state files they hold; plain files are
+// passed through.
+func stateFiles(args []string) ([]string, error) {
+	var files []string
+	for _, a := range args {
+		fi, err := os.Stat(a)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, a)
+			continue
+		}
+		m, _ := filepath.Glob(filepath.Join(a, ".qxdl-state*.json"))
+		files = append(files, m...)
+	}
+	return files, nil
+}
+
+// mergedReport combines the states of several shards of one range.
+type mergedReport struct {
+	Start     int   `json:"start"`
+	End       int   `json:"end"`
+	Files     int   `json:"state_files"`
+	OK        []int `json:"ok"`
+	Missing   []int `json:"missing"`
+	Failed    []int `json:"failed"`
+	Uncovered []int `json:"uncovered"`
+}
+
+func mergeStates(states []*runState) mergedReport {
+	rep := mergedReport{Files: len(states), OK: []int{}, Missing: []int{}, Failed: []int{}, Uncovered: []int{}}
+	best := map[int]string{}
+	step := 1
+	for i, st := range states {
+		step = max(step, st.Step)
+		if i == 0 || st.Start < rep.Start {
+			rep.Start = st.Start
+		}
+		if i == 0 || st.End > rep.End {
+			rep.End = st.End
+		}
+		for _, p := range st.Pages {
+			// a success anywhere wins over a failure elsewhere
+			if cur, ok := best[p.Num]; !ok || statusRank(p.Status) > statusRank(cur) {
+				best[p.Num] = p.Status
+			}
+		}
+	}
+	for n := rep.Start; n <= rep.End && len(states) > 0; n += step {
+		switch best[n] {
+		case pageOK, pageSkipped:
+			rep.OK = append(rep.OK, n)
+		case pageMissing:
+			rep.Missing = append(rep.Missing, n)
+		case pageFailed:
+			rep.Failed = append(rep.Failed, n)
+		default:
+			rep.Uncovered = append(rep.Uncovered, n)
+		}
+	}
+	return rep
+}
+
+func statusRank(s string) int {
+	switch s {
+	case pageOK, pageSkipped:
+		return 3
+	case pageMissing:
+		return 2
+	case pageFailed:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runStats adds up where a run's time went, for tuning -interval and
+// -jitter: how fast the host answers, and how much of the run was spent
+// waiting on purpose.
+type runStats struct {
+	mu       sync.Mutex
+	took     []time.Duration // per GET, headers to last byte
+	bytes    int64           // stored, after decompression
+	wire     int64           // as received
+	transfer time.Duration
+	sleeping time.Duration // polite waits, backoff included
+	pacing   time.Duration // extra waits to keep per-host gaps
+	retries  map[string]int
+}
+
+func newRunStats() *runStats {
+	return &runStats{retries: map[string]int{}}
+}
+
+func (st *runStats) get(took time.Duration, bytes, wire int64, paced time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.took = append(st.took, took)
+	st.bytes += bytes
+	st.wire += wire
+	st.transfer += took
+	st.pacing += paced
+}
+
+func (st *runStats) slept(d time.Duration) {
+	st.mu.Lock()
+	st.sleeping += d
+	st.mu.Unlock()
+}
+
+// retry counts a retry under the outcome that caused it.
+func (st *runStats) retry(prev dlResult) {
+	key := strconv.Itoa(prev.StatusCode)
+	if prev.Err != nil {
+		key = "error"
+	} else if t := http.StatusText(prev.StatusCode); t != "" {
+		key += " " + t
+	}
+	st.mu.Lock()
+	st.retries[key]++
+	st.mu.Unlock()
+}
+
+// total is the body bytes fetched so far, as stored.
+func (st *runStats) total() int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.bytes
+}
+
+// received is the bytes that came over the wire, compressed or not.
+func (st *runStats) received() int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.wire
+}
+
+// lines renders the end-of-run table; nil if nothing was fetched.
+func (st *runStats) lines() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.took) == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration(nil), st.took...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	pct := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100].Round(time.Millisecond)
+	}
+	rate := float64(st.wire) / max(st.transfer.Seconds(), 0.001)
+	stored := ""
+	if st.wire != st.bytes {
+		stored = fmt.Sprintf(" (%s stored)", humanBytes(st.bytes))
+	}
+	out := []string{
+		fmt.Sprintf("  transferred  %s%s in %d GET(s), %s/s while transferring",
+			humanBytes(st.wire), stored, len(sorted), humanBytes(int64(rate))),
+		fmt.Sprintf("  response     avg %v  p50 %v  p90 %v  p99 %v  max %v",
+			(st.transfer / time.Duration(len(sorted))).Round(time.Millisecond), pct(50), pct(90), pct(99), pct(100)),
+		fmt.Sprintf("  time         %v transferring, %v sleeping, %v pacing",
+			st.transfer.Round(time.Millisecond), st.sleeping.Round(time.Millisecond), st.pacing.Round(time.Millisecond)),
+	}
+	if len(st.retries) > 0 {
+		keys := make([]string, 0, len(st.retries))
+		for k := range st.retries {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = fmt.Sprintf("%s: %d", k, st.retries[k])
+		}
+		out = append(out, "  retries      "+strings.Join(parts, ", "))
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// -on-status overrides what a response status does to a page. Each entry is
+// CODE=ACTION with CODE an exact status (404) or a class (5xx):
+//
+//	retry[:N]   retry N times (default -retries) after the plain interval
+//	backoff[:N] retry like an error, waiting longer after each (the default for 4xx/5xx but 404)
+//	skip        record the page as missing and go on (the default for 404)
+//	abort       stop the job at once
+
+const (
+	statusRetry   = "retry"
+	statusBackoff = "backoff"
+	statusSkip    = "skip"
+	statusAbort   = "abort"
+)
+
+type statusRule struct {
+	action  string
+	retries int // -1 = -retries
+}
+
+// statusPolicy maps "404" or "4xx" to a rule.
+type statusPolicy map[string]statusRule
+
+func parseStatusPolicy(v string) (statusPolicy, error) {
+	p := statusPolicy{}
+	if v == "" {
+		return p, nil
+	}
+	for _, item := range strings.Split(v, ",") {
+		code, act, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("on-status: %q is not CODE=ACTION", item)
+		}
+		if n, err := strconv.Atoi(code); err == nil {
+			if n < 300 || n > 599 {
+				return nil, fmt.Errorf("on-status: %d is not an error status", n)
+			}
+		} else if len(code) != 3 || (code[0] != '3' && code[0] != '4' && code[0] != '5') || strings.ToLower(code[1:]) != "xx" {
+			return nil, fmt.Errorf("on-status: %q is not a status code or class like 5xx", code)
+		}
+		r := statusRule{retries: -1}
+		name, n, hasN := strings.Cut(act, ":")
+		switch name {
+		case statusRetry, statusBackoff:
+			if hasN {
+				c, err := strconv.Atoi(n)
+				if err != nil || c < 0 {
+					return nil, fmt.Errorf("on-status: bad retry count in %q", act)
+				}
+				r.retries = c
+			}
+		case statusSkip, statusAbort:
+			if hasN {
+				return nil, fmt.Errorf("on-status: %s takes no count", name)
+			}
+		default:
+			return nil, fmt.Errorf("on-status: unknown action %q (want retry, backoff, skip or abort)", name)
+		}
+		r.action = name
+		p[strings.ToLower(code)] = r
+	}
+	return p, nil
+}
+
+// rule says what to do with res: its -on-status entry, exact code before
+// class, or else the built-in handling. "" means a page that arrived.
+func (p statusPolicy) rule(res dlResult, retries int) statusRule {
+	r, ok := statusRule{}, false
+	if res.Err == nil {
+		code := strconv.Itoa(res.StatusCode)
+		if r, ok = p[code]; !ok {
+			r, ok = p[code[:1]+"xx"]
+		}
+	}
+	switch {
+	case ok:
+	case res.Err != nil:
+		r = statusRule{action: statusBackoff, retries: -1}
+	case res.StatusCode == http.StatusOK:
+		return statusRule{}
+	case res.StatusCode >= 400 && res.StatusCode != http.StatusNotFound:
+		r = statusRule{action: statusBackoff, retries: -1}
+	default:
+		r = statusRule{action: statusSkip}
+	}
+	if r.retries < 0 {
+		r.retries = retries
+	}
+	return r
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// -strip-metadata drops what a page carries about its making rather than
+// the picture itself, before the page gets its final name: in a JPEG the
+// EXIF and XMP (APP1), IPTC (APP13) and comment segments, in a PNG the
+// eXIf, text and tIME chunks. Color profiles stay, so colors do not shift.
+// Other formats are left as they are.
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+var errBadImage = errors.New("malformed image")
+
+// stripFile strips file in place and reports how many bytes went.
+func stripFile(file string, fsync bool) (int, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	var out []byte
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xd8}):
+		out, err = stripJPEG(b)
+	case bytes.HasPrefix(b, pngSignature):
+		out, err = stripPNG(b)
+	default:
+		return 0, nil
+	}
+	if err != nil || len(out) == len(b) {
+		return 0, err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Write(out); err != nil {
+		return 0, err
+	}
+	if fsync {
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b) - len(out), f.Close()
+}
+
+// stripJPEG copies the segments up to the scan, leaving out APP1, APP13
+// and COM, and the scan data after it as is.
+func stripJPEG(b []byte) ([]byte, error) {
+	out := append(make([]byte, 0, len(b)), b[:2]...)
+	i := 2
+	for i < len(b) {
+		if b[i] != 0xff {
+			return nil, errBadImage
+		}
+		if i+1 < len(b) && b[i+1] == 0xff { // fill byte
+			i++
+			continue
+		}
+		if i+1 >= len(b) {
+			return nil, errBadImage
+		}
+		marker := b[i+1]
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 { // no length
+			out = append(out, b[i:i+2]...)
+			i += 2
+			continue
+		}
+		if marker == 0xd9 || marker == 0xda { // end of image, start of scan
+			return append(out, b[i:]...), nil
+		}
+		if i+4 > len(b) {
+			return nil, errBadImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end > len(b) || end < i+4 {
+			return nil, errBadImage
+		}
+		switch marker {
+		case 0xe1, 0xed, 0xfe: // APP1 (EXIF, XMP), APP13 (IPTC), COM
+		default:
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// stripPNG copies every chunk but eXIf, tEXt, zTXt, iTXt and tIME.
+func stripPNG(b []byte) ([]byte, error) {
+	out := append(make([]byte, 0, len(b)), pngSignature...)
+	i := len(pngSignature)
+	for i < len(b) {
+		if i+8 > len(b) {
+			return nil, errBadImage
+		}
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		end := i + 12 + n // length, type, data, CRC
+		if n < 0 || end > len(b) {
+			return nil, errBadImage
+		}
+		switch string(b[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func pngChunk(typ string, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(len(data)))
+	b.WriteString(typ)
+	b.Write(data)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+	return b.Bytes()
+}
+
+func TestStripPNGKeepsThePicture(t *testing.T) {
+	var enc bytes.Buffer
+	png.Encode(&enc, image.NewGray(image.Rect(0, 0, 3, 3)))
+	b := enc.Bytes()
+	// text and a timestamp right after IHDR (8 signature + 25 IHDR bytes)
+	in := append(append(append([]byte{}, b[:33]...), pngChunk("tEXt", []byte("Author\x00someone"))...), pngChunk("tIME", make([]byte, 7))...)
+	in = append(in, b[33:]...)
+
+	file := filepath.Join(t.TempDir(), "0001.png.part")
+	os.WriteFile(file, in, 0o644)
+	n, err := stripFile(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := os.ReadFile(file)
+	if n != len(in)-len(b) || !bytes.Equal(out, b) {
+		t.Errorf("stripped %d bytes; got %d bytes, want the %d of the plain encoding", n, len(out), len(b))
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStripJPEGDropsEXIFAndComments(t *testing.T) {
+	var enc bytes.Buffer
+	jpeg.Encode(&enc, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	b := enc.Bytes()
+	exif := append([]byte{0xff, 0xe1, 0, 13}, []byte("Exif\x00\x00GPS!!")...)
+	com := append([]byte{0xff, 0xfe, 0, 6}, []byte("hi!!")...)
+	in := append(append(append(append([]byte{}, b[:2]...), exif...), com...), b[2:]...)
+
+	out, err := stripJPEG(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, b) {
+		t.Errorf("got %d bytes, want the %d of the plain encoding", len(out), len(b))
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStripLeavesOtherFilesAlone(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "0001.webp.part")
+	os.WriteFile(file, []byte("RIFF....WEBP"), 0o644)
+	if n, err := stripFile(file, false); n != 0 || err != nil {
+		t.Errorf("stripFile = %d, %v", n, err)
+	}
+	if _, err := stripJPEG([]byte{0xff, 0xd8, 0xff, 0xe1, 0xff}); err == nil {
+		t.Error("truncated JPEG accepted")
+	}
+}
+
+func TestStrippedPagesMatchTheManifest(t *testing.T) {
+	var enc bytes.Buffer
+	jpeg.Encode(&enc, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	b := enc.Bytes()
+	com := append([]byte{0xff, 0xfe, 0, 6}, []byte("hi!!")...)
+	body := append(append(append([]byte{}, b[:2]...), com...), b[2:]...)
+
+	srv := &fakeServer{replies: map[string][]reply{
+		"http://pages.example/book/01.png": {{status: 200, body: string(body)}},
+	}}
+	o := testOptions(t)
+	o.save.strip = true
+	s, _ := testSession(t, o, srv)
+	j := testJob(t, "01", "01")
+	if _, err := s.runJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(j.Out, "01.png")); err != nil || fi.Size() != int64(len(b)) {
+		t.Fatalf("saved page: %v, %v; want %d bytes", fi, err, len(b))
+	}
+	m, problems, err := verifyManifest(j.Out)
+	if err != nil || len(problems) > 0 {
+		t.Errorf("verify = %v, %v", problems, err)
+	}
+
+	// the server still has the page as it was: neither a remote check nor
+	// -check-remote-size should take the stripped copy for a changed one
+	if p := m.Pages["01.png"]; p == nil || p.Remote != int64(len(body)) {
+		t.Fatalf("manifest entry %+v; want remote_bytes %d", p, len(body))
+	}
+	if problems := verifyRemote(&http.Client{Transport: srv}, j.Out, m, defaultUA, 0, time.Second); len(problems) > 0 {
+		t.Errorf("verify -remote = %v", problems)
+	}
+	o.checkRemoteSize = true
+	os.Remove(filepath.Join(j.Out, completeFile)) // or the rerun skips the folder
+	s, _ = testSession(t, o, srv)
+	if _, err := s.runJob(j); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.requests(); len(got) != 3 || got[2] != "HEAD http://pages.example/book/01.png" {
+		t.Errorf("requests %v; want the page fetched once", got)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// expandTemplate replaces {name} placeholders with vars[name]. Anything else
+// in braces is an expression (see evalPlaceholder). Unknown names are an
+// error so typos surface before the first request.
+func expandTemplate(tmpl string, vars map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			b.WriteString(tmpl)
+			return b.String(), nil
+		}
+		j := strings.IndexByte(tmpl[i:], '}')
+		if j < 0 {
+			return "", fmt.Errorf("unclosed { in template %q", tmpl)
+		}
+		name := tmpl[i+1 : i+j]
+		v, ok := vars[name]
+		if !ok {
+			var err error
+			if v, err = evalPlaceholder(name, vars); err != nil {
+				return "", err
+			}
+		}
+		b.WriteString(tmpl[:i])
+		b.WriteString(v)
+		tmpl = tmpl[i+j+1:]
+	}
+}
+
+var (
+	placeholderName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	placeholderFormat = regexp.MustCompile(`^0?[0-9]*[dxXob]$`)
+)
+
+// evalPlaceholder handles {EXPR} and {EXPR:FMT}: integer arithmetic (+ - * /
+// % and parentheses) on numeric variables, e.g. {num*2+1} or {n-1}, printed
+// with FMT, a printf verb with an optional zero-padded width (x, X, o, b, d,
+// 04x). Without FMT the result is zero-padded to the width of the first
+// variable, so {num+1} of 0064 is 0065.
+func evalPlaceholder(name string, vars map[string]string) (string, error) {
+	if placeholderName.MatchString(name) {
+		return "", fmt.Errorf("unknown template variable {%s}", name)
+	}
+	expr, format, hasFormat := strings.Cut(name, ":")
+	p := &exprParser{s: expr, vars: vars}
+	n, err := p.expr()
+	if err == nil && p.pos < len(p.s) {
+		err = fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+	if err != nil {
+		return "", fmt.Errorf("template {%s}: %w", name, err)
+	}
+	if !hasFormat {
+		return fmt.Sprintf("%0*d", p.width, n), nil
+	}
+	if !placeholderFormat.MatchString(format) {
+		return "", fmt.Errorf("template {%s}: format must look like x, X, o, b, d or 04x", name)
+	}
+	return fmt.Sprintf("%"+format, n), nil
+}
+
+// exprParser is a recursive descent parser for evalPlaceholder.
+type exprParser struct {
+	s     string
+	pos   int
+	vars  map[string]string
+	width int // of the first variable used
+}
+
+func (p *exprParser) peek() byte {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) expr() (int, error) {
+	n, err := p.term()
+	for err == nil {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			break
+		}
+		p.pos++
+		var m int
+		if m, err = p.term(); op == '+' {
+			n += m
+		} else {
+			n -= m
+		}
+	}
+	return n, err
+}
+
+func (p *exprParser) term() (int, error) {
+	n, err := p.factor()
+	for err == nil {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			break
+		}
+		p.pos++
+		var m int
+		if m, err = p.factor(); err != nil {
+			break
+		}
+		switch {
+		case op == '*':
+			n *= m
+		case m == 0:
+			err = errors.New("division by zero")
+		case op == '/':
+			n /= m
+		default:
+			n %= m
+		}
+	}
+	return n, err
+}
+
+func (p *exprParser) factor() (int, error) {
+	c := p.peek()
+	start := p.pos
+	switch {
+	case c == '(':
+		p.pos++
+		n, err := p.expr()
+		if err == nil && p.peek() != ')' {
+			err = errors.New("missing )")
+		}
+		p.pos++
+		return n, err
+	case c == '-':
+		p.pos++
+		n, err := p.factor()
+		return -n, err
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		return toDec(p.s[start:p.pos]), nil
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.s) && (p.s[p.pos] == '_' || p.s[p.pos] >= 'a' && p.s[p.pos] <= 'z' ||
+			p.s[p.pos] >= 'A' && p.s[p.pos] <= 'Z' || p.s[p.pos] >= '0' && p.s[p.pos] <= '9') {
+			p.pos++
+		}
+		name := p.s[start:p.pos]
+		v, ok := p.vars[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown template variable {%s}", name)
+		}
+		if !isAllDigits(v) {
+			return 0, fmt.Errorf("{%s} is %q, not a number", name, v)
+		}
+		if p.width == 0 {
+			p.width = len(v)
+		}
+		return toDec(v), nil // "" while templates are checked counts as 0
+	case c == 0:
+		return 0, errors.New("unexpected end")
+	}
+	return 0, fmt.Errorf("unexpected %q", c)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func ioctl(fd int, req uint, arg unsafe.Pointer) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(arg)); e != 0 {
+		return e
+	}
+	return nil
+}
+
+func isTerminal(fd int) bool {
+	var t syscall.Termios
+	return ioctl(fd, syscall.TCGETS, unsafe.Pointer(&t)) == nil
+}
+
+// enableColor reports whether f is a terminal that shows ANSI colors.
+func enableColor(f *os.File) bool {
+	return isTerminal(int(f.Fd())) && os.Getenv("TERM") != "dumb"
+}
+
+// makeRaw turns off line buffering, echo and signal keys on fd so single key
+// presses (Ctrl-C included) reach the reader. It returns the undo.
+func makeRaw(fd int) (func(), error) {
+	var old syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Iflag &^= syscall.IXON | syscall.ICRNL
+	raw.Cc[syscall.VMIN], raw.Cc[syscall.VTIME] = 1, 0
+	if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(fd, syscall.TCSETS, unsafe.Pointer(&old)) }, nil
+}
+
+// termSize returns the terminal's columns and rows.
+func termSize(fd int) (int, int) {
+	var ws struct{ rows, cols, x, y uint16 }
+	if ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)) != nil || ws.cols == 0 {
+		return 80, 24
+	}
+	return int(ws.cols), int(ws.rows)
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func isTerminal(fd int) bool { return false }
+
+func enableColor(f *os.File) bool { return false }
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+func termSize(fd int) (int, int) { return 80, 24 }
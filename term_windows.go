@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode             = kernel32.NewProc("SetConsoleMode")
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+)
+
+const (
+	enableProcessedInput            = 0x1
+	enableLineInput                 = 0x2
+	enableEchoInput                 = 0x4
+	enableVirtualTerminalProcessing = 0x4
+)
+
+func isTerminal(fd int) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(fd), &mode) == nil
+}
+
+func setConsoleMode(h syscall.Handle, mode uint32) error {
+	if r, _, err := procSetConsoleMode.Call(uintptr(h), uintptr(mode)); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// enableColor turns on ANSI escapes for the console f and reports whether
+// it could.
+func enableColor(f *os.File) bool {
+	h := syscall.Handle(f.Fd())
+	var mode uint32
+	if syscall.GetConsoleMode(h, &mode) != nil {
+		return false
+	}
+	return mode&enableVirtualTerminalProcessing != 0 || setConsoleMode(h, mode|enableVirtualTerminalProcessing) == nil
+}
+
+// makeRaw turns off line input, echo and Ctrl-C handling on the console
+// input fd and turns on ANSI escapes for stdout. It returns the undo.
+func makeRaw(fd int) (func(), error) {
+	in, out := syscall.Handle(fd), syscall.Stdout
+	var oldIn, oldOut uint32
+	if err := syscall.GetConsoleMode(in, &oldIn); err != nil {
+		return nil, err
+	}
+	if err := setConsoleMode(in, oldIn&^(enableProcessedInput|enableLineInput|enableEchoInput)); err != nil {
+		return nil, err
+	}
+	if syscall.GetConsoleMode(out, &oldOut) == nil {
+		setConsoleMode(out, oldOut|enableVirtualTerminalProcessing)
+	}
+	return func() {
+		setConsoleMode(in, oldIn)
+		setConsoleMode(out, oldOut)
+	}, nil
+}
+
+// termSize returns the console window's columns and rows.
+func termSize(fd int) (int, int) {
+	var info struct {
+		size, cursor             [2]int16
+		attrs                    uint16
+		left, top, right, bottom int16
+		maxSize                  [2]int16
+	}
+	if r, _, _ := procGetConsoleScreenBufferInfo.Call(uintptr(fd), uintptr(unsafe.Pointer(&info))); r == 0 {
+		return 80, 24
+	}
+	return int(info.right-info.left) + 1, int(info.bottom-info.top) + 1
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Some readers split every page into tiles (0064_1.png .. 0064_4.png). With
+// -parts the {part} variable is a second sequence inside each page, and
+// -stitch can put the tiles back together into one image per page.
+
+// parseParts parses -parts: "FROM-TO" or "FROM-auto", padded like FROM.
+// last is -1 for auto (keep going until a tile is missing).
+func parseParts(v string) (first, last, pad int, err error) {
+	from, to, ok := strings.Cut(v, "-")
+	if !ok || !isAllDigits(from) || (to != "auto" && !isAllDigits(to)) {
+		return 0, 0, 0, fmt.Errorf("parts must look like 1-4 or 01-auto (got %q)", v)
+	}
+	first, last = toDec(from), -1
+	if to != "auto" {
+		if last = toDec(to); last < first {
+			return 0, 0, 0, fmt.Errorf("parts: %s is before %s", to, from)
+		}
+	}
+	return first, last, len(from), nil
+}
+
+// stitchLayout is how tiles are arranged: cols tiles per row, filled left to
+// right, top to bottom. cols 0 means one row (horizontal).
+type stitchLayout struct {
+	cols int
+}
+
+func parseStitch(v string) (stitchLayout, error) {
+	switch {
+	case v == "vertical":
+		return stitchLayout{cols: 1}, nil
+	case v == "horizontal":
+		return stitchLayout{}, nil
+	case strings.HasPrefix(v, "grid:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(v, "grid:"))
+		if err != nil || n < 1 {
+			return stitchLayout{}, fmt.Errorf("stitch grid needs a column count, e.g. grid:2 (got %q)", v)
+		}
+		return stitchLayout{cols: n}, nil
+	}
+	return stitchLayout{}, fmt.Errorf("stitch must be vertical, horizontal or grid:N (got %q)", v)
+}
+
+// stitchTiles decodes tiles and writes them as one PNG to out. Columns are as
+// wide as their widest tile and rows as tall as their tallest, so uneven edge
+// tiles line up.
+func stitchTiles(tiles []string, out string, l stitchLayout) error {
+	if len(tiles) == 0 {
+		return errors.New("no tiles to stitch")
+	}
+	cols := l.cols
+	if cols == 0 || cols > len(tiles) {
+		cols = len(tiles)
+	}
+	rows := (len(tiles) + cols - 1) / cols
+
+	imgs := make([]image.Image, len(tiles))
+	colW := make([]int, cols)
+	rowH := make([]int, rows)
+	for i, name := range tiles {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		imgs[i] = img
+		b := img.Bounds()
+		colW[i%cols] = max(colW[i%cols], b.Dx())
+		rowH[i/cols] = max(rowH[i/cols], b.Dy())
+	}
+
+	w, h := 0, 0
+	for _, v := range colW {
+		w += v
+	}
+	for _, v := range rowH {
+		h += v
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, w, h))
+	y := 0
+	for r := 0; r < rows; r++ {
+		x := 0
+		for c := 0; c < cols && r*cols+c < len(imgs); c++ {
+			img := imgs[r*cols+c]
+			b := img.Bounds()
+			draw.Draw(canvas, image.Rect(x, y, x+b.Dx(), y+b.Dy()), img, b.Min, draw.Src)
+			x += colW[c]
+		}
+		y += rowH[r]
+	}
+
+	f, err := os.Create(out + ".part")
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, canvas); err != nil {
+		f.Close()
+		os.Remove(out + ".part")
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(out + ".part")
+		return err
+	}
+	return os.Rename(out+".part", out)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// saving is how downloadFile writes a page to disk.
+type saving struct {
+	chunks chunking
+	fsync  bool   // -fsync
+	tmpDir string // -tmp-dir; "" = the .part file sits next to the page
+	strip  bool   // -strip-metadata
+	crc32  bool   // -crc32
+}
+
+// partName is where fileNow is written until it is complete. In -tmp-dir
+// the name carries a hash of the full path, since every folder has its own
+// 0001.png.
+func (sv saving) partName(fileNow string) string {
+	if sv.tmpDir == "" {
+		return fileNow + ".part"
+	}
+	abs, err := filepath.Abs(fileNow)
+	if err != nil {
+		abs = fileNow
+	}
+	h := sha256.Sum256([]byte(abs))
+	return filepath.Join(sv.tmpDir, hex.EncodeToString(h[:6])+"-"+filepath.Base(fileNow)+".part")
+}
+
+// moveIntoPlace renames the finished tmp over fileNow. A rename cannot
+// cross filesystems, so from a -tmp-dir elsewhere the file is copied into
+// a .part next to fileNow first, which is then renamed as usual.
+func (sv saving) moveIntoPlace(tmp, fileNow string) error {
+	err := os.Rename(tmp, fileNow)
+	if err == nil || sv.tmpDir == "" {
+		return err
+	}
+	local := fileNow + ".part"
+	if err := copyFile(tmp, local, sv.fsync); err != nil {
+		os.Remove(local)
+		return err
+	}
+	if err := os.Rename(local, fileNow); err != nil {
+		return err
+	}
+	return os.Remove(tmp)
+}
+
+func copyFile(from, to string, fsync bool) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if fsync {
+		if err := out.Sync(); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With -otlp (or OTEL_EXPORTER_OTLP_ENDPOINT) every job, chapter range, page,
+// request and wait becomes a span, sent as OTLP/HTTP JSON when the job ends.
+// All methods work on a nil *tracer or *span, so untraced runs pay nothing.
+
+type tracer struct {
+	endpoint string // full URL of the traces endpoint
+	client   *http.Client
+
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+type span struct {
+	t       *tracer
+	traceID string
+	id      string
+	parent  string
+	name    string
+	start   time.Time
+	attrs   []otlpAttr
+	errMsg  string
+}
+
+// OTLP JSON encoding, see opentelemetry-proto's trace.proto.
+type otlpSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+	Status       otlpStatus `json:"status"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"` // int64 is a string in OTLP JSON
+	Bool   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 1 ok, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+// newTracer returns nil (tracing off) unless an endpoint is given on the
+// command line or in the standard OTel environment variables.
+func newTracer(endpoint string) *tracer {
+	if endpoint == "" {
+		if endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint == "" {
+			if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+				endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+			}
+		}
+	} else if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	if endpoint == "" {
+		return nil
+	}
+	return &tracer{endpoint: endpoint, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start opens a span under parent, or a new trace if parent is nil.
+func (t *tracer) start(parent *span, name string) *span {
+	if t == nil {
+		return nil
+	}
+	s := &span{t: t, id: randHex(8), name: name, start: time.Now()}
+	if parent != nil {
+		s.traceID, s.parent = parent.traceID, parent.id
+	} else {
+		s.traceID = randHex(16)
+	}
+	return s
+}
+
+func (s *span) set(key string, v any) {
+	if s == nil {
+		return
+	}
+	a := otlpAttr{Key: key}
+	switch v := v.(type) {
+	case string:
+		a.Value.String = &v
+	case int:
+		i := strconv.Itoa(v)
+		a.Value.Int = &i
+	case int64:
+		i := strconv.FormatInt(v, 10)
+		a.Value.Int = &i
+	case bool:
+		a.Value.Bool = &v
+	default:
+		str := fmt.Sprint(v)
+		a.Value.String = &str
+	}
+	s.attrs = append(s.attrs, a)
+}
+
+func (s *span) fail(msg string) {
+	if s != nil {
+		s.errMsg = msg
+	}
+}
+
+func (s *span) end() {
+	if s == nil {
+		return
+	}
+	out := otlpSpan{
+		TraceID: s.traceID, SpanID: s.id, ParentSpanID: s.parent, Name: s.name, Kind: 1,
+		Start: strconv.FormatInt(s.start.UnixNano(), 10), End: strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes: s.attrs, Status: otlpStatus{Code: 1},
+	}
+	if s.errMsg != "" {
+		out.Status = otlpStatus{Code: 2, Message: s.errMsg}
+	}
+	s.t.mu.Lock()
+	s.t.spans = append(s.t.spans, out)
+	s.t.mu.Unlock()
+}
+
+// flush sends the finished spans. Export errors only warn; a collector being
+// down must not stop a download.
+func (t *tracer) flush() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	svc := "qxdl"
+	ver := version
+	body := map[string]any{"resourceSpans": []any{map[string]any{
+		"resource": map[string]any{"attributes": []otlpAttr{
+			{Key: "service.name", Value: otlpValue{String: &svc}},
+			{Key: "service.version", Value: otlpValue{String: &ver}},
+		}},
+		"scopeSpans": []any{map[string]any{
+			"scope": map[string]string{"name": "qxdl"},
+			"spans": spans,
+		}},
+	}}}
+	b, err := json.Marshal(body)
+	if err != nil {
+		fmt.Println("[WARN] otlp:", err)
+		return
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		fmt.Println("[WARN] otlp:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Printf("[WARN] otlp: %s answered %s\n", t.endpoint, resp.Status)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// transportConfig describes everything about how qxdl talks to the network in
+// one file (-transport-config), so it can be reviewed and approved as a
+// single artifact instead of a pile of flags. JSON is accepted as well.
+type transportConfig struct {
+	// Proxy is a proxy URL, "none", or empty/"env" for HTTP(S)_PROXY/NO_PROXY.
+	Proxy    string            `yaml:"proxy"`
+	Headers  map[string]string `yaml:"headers"`
+	TLS      tlsConfig         `yaml:"tls"`
+	Timeouts timeoutConfig     `yaml:"timeouts"`
+	Conns    connConfig        `yaml:"connections"`
+	Redirect redirectConfig    `yaml:"redirects"`
+	// Resolve pins "host:port" to an IP address, like curl --resolve.
+	Resolve map[string]string `yaml:"resolve"`
+	// IPVersion limits connections to IPv4 (4) or IPv6 (6); 0 allows both.
+	IPVersion int `yaml:"ip_version"`
+}
+
+// connConfig tunes connection reuse. A sequential run needs one warm
+// connection per host; keeping it saves a TLS handshake per page.
+type connConfig struct {
+	KeepAlive *bool `yaml:"keep_alive"` // reuse connections (default true)
+	HTTP2     *bool `yaml:"http2"`      // negotiate HTTP/2 where offered (default true)
+	MaxIdle   int   `yaml:"max_idle_per_host"`
+}
+
+// redirectConfig limits which redirects are followed and what they get.
+type redirectConfig struct {
+	Max       *int  `yaml:"max"`        // redirects per request (default 10; 0 refuses all)
+	CrossHost *bool `yaml:"cross_host"` // follow redirects to another host (default true)
+	// Trust sends the configured Cookie, Authorization and Referer headers,
+	// and the Referer of the redirect itself, to the other host as well
+	Trust bool `yaml:"trust_other_hosts"`
+}
+
+// check is the client's CheckRedirect.
+func (c redirectConfig) check(req *http.Request, via []*http.Request) error {
+	limit := 10
+	if c.Max != nil {
+		limit = *c.Max
+	}
+	if len(via) > limit {
+		return fmt.Errorf("redirected more than %d time(s) (-max-redirects)", limit)
+	}
+	if c.CrossHost != nil && !*c.CrossHost && !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		return fmt.Errorf("redirect from %s to %s refused (-cross-host-redirects=false)", via[0].URL.Host, req.URL.Host)
+	}
+	return nil
+}
+
+type tlsConfig struct {
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
+	MinVersion string `yaml:"min_version"` // "1.2" or "1.3"
+	Insecure   bool   `yaml:"insecure_skip_verify"`
+}
+
+type timeoutConfig struct {
+	Request        duration `yaml:"request"`
+	Dial           duration `yaml:"dial"`
+	TLSHandshake   duration `yaml:"tls_handshake"`
+	ResponseHeader duration `yaml:"response_header"`
+	IdleConn       duration `yaml:"idle_conn"`
+}
+
+// duration accepts Go duration strings ("30s", "2m") in YAML and JSON.
+type duration time.Duration
+
+func (d *duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func loadTransportConfig(name string) (*transportConfig, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var cfg transportConfig
+	// YAML is a superset of JSON, so one decoder serves both
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &cfg, nil
+}
+
+// newHTTPClient builds the client every request goes through. A nil cfg
+// means defaults throughout.
+func newHTTPClient(cfg *transportConfig, timeout time.Duration) (*http.Client, error) {
+	if cfg == nil {
+		cfg = &transportConfig{}
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if cfg.Timeouts.Dial > 0 {
+		dialer.Timeout = time.Duration(cfg.Timeouts.Dial)
+	}
+	switch cfg.IPVersion {
+	case 0, 4, 6:
+	default:
+		return nil, fmt.Errorf("ip_version must be 4 or 6 (got %d)", cfg.IPVersion)
+	}
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if ip, ok := cfg.Resolve[addr]; ok {
+			_, port, _ := net.SplitHostPort(addr)
+			addr = net.JoinHostPort(ip, port)
+		}
+		if cfg.IPVersion != 0 {
+			network = fmt.Sprintf("tcp%d", cfg.IPVersion)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	if cfg.Timeouts.TLSHandshake > 0 {
+		tr.TLSHandshakeTimeout = time.Duration(cfg.Timeouts.TLSHandshake)
+	}
+	if cfg.Timeouts.ResponseHeader > 0 {
+		tr.ResponseHeaderTimeout = time.Duration(cfg.Timeouts.ResponseHeader)
+	}
+	if cfg.Timeouts.IdleConn > 0 {
+		tr.IdleConnTimeout = time.Duration(cfg.Timeouts.IdleConn)
+	}
+	tr.MaxIdleConnsPerHost = 2
+	if cfg.Conns.MaxIdle > 0 {
+		tr.MaxIdleConnsPerHost = cfg.Conns.MaxIdle
+	}
+	if cfg.Conns.KeepAlive != nil && !*cfg.Conns.KeepAlive {
+		tr.DisableKeepAlives = true
+	}
+	if cfg.Conns.HTTP2 != nil && !*cfg.Conns.HTTP2 {
+		// a non-nil empty map is how net/http is told not to upgrade
+		tr.ForceAttemptHTTP2 = false
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	switch cfg.Proxy {
+	case "", "env":
+		tr.Proxy = http.ProxyFromEnvironment
+	case "none":
+		tr.Proxy = nil
+	default:
+		pu, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		tr.Proxy = http.ProxyURL(pu)
+	}
+
+	tc, err := cfg.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+	tr.TLSClientConfig = tc
+	tr.RegisterProtocol("ftp", &ftpTransport{dial: tr.DialContext})
+	tr.RegisterProtocol("sftp", sftpTransport{})
+
+	var rt http.RoundTripper = tr
+	if len(cfg.Headers) > 0 || !cfg.Redirect.Trust {
+		rt = &headerTransport{next: tr, headers: cfg.Headers, trust: cfg.Redirect.Trust}
+	}
+	return &http.Client{Timeout: timeout, Transport: rt, CheckRedirect: cfg.Redirect.check}, nil
+}
+
+// parseResolve parses one -resolve entry, HOST:PORT:ADDR, into the
+// "host:port" key and address of transportConfig.Resolve.
+func parseResolve(v string) (hostPort, ip string, err error) {
+	host, rest, _ := strings.Cut(v, ":")
+	port, addr, ok := strings.Cut(rest, ":")
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if _, perr := strconv.Atoi(port); !ok || host == "" || perr != nil || net.ParseIP(addr) == nil {
+		return "", "", fmt.Errorf("resolve must look like host:443:203.0.113.7 (got %q)", v)
+	}
+	return net.JoinHostPort(strings.ToLower(host), port), addr, nil
+}
+
+// override lays the TLS flags over the config file's values.
+func (c *tlsConfig) override(f tlsConfig) {
+	if f.CAFile != "" {
+		c.CAFile = f.CAFile
+	}
+	if f.CertFile != "" || f.KeyFile != "" {
+		c.CertFile, c.KeyFile = f.CertFile, f.KeyFile
+	}
+	if f.Insecure {
+		c.Insecure = true
+	}
+}
+
+func (c tlsConfig) build() (*tls.Config, error) {
+	tc := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.Insecure}
+	switch c.MinVersion {
+	case "":
+	case "1.2":
+		tc.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tc.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("tls min_version %q (want 1.2 or 1.3)", c.MinVersion)
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", c.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("tls cert_file and key_file must be given together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// headerTransport adds fixed headers to every request it sends. After a
+// redirect to another host, unless trusted, it leaves out the ones that
+// identify us to the first host or tell where we came from.
+type headerTransport struct {
+	next    http.RoundTripper
+	headers map[string]string
+	trust   bool
+}
+
+// untrustedHeaders are kept from another host a redirect leads to.
+var untrustedHeaders = map[string]bool{"Cookie": true, "Authorization": true, "Referer": true}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	foreign := !t.trust && !strings.EqualFold(req.URL.Host, firstRequest(req).URL.Host)
+	if foreign {
+		req.Header.Del("Referer") // the one net/http sets on redirects
+	}
+	for k, v := range t.headers {
+		if foreign && untrustedHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// firstRequest follows a redirected request back to the one that started it.
+func firstRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+	return req
+}
+
+// dumpTransport prints each response's status and headers at -v, and the
+// request, protocol and timing as well at -vv.
+type dumpTransport struct {
+	next      http.RoundTripper // nil means http.DefaultTransport
+	verbosity int
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	dbg := logAt(t.verbosity, lvlDebug)
+	fmt.Fprintf(dbg, "[req ] %s %s\n", req.Method, req.URL)
+	dumpHeader(dbg, req.Header)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(ci httptrace.GotConnInfo) {
+			if ci.Reused {
+				fmt.Fprintf(dbg, "       reusing connection to %s (idle %v)\n", ci.Conn.RemoteAddr(), ci.IdleTime.Round(time.Millisecond))
+			} else {
+				fmt.Fprintf(dbg, "       new connection to %s\n", ci.Conn.RemoteAddr())
+			}
+		},
+	}))
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	took := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		fmt.Fprintf(logAt(t.verbosity, lvlVerbose), "[resp] %s %s: %v (%v)\n", req.Method, req.URL, err, took)
+		return resp, err
+	}
+	v := logAt(t.verbosity, lvlVerbose)
+	fmt.Fprintf(v, "[resp] %s %s: %s (%v)\n", req.Method, req.URL, resp.Status, took)
+	if resp.TLS != nil {
+		fmt.Fprintf(dbg, "       %s, %s, %s\n", resp.Proto, tls.VersionName(resp.TLS.Version), tls.CipherSuiteName(resp.TLS.CipherSuite))
+	} else {
+		fmt.Fprintf(dbg, "       %s\n", resp.Proto)
+	}
+	dumpHeader(v, resp.Header)
+	return resp, nil
+}
+
+// dumpHeader prints h sorted, keeping credentials out of logs.
+func dumpHeader(w io.Writer, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			switch k {
+			case "Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie":
+				v = "(redacted)"
+			}
+			fmt.Fprintf(w, "       %s: %s\n", k, v)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -tui replaces the scrolling log with a dashboard redrawn in place. The
+// download code keeps printing as usual; the dashboard reads those lines
+// from a pipe in front of stdout and pairs them with the job's counters.
+
+const (
+	tuiLogLines = 200
+	tuiErrLines = 5
+)
+
+type tui struct {
+	term    *os.File // the real stdout
+	pipe    *os.File // what os.Stdout writes to while the dashboard runs
+	ctl     *jobControl
+	restore func()
+	started time.Time
+	done    chan struct{}
+	drained chan struct{} // closed once the pipe is read to the end
+	once    sync.Once
+
+	mu       sync.Mutex
+	log      []string
+	errs     []string
+	job      string
+	active   string
+	wait     time.Duration
+	waitFrom time.Time
+}
+
+// activeTUI is the running dashboard, if any; exitErr and the summaries
+// stop it so the terminal is usable again before anything is printed.
+var activeTUI *tui
+
+// startTUI takes over the terminal for s. It needs stdin and stdout to be a
+// terminal.
+func startTUI(s *session) error {
+	term := os.Stdout
+	if runLog != nil {
+		term = runLog.console
+	}
+	if !isTerminal(int(os.Stdin.Fd())) || !isTerminal(int(term.Fd())) {
+		return errors.New("-tui needs an interactive terminal")
+	}
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		restore()
+		return err
+	}
+	t := &tui{term: term, pipe: w, ctl: s.ctl, restore: restore, started: time.Now(),
+		done: make(chan struct{}), drained: make(chan struct{})}
+	if runLog != nil {
+		// -log-file stays in front so it still sees every line
+		runLog.setConsole(w)
+	} else {
+		os.Stdout = w
+	}
+	activeTUI = t
+
+	go t.read(r)
+	go t.keys()
+	go func() {
+		tick := time.NewTicker(500 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-tick.C:
+				t.draw()
+			}
+		}
+	}()
+	fmt.Fprint(t.term, "\x1b[?25l") // hide the cursor
+	return nil
+}
+
+// stopTUI gives the terminal back and prints the last log lines so the end
+// of the run is still on screen.
+func stopTUI() {
+	t := activeTUI
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		activeTUI = nil
+		close(t.done)
+		if runLog != nil {
+			runLog.setConsole(t.term)
+		} else {
+			os.Stdout = t.term
+		}
+		t.pipe.Close()
+		<-t.drained
+		t.restore()
+		fmt.Fprint(t.term, "\x1b[H\x1b[2J\x1b[?25h")
+		t.mu.Lock()
+		tail := t.log[max(0, len(t.log)-20):]
+		t.mu.Unlock()
+		for _, l := range tail {
+			fmt.Fprintln(t.term, l)
+		}
+	})
+}
+
+func (t *tui) read(r *os.File) {
+	defer close(t.drained)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		t.add(sc.Text())
+	}
+}
+
+// add files one log line under what it tells about the run.
+func (t *tui) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.log = append(t.log, line)
+	if len(t.log) > tuiLogLines {
+		t.log = t.log[len(t.log)-tuiLogLines:]
+	}
+	switch {
+	case strings.HasPrefix(line, "=== "):
+		t.job = strings.Trim(line, "= ")
+	case strings.HasPrefix(line, "URL: ") && t.job == "":
+		t.job = strings.TrimPrefix(line, "URL: ")
+	case strings.HasPrefix(line, "[get ]"), strings.HasPrefix(line, "[retry"), strings.HasPrefix(line, "[probe]"):
+		t.active = line
+	case strings.HasPrefix(line, "waiting "):
+		if d, err := time.ParseDuration(strings.TrimSuffix(strings.TrimPrefix(line, "waiting "), "...")); err == nil {
+			t.wait, t.waitFrom = d, time.Now()
+		}
+	case strings.HasPrefix(line, "[fail]"), strings.HasPrefix(line, "[ERROR]"), strings.HasPrefix(line, "[WARN]"),
+		strings.HasPrefix(line, "[slow]"), strings.HasPrefix(line, "[odd ]"), strings.HasPrefix(line, "Too many"):
+		t.errs = append(t.errs, time.Now().Format("15:04:05 ")+line)
+		if len(t.errs) > tuiErrLines {
+			t.errs = t.errs[1:]
+		}
+	}
+}
+
+// keys handles p (pause/resume), s (skip the current job) and q or Ctrl-C.
+func (t *tui) keys() {
+	b := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(b); err != nil {
+			return
+		}
+		switch b[0] {
+		case 'p', 'P', ' ':
+			t.ctl.mu.Lock()
+			paused := !t.ctl.paused
+			t.ctl.mu.Unlock()
+			t.ctl.setPaused(paused)
+		case 's', 'S':
+			t.ctl.mu.Lock()
+			t.ctl.skip = true
+			t.ctl.mu.Unlock()
+			t.add("[skip] skipping the rest of this job after the current page")
+		case 'q', 'Q', 3:
+			stopTUI()
+			fmt.Println("Interrupted.")
+			exit(exitInterrupted)
+		}
+		t.draw()
+	}
+}
+
+func (t *tui) draw() {
+	if activeTUI != t {
+		return
+	}
+	cols, rows := termSize(int(t.term.Fd()))
+	t.ctl.mu.Lock()
+	p, paused := t.ctl.progress, t.ctl.paused
+	t.ctl.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	elapsed := time.Since(t.started)
+	state := "running"
+	if paused {
+		state = "PAUSED (after the current page)"
+	}
+	wait := "-"
+	if left := t.wait - time.Since(t.waitFrom); left > 0 {
+		wait = fmt.Sprintf("%v left of %v", left.Round(100*time.Millisecond), t.wait.Round(100*time.Millisecond))
+	}
+	rate := float64(p.Bytes) / max(elapsed.Seconds(), 1)
+
+	lines := []string{
+		fmt.Sprintf("qxdl  %s  %s        [p] pause/resume  [s] skip job  [q] quit", state, elapsed.Round(time.Second)),
+		"",
+		"Job:     " + t.job,
+		"Now:     " + t.active,
+		"Wait:    " + wait,
+		fmt.Sprintf("Pages:   ok %d  skipped %d  missing %d  failed %d   %s  (%s/s)",
+			p.OK, p.Skipped, p.Missing, p.Failed, humanBytes(p.Bytes), humanBytes(int64(rate))),
+		"",
+		"Recent errors:",
+	}
+	for _, e := range t.errs {
+		lines = append(lines, "  "+e)
+	}
+	lines = append(lines, "", "Log:")
+	room := rows - len(lines) - 1
+	if room > 0 {
+		for _, l := range t.log[max(0, len(t.log)-room):] {
+			lines = append(lines, "  "+l)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i, l := range lines {
+		if len(l) > cols {
+			l = l[:cols]
+		}
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(l)
+	}
+	fmt.Fprint(t.term, b.String())
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
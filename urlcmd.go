@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// urlSource is -url-cmd: an external program that prints one page URL per
+// line, for sources whose URLs no template can describe (hashed names, paths
+// from an API). Lines are read only as pages need them, so a slow generator
+// is paced by the download itself. Line k is the k-th page of the range.
+// -from-page fills one with the URLs it scraped and no program.
+type urlSource struct {
+	name  string // the flag it came from, for messages
+	cmd   *exec.Cmd
+	out   io.ReadCloser
+	sc    *bufio.Scanner
+	lines []string
+	line  int // lines read, for error messages
+	done  bool
+}
+
+func startURLSource(command string, env ...string) (*urlSource, error) {
+	cmd := shellCommand(command, env...)
+	cmd.Stderr = os.Stdout
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("url-cmd: %w", err)
+	}
+	return &urlSource{name: "-url-cmd", cmd: cmd, out: out, sc: bufio.NewScanner(out)}, nil
+}
+
+// at returns the URL of the i-th page (0-based); "" once the program has no
+// more. Blank lines and # comments are ignored.
+func (u *urlSource) at(i int) (string, error) {
+	for len(u.lines) <= i && !u.done {
+		if !u.sc.Scan() {
+			u.done = true
+			if err := u.sc.Err(); err != nil {
+				return "", fmt.Errorf("url-cmd: %w", err)
+			}
+			break
+		}
+		u.line++
+		l := strings.TrimSpace(u.sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if !isSourceURL(l) {
+			return "", fmt.Errorf("url-cmd line %d: %q is not an http(s), ftp or sftp URL", u.line, l)
+		}
+		u.lines = append(u.lines, l)
+	}
+	if i < len(u.lines) {
+		return u.lines[i], nil
+	}
+	return "", nil
+}
+
+// close stops the program if the range ended before its list did.
+func (u *urlSource) close() {
+	if u.cmd == nil {
+		return
+	}
+	if !u.done {
+		u.cmd.Process.Kill()
+	}
+	u.out.Close()
+	if err := u.cmd.Wait(); err != nil && u.done {
+		fmt.Println("[WARN] url-cmd:", err)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// -record saves every response of a run, bodies included, to a cassette
+// file; -replay answers a later run from it without touching the network,
+// each response after the time it took to arrive. Pacing, retries, cooldowns
+// and end detection then run against a server that behaves exactly as it
+// did once, as often as needed.
+
+const cassetteVersion = 1
+
+type cassette struct {
+	Version      int           `json:"version"`
+	Interactions []interaction `json:"interactions"`
+}
+
+// interaction is one request and what came back: a response, or the error.
+type interaction struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Range   string      `json:"range,omitempty"` // a -chunks request
+	Status  int         `json:"status,omitempty"`
+	Proto   string      `json:"proto,omitempty"`
+	Header  http.Header `json:"header,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+	Err     string      `json:"error,omitempty"`
+	Latency float64     `json:"latency_ms"` // until the whole body was in
+}
+
+// runRecorder is the cassette being recorded, if any.
+var runRecorder *recorder
+
+type recorder struct {
+	path string
+	next http.RoundTripper
+
+	mu   sync.Mutex
+	c    cassette
+	once sync.Once
+}
+
+func startRecording(path string, next http.RoundTripper) *recorder {
+	runRecorder = &recorder{path: path, next: next, c: cassette{Version: cassetteVersion}}
+	return runRecorder
+}
+
+// stopRecording writes the cassette.
+func stopRecording() {
+	r := runRecorder
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.c.Interactions == nil {
+			r.c.Interactions = []interaction{}
+		}
+		b, err := json.MarshalIndent(r.c, "", "  ")
+		if err == nil {
+			if err = os.WriteFile(r.path+".part", b, 0o644); err == nil {
+				err = os.Rename(r.path+".part", r.path)
+			}
+		}
+		if err != nil {
+			fmt.Println("[WARN] record:", err)
+		}
+	})
+}
+
+// RoundTrip reads the whole body before handing it on, so the cassette
+// holds it even when the caller stops reading early.
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	it := interaction{Method: req.Method, URL: req.URL.String(), Range: req.Header.Get("Range")}
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		it.Err, it.Latency = err.Error(), ms(time.Since(start))
+		r.add(it)
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	it.Status, it.Proto, it.Header, it.Body = resp.StatusCode, resp.Proto, resp.Header, body
+	it.Latency = ms(time.Since(start))
+	r.add(it)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (r *recorder) add(it interaction) {
+	r.mu.Lock()
+	r.c.Interactions = append(r.c.Interactions, it)
+	r.mu.Unlock()
+}
+
+// player answers requests from a cassette. Interactions with the same
+// method, URL and Range are played in the order they were recorded; once
+// they run out, the last one is played again.
+type player struct {
+	speed float64 // latency factor; 0 answers at once
+
+	mu    sync.Mutex
+	queue map[string][]interaction
+}
+
+func loadCassette(path string, speed float64) (*player, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if c.Version > cassetteVersion {
+		return nil, fmt.Errorf("%s: version %d is newer than this qxdl knows (%d)", path, c.Version, cassetteVersion)
+	}
+	p := &player{speed: speed, queue: map[string][]interaction{}}
+	for _, it := range c.Interactions {
+		k := it.Method + " " + it.URL + " " + it.Range
+		p.queue[k] = append(p.queue[k], it)
+	}
+	return p, nil
+}
+
+var errNotRecorded = errors.New("not in the cassette")
+
+func (p *player) RoundTrip(req *http.Request) (*http.Response, error) {
+	p.mu.Lock()
+	k := req.Method + " " + req.URL.String() + " " + req.Header.Get("Range")
+	q := p.queue[k]
+	if len(q) == 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("replay %s %s: %w", req.Method, req.URL, errNotRecorded)
+	}
+	it := q[0]
+	if len(q) > 1 {
+		p.queue[k] = q[1:]
+	}
+	p.mu.Unlock()
+
+	t := time.NewTimer(time.Duration(it.Latency * p.speed * float64(time.Millisecond)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	if it.Err != "" {
+		return nil, fmt.Errorf("replay: %s", it.Err)
+	}
+	proto := it.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	major, minor, _ := http.ParseHTTPVersion(proto)
+	body := it.Body
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	return &http.Response{
+		Status: fmt.Sprintf("%d %s", it.Status, http.StatusText(it.Status)), StatusCode: it.Status,
+		Proto: proto, ProtoMajor: major, ProtoMinor: minor,
+		Header: it.Header.Clone(), Body: io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(it.Body)), Request: req,
+	}, nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pageProblem is one issue verify found with a local page.
+type pageProblem struct {
+	File   string
+	Reason string
+}
+
+// checkImage reports whether file looks like a complete image: a decodable
+// header and, for PNG, JPEG, GIF and WEBP, the end marker a truncated
+// download lacks. Other formats are only checked for a known signature.
+func checkImage(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() == 0 {
+		return errors.New("zero-byte file")
+	}
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(16)
+	switch {
+	case bytes.HasPrefix(head, []byte("RIFF")) && len(head) >= 12 && string(head[8:12]) == "WEBP":
+		// the RIFF size covers everything after the first 8 bytes
+		if n := int64(binary.LittleEndian.Uint32(head[4:8])) + 8; fi.Size() < n {
+			return fmt.Errorf("truncated: %d of %d bytes", fi.Size(), n)
+		}
+		return nil
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return nil // AVIF/HEIF
+	}
+	_, format, err := image.DecodeConfig(br)
+	if err != nil {
+		return fmt.Errorf("bad image header: %w", err)
+	}
+	n := int64(64)
+	if fi.Size() < n {
+		n = fi.Size()
+	}
+	tail := make([]byte, n)
+	if _, err := f.ReadAt(tail, fi.Size()-int64(len(tail))); err != nil {
+		return err
+	}
+	switch format {
+	case "png":
+		if !bytes.HasSuffix(tail, []byte("IEND\xaeB`\x82")) {
+			return errors.New("truncated: no IEND chunk")
+		}
+	case "jpeg":
+		// some encoders pad after the end marker, so look near the end
+		if !bytes.Contains(tail, []byte{0xff, 0xd9}) {
+			return errors.New("truncated: no end-of-image marker")
+		}
+	case "gif":
+		if !bytes.HasSuffix(bytes.TrimRight(tail, "\x00"), []byte{0x3b}) {
+			return errors.New("truncated: no GIF trailer")
+		}
+	}
+	return nil
+}
+
+// readSums parses a SHA256SUMS file into name -> hex digest.
+func readSums(dir string) (map[string]string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "SHA256SUMS"))
+	if err != nil {
+		return nil, err
+	}
+	sums := map[string]string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		sum, name, ok := strings.Cut(strings.TrimSpace(line), "  ")
+		if ok {
+			sums[strings.TrimPrefix(name, "*")] = sum
+		}
+	}
+	return sums, nil
+}
+
+// verifyFolder checks every page in dir offline: non-empty, decodable image
+// header, and matching SHA256SUMS when the folder has one.
+func verifyFolder(dir string) ([]localPage, []pageProblem, error) {
+	pages, err := scanFolder(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	sums, err := readSums(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	var problems []pageProblem
+	for _, p := range pages {
+		if err := checkImage(p.File); err != nil {
+			problems = append(problems, pageProblem{p.File, err.Error()})
+			continue
+		}
+		want, ok := sums[filepath.Base(p.File)]
+		if !ok {
+			continue
+		}
+		got, err := fileSHA256(p.File)
+		if err != nil {
+			problems = append(problems, pageProblem{p.File, err.Error()})
+		} else if got != want {
+			problems = append(problems, pageProblem{p.File, "sha256 mismatch"})
+		}
+	}
+	return pages, problems, nil
+}
+
+// verifyManifest checks the folder against its qxdl-manifest.json: every
+// page it lists as saved must be there with the recorded size and SHA-256.
+// A folder without a manifest has nothing to check.
+func verifyManifest(dir string) (*manifest, []pageProblem, error) {
+	m, err := loadManifest(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var problems []pageProblem
+	for _, name := range sortedPages(m) {
+		p := m.Pages[name]
+		if p.Status != pageOK {
+			continue
+		}
+		file := filepath.Join(dir, name)
+		fi, err := os.Stat(file)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			problems = append(problems, pageProblem{file, "missing; the manifest has it as saved"})
+			continue
+		case err != nil:
+			problems = append(problems, pageProblem{file, err.Error()})
+			continue
+		case fi.Size() != p.Bytes:
+			problems = append(problems, pageProblem{file, fmt.Sprintf("%d bytes, the manifest says %d", fi.Size(), p.Bytes)})
+			continue
+		case p.SHA256 == "":
+			continue
+		}
+		if got, err := fileSHA256(file); err != nil {
+			problems = append(problems, pageProblem{file, err.Error()})
+		} else if got != p.SHA256 {
+			problems = append(problems, pageProblem{file, "sha256 differs from the manifest"})
+		}
+	}
+	return m, problems, nil
+}
+
+// verifyRemote sends a HEAD, gap apart per host, for every saved page in the
+// manifest and reports those the server no longer has or now has in another
+// version: a different Content-Length, or a different ETag where both sides
+// have one. Nothing is downloaded.
+func verifyRemote(client *http.Client, dir string, m *manifest, ua string, gap, timeout time.Duration) []pageProblem {
+	pace := newPacer(lvlNormal, "")
+	var problems []pageProblem
+	for _, name := range sortedPages(m) {
+		p := m.Pages[name]
+		if p.Status != pageOK || p.URL == "" {
+			continue
+		}
+		file := filepath.Join(dir, name)
+		host := ""
+		if u, err := url.Parse(p.URL); err == nil {
+			host = u.Host
+		}
+		pace.before(context.Background(), host, "HEAD", gap)
+		res := headURL(context.Background(), client, p.URL, ua, timeout)
+		switch {
+		case res.Err != nil:
+			problems = append(problems, pageProblem{file, "HEAD failed: " + res.Err.Error()})
+		case res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented:
+			fmt.Printf("[WARN] %s does not answer HEAD; cannot check %s\n", host, name)
+		case res.StatusCode != http.StatusOK:
+			problems = append(problems, pageProblem{file, fmt.Sprintf("the server answers %d", res.StatusCode)})
+		case res.Size >= 0 && res.Size != m.remoteSize(name, p.Bytes):
+			problems = append(problems, pageProblem{file, fmt.Sprintf("changed on the server: %d bytes there, %d when fetched", res.Size, m.remoteSize(name, p.Bytes))})
+		case p.ETag != "" && res.Meta.ETag != "" && strings.TrimPrefix(res.Meta.ETag, "W/") != strings.TrimPrefix(p.ETag, "W/"):
+			problems = append(problems, pageProblem{file, fmt.Sprintf("changed on the server: ETag %s, was %s", res.Meta.ETag, p.ETag)})
+		}
+	}
+	return problems
+}
+
+// sortedPages lists the manifest's file names in order.
+func sortedPages(m *manifest) []string {
+	names := make([]string, 0, len(m.Pages))
+	for name := range m.Pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkSaved is -check-images: a saved page that is not a complete image is
+// deleted and turned into an error, so the caller retries it.
+func (jr *jobRun) checkSaved(dres dlResult, fileNow string) dlResult {
+	if dres.File != "" {
+		fileNow = dres.File
+	}
+	if err := checkImage(fileNow); err != nil {
+		fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[bad ] %s: %v\n", filepath.Base(fileNow), err)
+		os.Remove(fileNow)
+		dres.Err = fmt.Errorf("corrupt page: %w", err)
+	}
+	return dres
+}
+
+// redo reports whether a page already on disk should be fetched again:
+// always under -force, and under -force-missing-only when it is empty or,
+// for an image, fails checkImage. With -check-remote-size a HEAD for urlNow
+// ("" = none) also redoes a file whose size differs from Content-Length,
+// taking the size it came with from m when it was stripped or converted.
+func (jr *jobRun) redo(file, urlNow string, m *manifest) bool {
+	if jr.o.force {
+		fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[redo] %s (-force)\n", filepath.Base(file))
+		return true
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	if jr.o.forceMissing {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif":
+			err = checkImage(file)
+		default:
+			if fi.Size() == 0 {
+				err = errors.New("zero-byte file")
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[redo] %s: %v\n", filepath.Base(file), err)
+			return true
+		}
+	}
+	if jr.o.checkRemoteSize && urlNow != "" {
+		jr.pace.before(jr.ctx, jr.host, "HEAD", jr.o.headGap)
+		hres := headURL(jr.ctx, jr.client, urlNow, jr.o.ua, jr.timeout())
+		jr.rateLimited(jr.host, hres)
+		fmt.Fprintf(logAt(jr.o.verbosity, lvlVerbose), "[head] %s (%v, status=%d, size=%d)\n", urlNow, hres.Err, hres.StatusCode, hres.Size)
+		// no answer or no Content-Length: trust the file
+		if size := m.remoteSize(file, fi.Size()); hres.Err == nil && hres.StatusCode == http.StatusOK && hres.Size >= 0 && hres.Size != size {
+			fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[redo] %s: %d bytes fetched, %d on the server\n", filepath.Base(file), size, hres.Size)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set with -ldflags "-X main.version=v1.2.3 -X
+// main.commit=... -X main.buildDate=...". A plain go build or go install
+// fills in what it can from the module and VCS info Go embeds.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+type buildInfo struct {
+	Version  string
+	Commit   string
+	Date     string // the build date, or failing that the commit's
+	Modified bool   // built from a tree with uncommitted changes
+	Go       string
+	Platform string
+}
+
+func readBuildInfo() buildInfo {
+	b := buildInfo{Version: version, Commit: commit, Date: buildDate, Go: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	if b.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		b.Version = bi.Main.Version // go install module@version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if b.Commit == "" {
+				b.Commit = s.Value
+			}
+		case "vcs.time":
+			if b.Date == "" {
+				b.Date = s.Value
+			}
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+func (b buildInfo) String() string {
+	s := "qxdl-gentle " + b.Version
+	if b.Commit != "" {
+		s += "\n  commit  " + b.Commit
+		if b.Modified {
+			s += " (modified)"
+		}
+	}
+	if b.Date != "" {
+		s += "\n  date    " + b.Date
+	}
+	return s + "\n  go      " + b.Go + " " + b.Platform
+}
+
+func cmdVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	fs.Parse(args)
+	fmt.Println(readBuildInfo())
+	return exitOK
+}
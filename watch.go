@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// watch keeps a finished -end auto job alive: every -poll it runs j again
+// from the page after the last one found (for -from-feed, on the feed's new
+// entries), so new pages of an ongoing series are fetched as they appear.
+// It returns the latest round's result once the run ends (-max-duration) or
+// the host bans us.
+func (s *session) watch(j job, res jobResult) jobResult {
+	o, err := j.apply(s.o)
+	if err != nil {
+		return res
+	}
+	// the first round settled the padding; a 404 at the end is the norm now
+	s.o.probePad = false
+	s.o.interactive = false // asked once for the whole watch
+	s.o.watching = true     // the first round's completion marker stands for the folder
+	for !res.Banned {
+		if res.EndFound != "" && toDec(res.EndFound) >= toDec(j.Start) {
+			j.Start = fmt.Sprintf("%0*d", len(j.Start), toDec(res.EndFound)+o.step)
+		}
+		from := "from page " + j.Start
+		if j.FromFeed != "" {
+			from = "of the feed" // its state knows where to go on
+		}
+		fmt.Fprintf(logAt(o.verbosity, lvlNormal), "[watch] next check %s at %s (in %v)\n",
+			from, time.Now().Add(o.poll).Format("Jan 2 15:04"), o.poll)
+		t := time.NewTimer(o.poll)
+		select {
+		case <-t.C:
+		case <-s.ctx.Done():
+			t.Stop()
+			return res
+		}
+		r, err := s.runJob(j)
+		if err != nil {
+			fmt.Println("[ERROR]", err)
+			continue
+		}
+		if r.EndFound == "" || toDec(r.EndFound) < toDec(j.Start) {
+			// nothing new; look from the same page next time
+			r.EndFound = ""
+		}
+		res = r
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// watchdog samples goroutines, open file descriptors and heap size while a
+// long run is in progress and complains when they cross their limits, which
+// in a process that runs for months usually means something is leaking.
+type watchdog struct {
+	every         time.Duration
+	maxGoroutines int
+	maxFDs        int
+	maxHeap       uint64 // bytes
+
+	// onTrip, when set, is called after a warning; with -watchdog-restart
+	// it is serve's restart.
+	onTrip func(reason string)
+}
+
+// run samples until stop is closed.
+func (w *watchdog) run(stop <-chan struct{}) {
+	t := time.NewTicker(w.every)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if reason := w.check(); reason != "" {
+				fmt.Println("[WARN] watchdog:", reason)
+				if w.onTrip != nil {
+					w.onTrip(reason)
+				}
+			}
+		}
+	}
+}
+
+// check returns a description of the first exceeded limit, or "".
+func (w *watchdog) check() string {
+	if n := runtime.NumGoroutine(); w.maxGoroutines > 0 && n > w.maxGoroutines {
+		return fmt.Sprintf("%d goroutines (limit %d)", n, w.maxGoroutines)
+	}
+	if n := openFDs(); w.maxFDs > 0 && n > w.maxFDs {
+		return fmt.Sprintf("%d open file descriptors (limit %d)", n, w.maxFDs)
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if w.maxHeap > 0 && ms.HeapAlloc > w.maxHeap {
+		// only complain if a collection does not bring it back down
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		if ms.HeapAlloc > w.maxHeap {
+			return fmt.Sprintf("heap %d MiB (limit %d MiB)", ms.HeapAlloc>>20, w.maxHeap>>20)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// davSink uploads pages to a WebDAV share (Nextcloud, ownCloud, Apache) for
+// -out dav://host/path or davs://host/path (https). Each page goes up as
+// NAME.part and is then MOVEd over NAME, the same dance as on disk, so a
+// share never shows half a page. Credentials come from the URL or from
+// QXDL_DAV_USER and QXDL_DAV_PASSWORD; missing collections are made on the
+// first 409 Conflict.
+type davSink struct {
+	base   *url.URL // the collection -out points at
+	user   string
+	pass   string
+	client *http.Client
+
+	mu   sync.Mutex
+	made map[string]bool // collections known to exist
+}
+
+func isDAV(out string) bool {
+	return strings.HasPrefix(out, "dav://") || strings.HasPrefix(out, "davs://")
+}
+
+// newDAVSink returns the sink and "." as the folder pages are named in; the
+// collection itself is the base URL.
+func newDAVSink(out string) (*davSink, string, error) {
+	u, err := url.Parse(out)
+	if err != nil || u.Host == "" {
+		return nil, "", fmt.Errorf("bad WebDAV -out %q", out)
+	}
+	s := &davSink{user: os.Getenv("QXDL_DAV_USER"), pass: os.Getenv("QXDL_DAV_PASSWORD"),
+		// the share is not the site being downloaded, so it is not paced
+		client: &http.Client{Timeout: 2 * time.Minute}, made: map[string]bool{}}
+	if u.User != nil {
+		s.user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			s.pass = p
+		}
+		u.User = nil
+	}
+	u.Scheme = map[string]string{"dav": "http", "davs": "https"}[u.Scheme]
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	s.base = u
+	return s, ".", nil
+}
+
+func (s *davSink) url(name string) string {
+	u := *s.base
+	u.Path = path.Join(u.Path, filepathToKey(name))
+	return u.String()
+}
+
+func (s *davSink) do(method, target string, body []byte, hdr map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.pass)
+	}
+	for k, v := range hdr {
+		req.Header.Set(k, v)
+	}
+	return s.client.Do(req)
+}
+
+// mkcol creates the collection at the URL path dir, and its parents when
+// the server answers 409 Conflict, like os.MkdirAll.
+func (s *davSink) mkcol(dir string) error {
+	s.mu.Lock()
+	known := s.made[dir]
+	s.mu.Unlock()
+	if known || dir == "/" || dir == "." {
+		return nil
+	}
+	u := *s.base
+	u.Path = dir
+	for try := 0; ; try++ {
+		resp, err := s.do("MKCOL", u.String(), nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusConflict && try == 0:
+			if err := s.mkcol(path.Dir(dir)); err != nil {
+				return err
+			}
+			continue
+		// 405: it exists already
+		case resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed:
+			return fmt.Errorf("webdav mkcol %s: %s", dir, resp.Status)
+		}
+		s.mu.Lock()
+		s.made[dir] = true
+		s.mu.Unlock()
+		return nil
+	}
+}
+
+func (s *davSink) put(name string, body []byte, modified time.Time) error {
+	hdr := map[string]string{}
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		hdr["Content-Type"] = ct
+	}
+	if !modified.IsZero() {
+		hdr["X-OC-Mtime"] = fmt.Sprint(modified.Unix()) // Nextcloud/ownCloud keep it as the file's mtime
+	}
+	tmp := s.url(name + ".part")
+	resp, err := s.do("PUT", tmp, body, hdr)
+	if err == nil && resp.StatusCode == http.StatusConflict {
+		// the collection is missing; create it and go again
+		resp.Body.Close()
+		if err := s.mkcol(path.Dir(path.Join(s.base.Path, filepathToKey(name)))); err != nil {
+			return err
+		}
+		resp, err = s.do("PUT", tmp, body, hdr)
+	}
+	if err := s.check(resp, err); err != nil {
+		return fmt.Errorf("webdav put %s: %w", name, err)
+	}
+	err = s.check(s.do("MOVE", tmp, nil, map[string]string{"Destination": s.url(name), "Overwrite": "T"}))
+	if err != nil {
+		if resp, derr := s.do("DELETE", tmp, nil, nil); derr == nil {
+			resp.Body.Close()
+		}
+		return fmt.Errorf("webdav move %s: %w", name, err)
+	}
+	return nil
+}
+
+// check turns a non-2xx answer into an error and closes the body.
+func (s *davSink) check(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (s *davSink) exists(name string) bool {
+	resp, err := s.do("HEAD", s.url(name), nil, nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (s *davSink) close() error { return nil }
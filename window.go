@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeWindow is a daily -window in local time, as offsets from midnight.
+// from > to wraps past midnight (22:00-06:00).
+type timeWindow struct {
+	from, to time.Duration
+	text     string
+}
+
+func parseWindow(v string) (*timeWindow, error) {
+	a, b, ok := strings.Cut(v, "-")
+	if !ok {
+		return nil, fmt.Errorf("window %q is not HH:MM-HH:MM", v)
+	}
+	from, err := parseClock(a)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseClock(b)
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		return nil, fmt.Errorf("window %q is empty", v)
+	}
+	return &timeWindow{from: from, to: to, text: v}, nil
+}
+
+func parseClock(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("window: %q is not HH:MM", v)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// until is how long from now the window stays closed; 0 when it is open.
+func (w *timeWindow) until(now time.Time) time.Duration {
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	at := now.Sub(midnight)
+	open := at >= w.from && at < w.to
+	if w.from > w.to {
+		open = at >= w.from || at < w.to
+	}
+	if open {
+		return 0
+	}
+	next := midnight.Add(w.from)
+	if !next.After(now) {
+		next = time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Add(w.from)
+	}
+	return next.Sub(now)
+}
+
+// waitWindow holds the job before a page while -window is closed. The
+// -max-duration deadline cuts the wait short.
+func (jr *jobRun) waitWindow() {
+	w := jr.o.window
+	if w == nil {
+		return
+	}
+	now := jr.pace.clock.Now()
+	d := w.until(now)
+	if d == 0 {
+		return
+	}
+	fmt.Fprintf(logAt(jr.o.verbosity, lvlNormal), "[wait] outside -window %s; resuming at %s (in %v)\n",
+		w.text, now.Add(d).Format("15:04"), d.Round(time.Minute))
+	jr.stats.slept(jr.pace.sleeper.Sleep(jr.ctx, d))
+}